@@ -0,0 +1,298 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"cosmetcab.dp.ua/internal/data"
+	"cosmetcab.dp.ua/internal/validator"
+)
+
+// readUser loads the user referenced by the id parameter. When the request
+// names the version it was based on, a different stored version is reported
+// as an edit conflict. On failure the error response has already been sent
+// and nil is returned.
+func (app *application) readUser(w http.ResponseWriter, r *http.Request, version *int) *data.User {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil
+	}
+	user, err := app.models.Users.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil
+	}
+	if version != nil && *version != user.Version {
+		app.editConflictResponse(w, r)
+		return nil
+	}
+	return user
+}
+
+// saveUser stores changes made by an admin
+func (app *application) saveUser(w http.ResponseWriter, r *http.Request, user *data.User) bool {
+	err := app.models.Users.Update(user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		case errors.Is(err, data.ErrDuplicateEmail):
+			v := validator.New()
+			v.AddError("email", "a user with this email address already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return false
+	}
+	return true
+}
+
+// revokeUserAccess logs the user out everywhere
+func (app *application) revokeUserAccess(userID int64) error {
+	err := app.models.Tokens.DeleteAllForUser(data.ScopeAuthentication, userID)
+	if err != nil {
+		return err
+	}
+	return app.models.Sessions.DeleteAllForUser(userID)
+}
+
+// notSelf rejects changes admins could use to lock themselves out
+func (app *application) notSelf(w http.ResponseWriter, r *http.Request, user *data.User) bool {
+	if user.ID == app.contextGetUserID(r) {
+		app.errorResponse(w, r, http.StatusConflict, "you can't do this to your own account")
+		return false
+	}
+	return true
+}
+
+// ownerOnly rejects the change unless the admin making it is an owner when
+// any of the given roles is owner. It guards owner accounts and role
+// changes to or from owner, so admins can't take over or lock out owners.
+func (app *application) ownerOnly(w http.ResponseWriter, r *http.Request, roles ...string) bool {
+	if !validator.PermittedValue(data.RoleOwner, roles...) {
+		return true
+	}
+	actor, err := app.models.Users.Get(app.contextGetUserID(r))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return false
+	}
+	if actor.Role != data.RoleOwner {
+		app.ownerRequiredResponse(w, r)
+		return false
+	}
+	return true
+}
+
+func (app *application) listUsersHandler(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+	v := validator.New()
+	filter := data.UserFilter{
+		Query: app.readString(qs, "q", ""),
+		Role:  app.readString(qs, "role", ""),
+	}
+	if filter.Role != "" {
+		data.ValidateRole(v, filter.Role)
+	}
+	if s := app.readString(qs, "activated", ""); s != "" {
+		activated, err := strconv.ParseBool(s)
+		if err != nil {
+			v.AddError("activated", "must be true or false")
+		} else {
+			filter.Activated = &activated
+		}
+	}
+	filters := app.readFilters(qs, "id", []string{"id", "name", "email", "-id", "-name", "-email"}, v)
+	if data.ValidateFilters(v, filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	users, metadata, err := app.models.Users.GetAll(filter, filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"users": users, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) showUserHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.readUser(w, r, nil)
+	if user == nil {
+		return
+	}
+	err := app.writeJSON(w, http.StatusOK, envelope{"user": user}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateUserHandler changes the name, email or role of a user
+func (app *application) updateUserHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name    *string `json:"name"`
+		Email   *string `json:"email"`
+		Role    *string `json:"role"`
+		Version *int    `json:"version"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	user := app.readUser(w, r, input.Version)
+	if user == nil {
+		return
+	}
+	roles := []string{user.Role}
+	if input.Role != nil {
+		roles = append(roles, *input.Role)
+	}
+	if !app.ownerOnly(w, r, roles...) {
+		return
+	}
+	before := snapshot(user)
+	if input.Name != nil {
+		user.Name = *input.Name
+	}
+	if input.Email != nil {
+		user.Email = *input.Email
+	}
+	if input.Role != nil && *input.Role != user.Role {
+		if !app.notSelf(w, r, user) {
+			return
+		}
+		user.Role = *input.Role
+	}
+	v := validator.New()
+	if data.ValidateUser(v, user); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	if !app.saveUser(w, r, user) {
+		return
+	}
+	app.audit(r, data.AuditUpdate, auditUser, user.ID, before, user)
+	err = app.writeJSON(w, http.StatusOK, envelope{"user": user}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateUserActivatedHandler deactivates or reactivates a user. Deactivated
+// users are logged out everywhere and can't log in again.
+func (app *application) updateUserActivatedHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Activated *bool `json:"activated"`
+		Version   *int  `json:"version"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	if v.Check(input.Activated != nil, "activated", "must be provided"); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	user := app.readUser(w, r, input.Version)
+	if user == nil {
+		return
+	}
+	if !*input.Activated && !app.notSelf(w, r, user) {
+		return
+	}
+	if !app.ownerOnly(w, r, user.Role) {
+		return
+	}
+	before := snapshot(user)
+	user.Activated = *input.Activated
+	if !app.saveUser(w, r, user) {
+		return
+	}
+	app.audit(r, data.AuditUpdate, auditUser, user.ID, before, user)
+	if !user.Activated {
+		err = app.revokeUserAccess(user.ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"user": user}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// forcePasswordChangeHandler logs the user out everywhere and blocks their
+// logins until they set a new password with the reset token emailed to them
+func (app *application) forcePasswordChangeHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Version *int `json:"version"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	user := app.readUser(w, r, input.Version)
+	if user == nil || !app.ownerOnly(w, r, user.Role) {
+		return
+	}
+	before := snapshot(user)
+	user.PasswordChangeRequired = true
+	if !app.saveUser(w, r, user) {
+		return
+	}
+	app.audit(r, data.AuditUpdate, auditUser, user.ID, before, user)
+	err = app.revokeUserAccess(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	token, err := app.models.Tokens.New(user.ID, passwordResetTokenTTL, data.ScopePasswordReset)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	app.sendEmail(user.Email, "token_password_reset.tmpl", map[string]any{
+		"passwordResetToken": token.Plaintext,
+	})
+	err = app.writeJSON(w, http.StatusAccepted, envelope{"user": user}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteUserHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.readUser(w, r, nil)
+	if user == nil || !app.notSelf(w, r, user) || !app.ownerOnly(w, r, user.Role) {
+		return
+	}
+	err := app.models.Users.Delete(user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	app.audit(r, data.AuditDelete, auditUser, user.ID, user, nil)
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "user successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"cosmetcab.dp.ua/internal/data"
+	"cosmetcab.dp.ua/internal/notifier"
+	"cosmetcab.dp.ua/internal/validator"
+)
+
+func (app *application) createAppointmentHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		ServiceID int64     `json:"service_id"`
+		StaffID   *int64    `json:"staff_id"`
+		Name      string    `json:"name"`
+		Phone     string    `json:"phone"`
+		StartsAt  time.Time `json:"starts_at"`
+		PromoCode string    `json:"promo_code"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	service, err := app.models.Services.Get(input.ServiceID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundWithIDResponse(w, r, input.ServiceID)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	appointment := &data.Appointment{
+		ServiceID:   service.ID,
+		ClientName:  input.Name,
+		ClientPhone: input.Phone,
+		Status:      data.AppointmentPending,
+	}
+	if input.StaffID != nil {
+		appointment.StaffID = sql.NullInt64{Int64: *input.StaffID, Valid: true}
+	}
+
+	v := validator.New()
+	v.Check(input.StartsAt.After(time.Now()), "starts_at", "must be in the future")
+	err = app.setAppointmentSlot(appointment, input.StartsAt, v)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	var promotion *data.Promotion
+	if input.PromoCode != "" {
+		promotion, err = app.promotionForCode(input.PromoCode, service, v)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+	if data.ValidateAppointment(appointment, v); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	overlaps, err := app.models.Appointments.Overlaps(appointment)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if overlaps {
+		app.appointmentOverlapResponse(w, r)
+		return
+	}
+	if promotion != nil {
+		redeemed, err := app.models.Promotions.Redeem(promotion.ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		if !redeemed {
+			v.AddError("promo_code", "invalid or expired promo code")
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+		appointment.PromotionID = promotion.ID
+	}
+	err = app.models.Appointments.Insert(appointment)
+	if err != nil {
+		if promotion != nil {
+			if err := app.models.Promotions.Release(promotion.ID); err != nil {
+				app.logError(r, err)
+			}
+		}
+		switch {
+		case errors.Is(err, data.ErrAppointmentOverlap):
+			app.appointmentOverlapResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	app.audit(r, data.AuditCreate, auditAppointment, appointment.ID, nil, appointment)
+	app.notify(notifier.EventBooking, fmt.Sprintf("Запис #%d", appointment.ID), fmt.Sprintf(
+		"Послуга: %s\nЧас: %s\nІм'я: %s\nТелефон: %s",
+		service.Description,
+		appointment.StartsAt.In(app.location).Format("02.01.2006 15:04"),
+		appointment.ClientName,
+		appointment.ClientPhone,
+	))
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/appointments/%d", appointment.ID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"appointment": appointment}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) showAppointmentHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	appointment, err := app.models.Appointments.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"appointment": appointment}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listAppointmentsHandler(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+	v := validator.New()
+	filter := data.AppointmentFilter{
+		Status:    app.readString(qs, "status", ""),
+		ServiceID: app.readInt64(qs, "service_id", 0, v),
+		StaffID:   app.readInt64(qs, "staff_id", 0, v),
+	}
+	v.Check(filter.Status == "" || validator.PermittedValue(filter.Status, data.AppointmentPending, data.AppointmentConfirmed, data.AppointmentCancelled), "status", "must be pending, confirmed or cancelled")
+	filters := app.readFilters(qs, "starts_at", []string{"id", "starts_at", "created_at", "-id", "-starts_at", "-created_at"}, v)
+	if data.ValidateFilters(v, filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	appointments, metadata, err := app.models.Appointments.GetAll(filter, filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"appointments": appointments, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateAppointmentHandler lets admins confirm, reschedule or cancel a booking
+func (app *application) updateAppointmentHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	appointment, err := app.models.Appointments.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	before := snapshot(appointment)
+	var input struct {
+		StaffID  *int64     `json:"staff_id"`
+		StartsAt *time.Time `json:"starts_at"`
+		Status   *string    `json:"status"`
+	}
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	if input.StaffID != nil || input.StartsAt != nil {
+		startsAt := appointment.StartsAt
+		if input.StartsAt != nil {
+			startsAt = *input.StartsAt
+			v.Check(startsAt.After(time.Now()), "starts_at", "must be in the future")
+		}
+		if input.StaffID != nil {
+			appointment.StaffID = sql.NullInt64{Int64: *input.StaffID, Valid: true}
+		}
+		err = app.setAppointmentSlot(appointment, startsAt, v)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+	if input.Status != nil {
+		appointment.Status = *input.Status
+	}
+	if data.ValidateAppointment(appointment, v); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	if appointment.Status != data.AppointmentCancelled {
+		overlaps, err := app.models.Appointments.Overlaps(appointment)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		if overlaps {
+			app.appointmentOverlapResponse(w, r)
+			return
+		}
+	}
+	err = app.models.Appointments.Update(appointment)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		case errors.Is(err, data.ErrAppointmentOverlap):
+			app.appointmentOverlapResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	app.audit(r, data.AuditUpdate, auditAppointment, appointment.ID, before, appointment)
+	err = app.writeJSON(w, http.StatusOK, envelope{"appointment": appointment}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// setAppointmentSlot places the appointment at startsAt for as long as its
+// service takes. When a master is chosen, their duration override is used
+// and the slot must fit into their working hours; problems with the choice
+// are reported through the validator.
+func (app *application) setAppointmentSlot(appointment *data.Appointment, startsAt time.Time, v *validator.Validator) error {
+	if !appointment.StaffID.Valid {
+		service, err := app.models.Services.Get(appointment.ServiceID)
+		if err != nil {
+			return err
+		}
+		appointment.SetSlot(startsAt, service.Duration())
+		return nil
+	}
+	master, err := app.models.Staff.GetServiceMaster(appointment.StaffID.Int64, appointment.ServiceID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("staff_id", "master does not offer this service")
+			return nil
+		default:
+			return err
+		}
+	}
+	appointment.SetSlot(startsAt.In(app.location), master.Duration())
+
+	schedule, err := app.models.Schedules.Get(master.ID)
+	if err != nil {
+		return err
+	}
+	v.Check(schedule.Covers(appointment.Interval()), "starts_at", "is outside of the master's working hours")
+	return nil
+}
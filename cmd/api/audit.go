@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"cosmetcab.dp.ua/internal/data"
+	"cosmetcab.dp.ua/internal/validator"
+)
+
+// Entity types recorded in the audit log
+const (
+	auditCategory          = "category"
+	auditSubCategory       = "subcategory"
+	auditService           = "service"
+	auditServicePrice      = "service_price"
+	auditStaff             = "staff"
+	auditStaffService      = "staff_service"
+	auditWorkingHours      = "working_hours"
+	auditBreaks            = "breaks"
+	auditScheduleException = "schedule_exception"
+	auditAppointment       = "appointment"
+	auditLead              = "lead"
+	auditJob               = "job"
+	auditUser              = "user"
+	auditLockout           = "lockout"
+	auditPromotion         = "promotion"
+	auditPackage           = "package"
+	auditMedia             = "media"
+)
+
+// snapshot encodes the state of an entity before it is changed, so it can
+// be recorded together with the new state once the change succeeded
+func snapshot(v any) json.RawMessage {
+	js, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	return js
+}
+
+// audit records a change made by the request. The change has already been
+// saved at this point, so failing to record it is logged but doesn't fail
+// the request. A nil before or after is stored as NULL.
+func (app *application) audit(r *http.Request, action, entityType string, entityID int64, before, after any) {
+	entry := &data.AuditEntry{
+		ActorID:    app.contextLookupUserID(r),
+		Action:     action,
+		EntityType: entityType,
+		EntityID:   entityID,
+		RequestID:  app.contextGetRequestID(r),
+	}
+	if before != nil {
+		entry.Before = snapshot(before)
+	}
+	if after != nil {
+		entry.After = snapshot(after)
+	}
+	err := app.models.Audit.Insert(entry)
+	if err != nil {
+		app.logger.Error("Error writing audit log", "action", action, "entity_type", entityType, "entity_id", entityID, "request_id", entry.RequestID, "err", err)
+	}
+}
+
+// listAuditHandler returns audit log entries, newest first by default
+func (app *application) listAuditHandler(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+	v := validator.New()
+	filter := data.AuditFilter{
+		ActorID:    app.readInt64(qs, "actor_id", 0, v),
+		Action:     app.readString(qs, "action", ""),
+		EntityType: app.readString(qs, "entity_type", ""),
+		EntityID:   app.readInt64(qs, "entity_id", 0, v),
+		From:       app.readTime(qs, "from", v),
+		To:         app.readTime(qs, "to", v),
+	}
+	filters := app.readFilters(qs, "-created_at", []string{"id", "created_at", "-id", "-created_at"}, v)
+	data.ValidateAuditFilter(v, filter)
+	if data.ValidateFilters(v, filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	entries, metadata, err := app.models.Audit.GetAll(filter, filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"audit": entries, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
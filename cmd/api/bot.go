@@ -3,8 +3,9 @@ package main
 import (
 	"fmt"
 	"net/http"
-	"net/url"
 
+	"cosmetcab.dp.ua/internal/data"
+	"cosmetcab.dp.ua/internal/notifier"
 	"cosmetcab.dp.ua/internal/validator"
 )
 
@@ -36,15 +37,21 @@ func (app *application) sendToTelegramHandler(w http.ResponseWriter, r *http.Req
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
-	formattedMessage := fmt.Sprintf("Ім'я: %s\nТелефон: %s\nПовідомлення: %s", input.Name, input.Phone, input.Message)
-	// encode formatted message so it can be safely placed inside url query
-	encodedMessage := url.QueryEscape(formattedMessage)
-
-	err = app.sendToBot(encodedMessage)
+	// store the message first so it is not lost if Telegram is unavailable
+	lead := &data.Lead{
+		Name:    input.Name,
+		Phone:   input.Phone,
+		Message: input.Message,
+		Status:  data.LeadNew,
+	}
+	err = app.models.Leads.Insert(lead)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
+	app.audit(r, data.AuditCreate, auditLead, lead.ID, nil, lead)
+	formattedMessage := fmt.Sprintf("Ім'я: %s\nТелефон: %s\nПовідомлення: %s", input.Name, input.Phone, input.Message)
+	app.notify(notifier.EventLead, fmt.Sprintf("Заявка #%d", lead.ID), formattedMessage)
 	err = app.writeJSON(w, http.StatusOK, envelope{"message": "sent"}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
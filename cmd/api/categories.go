@@ -4,8 +4,6 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
-	"strings"
-	"sync"
 
 	"cosmetcab.dp.ua/internal/data"
 	"cosmetcab.dp.ua/internal/validator"
@@ -18,69 +16,58 @@ func (app *application) createCategoryHandler(w http.ResponseWriter, r *http.Req
 		app.badRequestResponse(w, r, err)
 		return
 	}
-	// Retrieve the file from the form data.
-	// The 'photo' key corresponds to the 'name' attribute
-	// of the file input field in the form
-	file, header, err := r.FormFile("photo")
-	if err != nil {
-		app.badRequestResponse(w, r, err)
-		return
-	}
-	defer file.Close()
-	fileName, err := generateUniqueImageName(header.Filename)
+	photo, err := app.readPhoto(r)
 	if err != nil {
 		app.badRequestResponse(w, r, err)
 		return
 	}
+	defer photo.Close()
 
 	var input struct {
 		Title       string `json:"title"`
 		Description string `json:"description"`
-		PhotoURL    string `json:"photo_url"`
 	}
-	input.PhotoURL = blobURL + containerName + fileName
 	input.Title = r.FormValue("title")
 	input.Description = r.FormValue("description")
 
 	category := &data.Category{
 		Title:       input.Title,
 		Description: input.Description,
-		PhotoURL:    input.PhotoURL,
 	}
 	v := validator.New()
 	if data.ValidateCategory(category, v); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
-	var wg sync.WaitGroup
-	// If validation is correct then we can upload image in a background goroutine
-	app.background(func() {
-		defer wg.Done()
-		wg.Add(1)
-		uplErr := app.azureBlobStorage.UploadBlob(fileName, &file)
-		if uplErr != nil {
-			// if image could not be uploaded, log error and send it to telegram
-			app.logAndSendErr("image was not uploaded", header.Filename, uplErr)
-
+	variants, err := app.processPhoto(photo)
+	if err != nil {
+		switch {
+		case errors.Is(err, errInvalidImage):
+			v.AddError("photo", invalidImageMessage)
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
 		}
-	})
+		return
+	}
+	category.Photos = app.photoVariantURLs(variants)
+	category.PhotoURL = category.Photos["hero"]
+	// If validation is correct then we can queue the images for upload
+	err = app.uploadPhotoVariants(variants)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
 
 	err = app.models.Categories.Insert(category)
 	if err != nil {
 		// if err occured while saving to DB, perform deletion in a background goroutine
-		// of image that have been saved to blob storage
-		app.background(func() {
-			// wait for uploading to finish
-			wg.Wait()
-			delErr := app.azureBlobStorage.DeleteBlob(fileName)
-			if delErr != nil {
-				app.logAndSendErr("image was not deleted", header.Filename, delErr)
-
-			}
-		})
+		// of images that have been saved to blob storage
+		app.discardPhotoVariants(variants)
 		app.dbErrorResponse(w, r, err)
 		return
 	}
+	app.audit(r, data.AuditCreate, auditCategory, category.ID, nil, category)
 	headers := make(http.Header)
 	headers.Set("Location", fmt.Sprintf("/categories/%d", category.ID))
 
@@ -110,20 +97,43 @@ func (app *application) showCategoryHandler(w http.ResponseWriter, r *http.Reque
 		return
 
 	}
+	err = app.localizeCategories(app.language(w, r), category)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	gallery, err := app.models.Media.GetAll(data.MediaCategory, category.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"category": category}, nil)
+	err = app.writeJSON(w, http.StatusOK, envelope{"category": category, "gallery": gallery}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 }
 
 func (app *application) listCategoriesHanlder(w http.ResponseWriter, r *http.Request) {
-	categories, err := app.models.Categories.GetAll()
+	qs := r.URL.Query()
+	v := validator.New()
+	title := app.readString(qs, "title", "")
+	filters := app.readFilters(qs, "id", []string{"id", "title", "-id", "-title"}, v)
+	if data.ValidateFilters(v, filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	categories, metadata, err := app.models.Categories.GetAll(title, filters)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
-	err = app.writeJSON(w, http.StatusOK, envelope{"categories": categories}, nil)
+	err = app.localizeCategories(app.language(w, r), categories...)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"categories": categories, "metadata": metadata}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -146,6 +156,7 @@ func (app *application) updateCategoryHandler(w http.ResponseWriter, r *http.Req
 		}
 		return
 	}
+	before := snapshot(category)
 	err = r.ParseMultipartForm(10 << 20) // max size 10MB
 	if err != nil {
 		app.badRequestResponse(w, r, err)
@@ -167,49 +178,51 @@ func (app *application) updateCategoryHandler(w http.ResponseWriter, r *http.Req
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
-	// Retrieve the file from the form data.
-	// The 'photo' key corresponds to the 'name' attribute
-	// of the file input field in the form
-	file, header, err := r.FormFile("photo")
+	var (
+		oldPhotoURL string
+		oldPhotos   data.PhotoVariants
+		variants    []*photoVariant
+	)
+	photo, err := app.readPhoto(r)
 	if nil == err {
 		// this means user specified the file and therefore
 		// we need to upload it to the blob
-		defer file.Close()
-		fileName, err := generateUniqueImageName(header.Filename)
+		defer photo.Close()
+		variants, err = app.processPhoto(photo)
 		if err != nil {
-			app.badRequestResponse(w, r, err)
+			switch {
+			case errors.Is(err, errInvalidImage):
+				v.AddError("photo", invalidImageMessage)
+				app.failedValidationResponse(w, r, v.Errors)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
 			return
 		}
-		// if file provided has supported extension, we have to delete previous blob
-		// before uploading a new one
-		photoURL := category.PhotoURL
-		// split photoURL to get blobName
-		blobName := strings.Split(photoURL, containerName)
-		// delete old image in a background goroutine
-		app.background(func() {
-			delErr := app.azureBlobStorage.DeleteBlob(blobName[1])
-			if delErr != nil {
-				app.logAndSendErr("image was not deleted", photoURL, delErr)
-			}
-		})
-		// upload new image in a background goroutine
-
-		app.background(func() {
-			uplErr := app.azureBlobStorage.UploadBlob(fileName, &file)
-			if uplErr != nil {
-				app.logAndSendErr("image was not uploaded", header.Filename, uplErr)
-
-			}
-		})
-		category.PhotoURL = blobURL + containerName + fileName
-
+		err = app.uploadPhotoVariants(variants)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		oldPhotoURL, oldPhotos = category.PhotoURL, category.Photos
+		category.Photos = app.photoVariantURLs(variants)
+		category.PhotoURL = category.Photos["hero"]
+	} else if !errors.Is(err, http.ErrMissingFile) {
+		app.badRequestResponse(w, r, err)
+		return
 	}
 
 	err = app.models.Categories.Update(category)
 	if err != nil {
+		app.discardPhotoVariants(variants)
 		app.serverErrorResponse(w, r, err)
 		return
 	}
+	app.audit(r, data.AuditUpdate, auditCategory, category.ID, before, category)
+	// the old images are deleted only once the new ones are saved
+	if oldPhotoURL != "" {
+		app.deletePhotos(oldPhotoURL, oldPhotos)
+	}
 
 	err = app.writeJSON(w, http.StatusAccepted, envelope{"category": category}, nil)
 	if err != nil {
@@ -223,27 +236,55 @@ func (app *application) deleteCategoryHandler(w http.ResponseWriter, r *http.Req
 		app.notFoundResponse(w, r)
 		return
 	}
+	category, err := app.models.Categories.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	gallery, err := app.models.Media.GetAll(data.MediaCategory, id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	// the services of the category are deleted with it, their media too
+	serviceGalleries, err := app.models.Media.GetAllOfCategoryServices(id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	// so are its packages, whose photos must be deleted as well
+	packages, err := app.models.Packages.GetAllForCategory(id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
 
 	photoURL, err := app.models.Categories.Delete(id)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
 			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrServiceInPackage):
+			app.serviceInPackageResponse(w, r)
 		default:
 			app.serverErrorResponse(w, r, err)
 
 		}
 		return
 	}
-	// split photoURL by containerName to get blobName
-	blobName := strings.Split(photoURL, containerName)
-
-	app.background(func() {
-		delErr := app.azureBlobStorage.DeleteBlob(blobName[1])
-		if delErr != nil {
-			app.logAndSendErr("image was not deleted", photoURL, delErr)
-		}
-	})
+	app.audit(r, data.AuditDelete, auditCategory, id, category, nil)
+	app.deletePhotos(photoURL, category.Photos)
+	app.deleteGallery(gallery)
+	app.deleteGallery(serviceGalleries)
+	for _, pkg := range packages {
+		app.deletePhoto(pkg.PhotoURL)
+	}
 	err = app.writeJSON(w, http.StatusAccepted, envelope{"message": "category successfully deleted"}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"net/http"
+)
+
+type contextKey string
+
+const (
+	userIDContextKey    = contextKey("userID")
+	requestIDContextKey = contextKey("requestID")
+)
+
+// contextSetUserID returns a copy of the request carrying the ID of the
+// authenticated user
+func (app *application) contextSetUserID(r *http.Request, userID int64) *http.Request {
+	ctx := context.WithValue(r.Context(), userIDContextKey, userID)
+	return r.WithContext(ctx)
+}
+
+// contextGetUserID returns the ID of the authenticated user. It is only
+// called behind checkAuth, so a missing value is a programming error.
+func (app *application) contextGetUserID(r *http.Request) int64 {
+	userID, ok := r.Context().Value(userIDContextKey).(int64)
+	if !ok {
+		panic("missing user id value in request context")
+	}
+	return userID
+}
+
+// contextLookupUserID returns the ID of the authenticated user or 0 for
+// anonymous requests
+func (app *application) contextLookupUserID(r *http.Request) int64 {
+	userID, _ := r.Context().Value(userIDContextKey).(int64)
+	return userID
+}
+
+func (app *application) contextSetRequestID(r *http.Request, requestID string) *http.Request {
+	ctx := context.WithValue(r.Context(), requestIDContextKey, requestID)
+	return r.WithContext(ctx)
+}
+
+// contextGetRequestID returns the ID assigned to the request by the
+// requestID middleware or an empty string outside of it
+func (app *application) contextGetRequestID(r *http.Request) string {
+	requestID, _ := r.Context().Value(requestIDContextKey).(string)
+	return requestID
+}
@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"net/http"
 	"runtime"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/lib/pq"
 )
@@ -17,7 +19,7 @@ func (app *application) logError(r *http.Request, err error) {
 	_, file, line, _ := runtime.Caller(2)
 	msg := fmt.Sprintf("error occurred in file %s, line %d\n", file, line)
 
-	app.logger.Error(err.Error(), "method", method, "uri", uri, "err", msg)
+	app.logger.Error(err.Error(), "method", method, "uri", uri, "request_id", app.contextGetRequestID(r), "err", msg)
 }
 
 func (app *application) errorResponse(w http.ResponseWriter, r *http.Request, status int, message any) {
@@ -77,6 +79,13 @@ func (app *application) rateLimitExceededResponse(w http.ResponseWriter, r *http
 	app.errorResponse(w, r, http.StatusTooManyRequests, message)
 }
 
+func (app *application) tooManyLoginAttemptsResponse(w http.ResponseWriter, r *http.Request, wait time.Duration) {
+	seconds := int((wait + time.Second - 1) / time.Second)
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	message := fmt.Sprintf("too many failed login attempts, try again in %d seconds", seconds)
+	app.errorResponse(w, r, http.StatusTooManyRequests, message)
+}
+
 func (app *application) invalidCredentialsResponse(w http.ResponseWriter, r *http.Request) {
 	message := "invalid authentication credentials"
 	app.errorResponse(w, r, http.StatusUnauthorized, message)
@@ -88,7 +97,58 @@ func (app *application) unauthorizedUserResponse(w http.ResponseWriter, r *http.
 
 }
 
+func (app *application) invalidAuthenticationTokenResponse(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("WWW-Authenticate", "Bearer")
+	message := "invalid or missing authentication token"
+	app.errorResponse(w, r, http.StatusUnauthorized, message)
+}
+
 func (app *application) inactiveAccountResponse(w http.ResponseWriter, r *http.Request) {
 	message := "your user account must be activated to access this resource"
 	app.errorResponse(w, r, http.StatusForbidden, message)
 }
+
+func (app *application) passwordChangeRequiredResponse(w http.ResponseWriter, r *http.Request) {
+	message := "your password must be changed, use the password reset sent to your email address"
+	app.errorResponse(w, r, http.StatusForbidden, message)
+}
+
+func (app *application) notPermittedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "your user account doesn't have the necessary permissions to access this resource"
+	app.errorResponse(w, r, http.StatusForbidden, message)
+}
+
+func (app *application) ownerRequiredResponse(w http.ResponseWriter, r *http.Request) {
+	message := "only owners can change owner accounts or grant and revoke the owner role"
+	app.errorResponse(w, r, http.StatusForbidden, message)
+}
+
+func (app *application) twoFactorRequiredResponse(w http.ResponseWriter, r *http.Request) {
+	message := "your user account must have two-factor authentication enabled to access this resource"
+	app.errorResponse(w, r, http.StatusForbidden, message)
+}
+
+func (app *application) invalidUploadURLResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the upload URL is invalid or has expired"
+	app.errorResponse(w, r, http.StatusForbidden, message)
+}
+
+func (app *application) editConflictResponse(w http.ResponseWriter, r *http.Request) {
+	message := "unable to update the record due to an edit conflict, please try again"
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
+
+func (app *application) serviceInPackageResponse(w http.ResponseWriter, r *http.Request) {
+	message := "a service being deleted is included in a package, remove it from the package first"
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
+
+func (app *application) appointmentOverlapResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the requested time slot is already booked"
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
+
+func (app *application) staffAppointmentsOverlapResponse(w http.ResponseWriter, r *http.Request) {
+	message := "appointments of this staff member would overlap with unassigned ones, reassign or cancel them first"
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
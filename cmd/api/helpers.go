@@ -1,29 +1,108 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"net/netip"
 	"net/url"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
+	"cosmetcab.dp.ua/internal/data"
+	"cosmetcab.dp.ua/internal/notifier"
+	"cosmetcab.dp.ua/internal/validator"
 	"github.com/google/uuid"
 	"github.com/julienschmidt/httprouter"
 )
 
 func (app *application) readIDParam(r *http.Request) (int64, error) {
+	return app.readInt64Param(r, "id")
+}
+
+func (app *application) readInt64Param(r *http.Request, name string) (int64, error) {
 	params := httprouter.ParamsFromContext(r.Context())
-	id, err := strconv.ParseInt(params.ByName("id"), 10, 64)
+	id, err := strconv.ParseInt(params.ByName(name), 10, 64)
 	if err != nil || id < 1 {
-		return 0, errors.New("invalid ID parameter")
+		return 0, fmt.Errorf("invalid %s parameter", name)
 	}
 	return id, nil
 }
 
+func (app *application) readString(qs url.Values, key string, defaultValue string) string {
+	s := qs.Get(key)
+	if s == "" {
+		return defaultValue
+	}
+	return s
+}
+
+func (app *application) readInt64(qs url.Values, key string, defaultValue int64, v *validator.Validator) int64 {
+	s := qs.Get(key)
+	if s == "" {
+		return defaultValue
+	}
+	i, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		v.AddError(key, "must be an integer value")
+		return defaultValue
+	}
+	return i
+}
+
+func (app *application) readInt(qs url.Values, key string, defaultValue int, v *validator.Validator) int {
+	s := qs.Get(key)
+	if s == "" {
+		return defaultValue
+	}
+	i, err := strconv.Atoi(s)
+	if err != nil {
+		v.AddError(key, "must be an integer value")
+		return defaultValue
+	}
+	return i
+}
+
+// readTime reads an RFC 3339 time or a date from the query string. The zero
+// time is returned when the key is missing.
+func (app *application) readTime(qs url.Values, key string, v *validator.Validator) time.Time {
+	s := qs.Get(key)
+	if s == "" {
+		return time.Time{}
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err == nil {
+		return t
+	}
+	t, err = time.ParseInLocation(data.DateLayout, s, app.location)
+	if err != nil {
+		v.AddError(key, "must be a date or an RFC 3339 time")
+		return time.Time{}
+	}
+	return t
+}
+
+// defaultPageSize is large enough for the site to show a whole
+// catalogue section without asking for more pages
+const defaultPageSize = 100
+
+// readFilters reads the page, page_size and sort query parameters.
+// The sort parameter must be one of sortSafelist.
+func (app *application) readFilters(qs url.Values, defaultSort string, sortSafelist []string, v *validator.Validator) data.Filters {
+	return data.Filters{
+		Page:         app.readInt(qs, "page", 1, v),
+		PageSize:     app.readInt(qs, "page_size", defaultPageSize, v),
+		Sort:         app.readString(qs, "sort", defaultSort),
+		SortSafelist: sortSafelist,
+	}
+}
+
 type envelope map[string]any
 
 func (app *application) writeJSON(w http.ResponseWriter, status int, data envelope, headers http.Header) error {
@@ -132,22 +211,109 @@ func (app *application) background(fn func()) {
 	}()
 }
 
-func (app *application) sendToBot(message string) error {
-	url := fmt.Sprintf("https://api.telegram.org/bot%s/sendMessage?chat_id=%v&text=%s", botToken, chatID, message)
-	resp, err := http.Get(url)
-	if err != nil {
-		return err
+// notify sends a message through the notification channels
+// routed for its event in a background goroutine
+func (app *application) notify(event notifier.Event, subject, text string) {
+	if app.notifier == nil {
+		return
 	}
-	defer resp.Body.Close()
-	return nil
+	app.background(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		err := app.notifier.Notify(ctx, notifier.Message{Event: event, Subject: subject, Text: text})
+		if err != nil {
+			app.logger.Error("Error sending notification", "event", event, "err", err)
+		}
+	})
+}
+
+// sendEmail sends a templated email in the background
+func (app *application) sendEmail(recipient, templateFile string, data any) {
+	app.background(func() {
+		err := app.mailer.Send(recipient, templateFile, data)
+		if err != nil {
+			app.logAndSendErr("email was not sent", templateFile, err)
+		}
+	})
 }
 
 func (app *application) logAndSendErr(message, resource string, err error) {
 	app.logger.Error(err.Error())
 	errMessage := fmt.Sprintf("Error: %s with name or path %s", message, resource)
-	// encode formatted message so it can be safely placed inside url query
-	encodedErrMessage := url.QueryEscape(errMessage)
-	if sendErr := app.sendToBot(encodedErrMessage); sendErr != nil {
-		app.logger.Error("Error sending message to Telegram: %v", sendErr)
+	app.notify(notifier.EventError, "Error", errMessage)
+}
+
+// trustedProxies are the networks of reverse proxies in front of the API
+// that are trusted to report the client address in X-Forwarded-For
+type trustedProxies []netip.Prefix
+
+// parseTrustedProxies parses a comma separated list of IP addresses and
+// CIDR networks
+func parseTrustedProxies(s string) (trustedProxies, error) {
+	var proxies trustedProxies
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		if !strings.Contains(field, "/") {
+			addr, err := netip.ParseAddr(field)
+			if err != nil {
+				return nil, err
+			}
+			field = netip.PrefixFrom(addr, addr.BitLen()).String()
+		}
+		prefix, err := netip.ParsePrefix(field)
+		if err != nil {
+			return nil, err
+		}
+		proxies = append(proxies, prefix.Masked())
+	}
+	return proxies, nil
+}
+
+func (p trustedProxies) contains(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
 	}
+	addr = addr.Unmap()
+	for _, prefix := range p {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP returns the IP address the request came from. It is the key of
+// the rate limiter and the login lockouts. A request relayed by a trusted
+// proxy is attributed to the last address in X-Forwarded-For that isn't a
+// trusted proxy itself, earlier entries can be forged by the client. With
+// no trusted proxies configured the API is assumed to be reached directly,
+// behind an untrusted proxy all clients would share its address.
+func (p trustedProxies) clientIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	if !p.contains(ip) {
+		return ip
+	}
+	forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		addr := strings.TrimSpace(forwarded[i])
+		if _, err := netip.ParseAddr(addr); err != nil {
+			break
+		}
+		ip = addr
+		if !p.contains(addr) {
+			break
+		}
+	}
+	return ip
+}
+
+func (app *application) clientIP(r *http.Request) string {
+	return app.config.trustedProxies.clientIP(r)
 }
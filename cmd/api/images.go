@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+
+	_ "golang.org/x/image/bmp"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+var errInvalidImage = errors.New("the file is not a supported image")
+
+// invalidImageMessage is the validation error for uploads failing with
+// errInvalidImage
+const invalidImageMessage = "must be a JPEG, PNG, GIF, BMP or WebP image"
+
+// maxImagePixels guards against decompression bombs, small files that
+// declare enormous dimensions
+const maxImagePixels = 50_000_000
+
+// imageVariant is a width uploaded photos are resized to. Narrower
+// images are not enlarged.
+type imageVariant struct {
+	name  string
+	width int
+}
+
+var imageVariants = []imageVariant{
+	{"thumbnail", 320},
+	{"card", 800},
+	{"hero", 1920},
+}
+
+// processedImage is an uploaded image encoded in one of the variants
+type processedImage struct {
+	variant   string
+	extension string
+	content   []byte
+}
+
+// processImage decodes the upload, which proves it really is an image,
+// and encodes it in every variant width. Encoding writes no metadata, so
+// EXIF including the GPS position is dropped; the orientation EXIF stores
+// is applied to the pixels first.
+//
+// There are no WebP variants: neither the standard library nor
+// golang.org/x/image can encode WebP. WebP uploads are accepted and
+// served as JPEG or PNG like the other formats.
+//
+// The upload is decoded as it is read. Only the header is kept, it is
+// read twice: to check the dimensions before decoding and for the EXIF
+// data, which comes before the image data.
+func processImage(r io.Reader) ([]*processedImage, error) {
+	var header bytes.Buffer
+	config, format, err := image.DecodeConfig(io.TeeReader(r, &header))
+	if err != nil {
+		return nil, errInvalidImage
+	}
+	if int64(config.Width)*int64(config.Height) > maxImagePixels {
+		return nil, errInvalidImage
+	}
+	orientation := 1
+	if format == "jpeg" {
+		orientation = jpegOrientation(header.Bytes())
+	}
+	img, _, err := image.Decode(io.MultiReader(&header, r))
+	if err != nil {
+		return nil, errInvalidImage
+	}
+	img = orient(img, orientation)
+	// transparency is kept in PNG, everything else becomes a JPEG
+	opaque := true
+	if o, ok := img.(interface{ Opaque() bool }); ok {
+		opaque = o.Opaque()
+	}
+
+	images := make([]*processedImage, 0, len(imageVariants))
+	for _, variant := range imageVariants {
+		resized := resizeImage(img, variant.width)
+		var buf bytes.Buffer
+		processed := &processedImage{variant: variant.name}
+		if opaque {
+			processed.extension = ".jpg"
+			err = jpeg.Encode(&buf, resized, &jpeg.Options{Quality: 85})
+		} else {
+			processed.extension = ".png"
+			err = png.Encode(&buf, resized)
+		}
+		if err != nil {
+			return nil, err
+		}
+		processed.content = buf.Bytes()
+		images = append(images, processed)
+	}
+	return images, nil
+}
+
+// resizeImage scales the image down to the width keeping its aspect ratio
+func resizeImage(img image.Image, width int) image.Image {
+	bounds := img.Bounds()
+	if bounds.Dx() <= width {
+		return img
+	}
+	height := bounds.Dy() * width / bounds.Dx()
+	if height < 1 {
+		height = 1
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, bounds, draw.Src, nil)
+	return dst
+}
+
+// jpegOrientation returns the EXIF orientation of a JPEG image, 1 when
+// the image has none. The content may be cut off after the EXIF data.
+func jpegOrientation(content []byte) int {
+	if len(content) < 4 || content[0] != 0xFF || content[1] != 0xD8 {
+		return 1
+	}
+	rest := content[2:]
+	for len(rest) >= 4 && rest[0] == 0xFF {
+		marker := rest[1]
+		// EXIF comes before the image data
+		if marker == 0xDA || marker == 0xD9 {
+			break
+		}
+		size := int(binary.BigEndian.Uint16(rest[2:4]))
+		if size < 2 || len(rest) < 2+size {
+			break
+		}
+		segment := rest[4 : 2+size]
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return exifOrientation(segment[6:])
+		}
+		rest = rest[2+size:]
+	}
+	return 1
+}
+
+// exifOrientation reads the orientation tag from the first IFD of the
+// TIFF structure EXIF data is stored in
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+	offset := int(order.Uint32(tiff[4:8]))
+	if offset < 8 || offset+2 > len(tiff) {
+		return 1
+	}
+	count := int(order.Uint16(tiff[offset:]))
+	for i := 0; i < count; i++ {
+		entry := offset + 2 + i*12
+		if entry+12 > len(tiff) {
+			break
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			orientation := int(order.Uint16(tiff[entry+8:]))
+			if orientation < 1 || orientation > 8 {
+				return 1
+			}
+			return orientation
+		}
+	}
+	return 1
+}
+
+// orient turns and flips the image as its EXIF orientation says, so it
+// is upright once the EXIF data is gone
+func orient(img image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	dstW, dstH := w, h
+	if orientation >= 5 {
+		dstW, dstH = h, w
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, dstW, dstH))
+	for y := 0; y < dstH; y++ {
+		for x := 0; x < dstW; x++ {
+			var sx, sy int
+			switch orientation {
+			case 2: // mirrored
+				sx, sy = w-1-x, y
+			case 3: // upside down
+				sx, sy = w-1-x, h-1-y
+			case 4: // upside down and mirrored
+				sx, sy = x, h-1-y
+			case 5: // transposed
+				sx, sy = y, x
+			case 6: // turned 90° counterclockwise, needs a clockwise turn
+				sx, sy = y, h-1-x
+			case 7: // transversed
+				sx, sy = w-1-y, h-1-x
+			case 8: // turned 90° clockwise, needs a counterclockwise turn
+				sx, sy = w-1-y, x
+			}
+			dst.Set(x, y, img.At(bounds.Min.X+sx, bounds.Min.Y+sy))
+		}
+	}
+	return dst
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"strings"
+	"testing"
+
+	"cosmetcab.dp.ua/internal/assert"
+)
+
+func TestProcessImage(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 1000, 500))
+	for x := 0; x < 1000; x++ {
+		img.Set(x, 0, color.RGBA{R: 255, A: 255})
+	}
+	var buf bytes.Buffer
+	err := png.Encode(&buf, img)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a transparent PNG stays a PNG, narrow variants are not enlarged
+	images, err := processImage(&buf)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, len(images), len(imageVariants))
+	widths := map[string]int{"thumbnail": 320, "card": 800, "hero": 1000}
+	for _, processed := range images {
+		assert.Equal(t, processed.extension, ".png")
+		config, _, err := image.DecodeConfig(bytes.NewReader(processed.content))
+		assert.Equal(t, err, nil)
+		assert.Equal(t, config.Width, widths[processed.variant])
+	}
+
+	_, err = processImage(strings.NewReader("definitely not an image"))
+	assert.Equal(t, err, errInvalidImage)
+}
+
+func TestProcessImageOrientation(t *testing.T) {
+	var buf bytes.Buffer
+	err := jpeg.Encode(&buf, image.NewGray(image.Rect(0, 0, 400, 200)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// insert an EXIF segment with orientation 6 right after the SOI marker
+	tiff := []byte{
+		'M', 'M', 0, 42, 0, 0, 0, 8, // header, IFD at offset 8
+		0, 1, // one entry
+		0x01, 0x12, 0, 3, 0, 0, 0, 1, 0, 6, 0, 0, // orientation, SHORT, 6
+		0, 0, 0, 0, // no next IFD
+	}
+	exif := append([]byte("Exif\x00\x00"), tiff...)
+	segment := append([]byte{0xFF, 0xE1, byte((len(exif) + 2) >> 8), byte(len(exif) + 2)}, exif...)
+	content := append(append([]byte{0xFF, 0xD8}, segment...), buf.Bytes()[2:]...)
+	assert.Equal(t, jpegOrientation(content), 6)
+
+	images, err := processImage(bytes.NewReader(content))
+	assert.Equal(t, err, nil)
+	for _, processed := range images {
+		assert.Equal(t, processed.extension, ".jpg")
+		// the EXIF segment is gone and the image is turned upright
+		assert.Equal(t, bytes.Contains(processed.content, []byte("Exif")), false)
+		config, _, err := image.DecodeConfig(bytes.NewReader(processed.content))
+		assert.Equal(t, err, nil)
+		assert.Equal(t, config.Height, 400)
+	}
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"cosmetcab.dp.ua/internal/data"
+	"cosmetcab.dp.ua/internal/validator"
+)
+
+const (
+	jobUploadBlob = "upload_blob"
+	jobDeleteBlob = "delete_blob"
+	// jobDeleteUpload deletes a blob from the upload storage
+	jobDeleteUpload = "delete_upload"
+)
+
+// jobLockTimeout is how long a job may stay running before it is
+// considered abandoned and handed to another worker
+const jobLockTimeout = 10 * time.Minute
+
+type blobJobPayload struct {
+	BlobName string `json:"blob_name"`
+}
+
+// enqueueJob stores a job of the given kind so that it is run by a worker
+func (app *application) enqueueJob(kind string, payload any, content []byte) (*data.Job, error) {
+	js, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	job := &data.Job{
+		Kind:        kind,
+		Payload:     js,
+		Data:        content,
+		MaxAttempts: app.config.jobs.maxAttempts,
+	}
+	err = app.models.Jobs.Enqueue(job)
+	if err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// runJob executes a claimed job
+func (app *application) runJob(job *data.Job) error {
+	switch job.Kind {
+	case jobUploadBlob:
+		var payload blobJobPayload
+		err := json.Unmarshal(job.Payload, &payload)
+		if err != nil {
+			return err
+		}
+		return app.blobStorage.UploadBlob(payload.BlobName, bytes.NewReader(job.Data))
+	case jobDeleteBlob:
+		var payload blobJobPayload
+		err := json.Unmarshal(job.Payload, &payload)
+		if err != nil {
+			return err
+		}
+		return app.blobStorage.DeleteBlob(payload.BlobName)
+	case jobDeleteUpload:
+		var payload blobJobPayload
+		err := json.Unmarshal(job.Payload, &payload)
+		if err != nil {
+			return err
+		}
+		return app.uploadStorage.DeleteBlob(payload.BlobName)
+	default:
+		return fmt.Errorf("unknown job kind %q", job.Kind)
+	}
+}
+
+// startWorkers starts the worker pool. Workers stop once ctx is cancelled
+// and finish the job they are running before the server exits.
+func (app *application) startWorkers(ctx context.Context) {
+	for i := 0; i < app.config.jobs.workers; i++ {
+		app.wg.Add(1)
+		go func() {
+			defer app.wg.Done()
+			ticker := time.NewTicker(app.config.jobs.pollInterval)
+			defer ticker.Stop()
+			for {
+				// process jobs until the queue is drained, then wait for the next tick
+				for ctx.Err() == nil && app.processNextJob() {
+				}
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+				}
+			}
+		}()
+	}
+}
+
+// processNextJob claims and runs a single job and reports whether one was found
+func (app *application) processNextJob() bool {
+	job, err := app.models.Jobs.Claim(jobLockTimeout)
+	if err != nil {
+		if !errors.Is(err, data.ErrRecordNotFound) {
+			app.logger.Error("Error claiming job", "err", err)
+		}
+		return false
+	}
+
+	jobErr := func() (err error) {
+		// a panicking job must not take the worker down
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("job panicked: %v", r)
+			}
+		}()
+		return app.runJob(job)
+	}()
+
+	if jobErr == nil {
+		err = app.models.Jobs.Complete(job.ID)
+		if err != nil {
+			app.logger.Error("Error completing job", "job_id", job.ID, "err", err)
+		}
+		return true
+	}
+
+	err = app.models.Jobs.Fail(job, jobErr)
+	if err != nil {
+		app.logger.Error("Error failing job", "job_id", job.ID, "err", err)
+		return true
+	}
+	if job.Status == data.JobDead {
+		app.logAndSendErr(fmt.Sprintf("job %s failed after %d attempts", job.Kind, job.Attempts), string(job.Payload), jobErr)
+	} else {
+		app.logger.Warn("job failed, will retry", "job_id", job.ID, "kind", job.Kind, "run_at", job.RunAt, "err", jobErr)
+	}
+	return true
+}
+
+func (app *application) listJobsHandler(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+	status := app.readString(qs, "status", "")
+	v := validator.New()
+	v.Check(status == "" || validator.PermittedValue(status, data.JobPending, data.JobRunning, data.JobDone, data.JobDead, data.JobCancelled), "status", "must be pending, running, done, dead or cancelled")
+	filters := app.readFilters(qs, "-id", []string{"id", "run_at", "updated_at", "-id", "-run_at", "-updated_at"}, v)
+	if data.ValidateFilters(v, filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	jobs, metadata, err := app.models.Jobs.GetAll(status, filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"jobs": jobs, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) showJobHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	job, err := app.models.Jobs.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"job": job}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) retryJobHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	job, err := app.models.Jobs.Retry(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.errorResponse(w, r, http.StatusNotFound, fmt.Sprintf("no dead job with id %d could be found", id))
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	app.audit(r, data.AuditUpdate, auditJob, job.ID, map[string]string{"status": data.JobDead}, map[string]string{"status": job.Status})
+	err = app.writeJSON(w, http.StatusAccepted, envelope{"job": job}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
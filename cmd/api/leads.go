@@ -0,0 +1,110 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"cosmetcab.dp.ua/internal/data"
+	"cosmetcab.dp.ua/internal/validator"
+)
+
+func (app *application) listLeadsHandler(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+	status := app.readString(qs, "status", "")
+	phone := app.readString(qs, "phone", "")
+
+	v := validator.New()
+	if status != "" {
+		data.ValidateLeadStatus(v, status)
+	}
+	filters := app.readFilters(qs, "-created_at", []string{"id", "created_at", "updated_at", "status", "-id", "-created_at", "-updated_at", "-status"}, v)
+	if data.ValidateFilters(v, filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	leads, metadata, err := app.models.Leads.GetAll(status, phone, filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"leads": leads, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) showLeadHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	lead, err := app.models.Leads.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"lead": lead}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) updateLeadHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	lead, err := app.models.Leads.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	before := snapshot(lead)
+	var input struct {
+		Status *string `json:"status"`
+		Note   *string `json:"note"`
+	}
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if input.Status != nil {
+		lead.Status = *input.Status
+	}
+	if input.Note != nil {
+		lead.Note = *input.Note
+	}
+	v := validator.New()
+	if data.ValidateLead(v, lead); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = app.models.Leads.Update(lead)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	app.audit(r, data.AuditUpdate, auditLead, lead.ID, before, lead)
+	err = app.writeJSON(w, http.StatusOK, envelope{"lead": lead}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"cosmetcab.dp.ua/internal/data"
+	"cosmetcab.dp.ua/internal/notifier"
+)
+
+// loginDelay is how long an account has to wait after its last failed
+// login. The first free failures cost nothing, after that the delay
+// doubles with every failure up to limit.
+func loginDelay(failures, free int, limit time.Duration) time.Duration {
+	if failures < free {
+		return 0
+	}
+	shift := failures - free
+	if shift > 30 {
+		return limit
+	}
+	delay := time.Second << shift
+	if delay > limit {
+		return limit
+	}
+	return delay
+}
+
+// loginFailureStore keeps the failed login counters. It is implemented by
+// data.LoginFailureModel and faked in the tests, which have no database.
+type loginFailureStore interface {
+	Get(kind, key string) (*data.LoginFailure, error)
+	RecordFailure(kind, key string, window time.Duration) (*data.LoginFailure, error)
+	Lock(failure *data.LoginFailure, until time.Time) error
+	Reset(kind, key string) error
+}
+
+// loginWait reports how long the counter blocks further login attempts.
+// Only account counters get progressive delays, so users behind a shared
+// IP are not slowed down by each other.
+func (app *application) loginWait(failure *data.LoginFailure, now time.Time) time.Duration {
+	if failure.LockedUntil.Valid && failure.LockedUntil.Time.After(now) {
+		return failure.LockedUntil.Time.Sub(now)
+	}
+	if failure.Kind != data.LoginFailureAccount {
+		return 0
+	}
+	delay := loginDelay(failure.Failures, app.config.login.freeAttempts, app.config.login.lockDuration)
+	return time.Until(failure.LastFailureAt.Add(delay))
+}
+
+// checkLoginThrottle rejects the attempt while the account or the client IP
+// is locked or has to wait after recent failures. It reports whether the
+// attempt may go ahead, otherwise the error response has already been sent.
+func (app *application) checkLoginThrottle(w http.ResponseWriter, r *http.Request, email string) bool {
+	keys := []struct{ kind, key string }{
+		{data.LoginFailureAccount, strings.ToLower(email)},
+		{data.LoginFailureIP, app.clientIP(r)},
+	}
+	var wait time.Duration
+	now := time.Now()
+	for _, k := range keys {
+		failure, err := app.loginFailures.Get(k.kind, k.key)
+		if err != nil {
+			if errors.Is(err, data.ErrRecordNotFound) {
+				continue
+			}
+			app.serverErrorResponse(w, r, err)
+			return false
+		}
+		if d := app.loginWait(failure, now); d > wait {
+			wait = d
+		}
+	}
+	if wait > 0 {
+		app.tooManyLoginAttemptsResponse(w, r, wait)
+		return false
+	}
+	return true
+}
+
+// recordLoginFailure counts a failed attempt for the account and the
+// client IP and locks them once their limit is reached
+func (app *application) recordLoginFailure(r *http.Request, email string) error {
+	email = strings.ToLower(email)
+	failure, err := app.loginFailures.RecordFailure(data.LoginFailureAccount, email, app.config.login.failureWindow)
+	if err != nil {
+		return err
+	}
+	if failure.Failures >= app.config.login.lockAfter {
+		err = app.lockLogin(failure)
+		if err != nil {
+			return err
+		}
+		app.notify(notifier.EventSecurity, "Account locked", fmt.Sprintf(
+			"Account %s was locked until %s after %d failed login attempts, last one from %s",
+			email, failure.LockedUntil.Time.In(app.location).Format(time.DateTime), app.config.login.lockAfter, app.clientIP(r)))
+	}
+
+	failure, err = app.loginFailures.RecordFailure(data.LoginFailureIP, app.clientIP(r), app.config.login.failureWindow)
+	if err != nil {
+		return err
+	}
+	if failure.Failures >= app.config.login.ipLockAfter {
+		err = app.lockLogin(failure)
+		if err != nil {
+			return err
+		}
+		app.notify(notifier.EventSecurity, "IP locked", fmt.Sprintf(
+			"Logins from %s were blocked until %s after %d failed attempts",
+			failure.Key, failure.LockedUntil.Time.In(app.location).Format(time.DateTime), app.config.login.ipLockAfter))
+	}
+	return nil
+}
+
+func (app *application) lockLogin(failure *data.LoginFailure) error {
+	err := app.loginFailures.Lock(failure, time.Now().Add(app.config.login.lockDuration))
+	if err != nil {
+		return err
+	}
+	app.logger.Warn("login locked", "kind", failure.Kind, "key", failure.Key, "until", failure.LockedUntil.Time)
+	return nil
+}
+
+// failedLoginResponse records the failed attempt and rejects the credentials
+func (app *application) failedLoginResponse(w http.ResponseWriter, r *http.Request, email string) {
+	err := app.recordLoginFailure(r, email)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	app.invalidCredentialsResponse(w, r)
+}
+
+// resetLoginFailures forgets the failures of an account after a successful login
+func (app *application) resetLoginFailures(email string) error {
+	return app.loginFailures.Reset(data.LoginFailureAccount, strings.ToLower(email))
+}
+
+// listLockoutsHandler returns the accounts and IPs that are locked or have
+// recent failed login attempts
+func (app *application) listLockoutsHandler(w http.ResponseWriter, r *http.Request) {
+	lockouts, err := app.models.LoginFailures.GetAll(app.config.login.failureWindow)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"lockouts": lockouts}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteLockoutHandler unlocks an account or IP and clears its failures
+func (app *application) deleteLockoutHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	lockout, err := app.models.LoginFailures.Delete(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	app.audit(r, data.AuditDelete, auditLockout, id, lockout, nil)
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "lockout successfully removed"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"database/sql"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"cosmetcab.dp.ua/internal/assert"
+	"cosmetcab.dp.ua/internal/data"
+)
+
+func TestLoginDelay(t *testing.T) {
+	assert.Equal(t, loginDelay(2, 3, time.Minute), time.Duration(0))
+	assert.Equal(t, loginDelay(3, 3, time.Minute), time.Second)
+	assert.Equal(t, loginDelay(5, 3, time.Minute), 4*time.Second)
+	assert.Equal(t, loginDelay(9, 3, time.Minute), time.Minute)
+	assert.Equal(t, loginDelay(100, 3, time.Minute), time.Minute)
+}
+
+// fakeLoginFailures keeps the counters in memory like data.LoginFailureModel
+type fakeLoginFailures map[string]*data.LoginFailure
+
+func (f fakeLoginFailures) Get(kind, key string) (*data.LoginFailure, error) {
+	failure, ok := f[kind+":"+key]
+	if !ok {
+		return nil, data.ErrRecordNotFound
+	}
+	return failure, nil
+}
+
+func (f fakeLoginFailures) RecordFailure(kind, key string, window time.Duration) (*data.LoginFailure, error) {
+	failure, ok := f[kind+":"+key]
+	if !ok {
+		failure = &data.LoginFailure{ID: int64(len(f) + 1), Kind: kind, Key: key}
+		f[kind+":"+key] = failure
+	}
+	failure.Failures++
+	failure.LastFailureAt = time.Now()
+	return failure, nil
+}
+
+func (f fakeLoginFailures) Lock(failure *data.LoginFailure, until time.Time) error {
+	failure.Failures = 0
+	failure.LockedUntil = sql.NullTime{Time: until, Valid: true}
+	return nil
+}
+
+func (f fakeLoginFailures) Reset(kind, key string) error {
+	delete(f, kind+":"+key)
+	return nil
+}
+
+func newLoginTestApplication() (*application, fakeLoginFailures) {
+	failures := fakeLoginFailures{}
+	app := &application{
+		logger:        slog.New(slog.NewTextHandler(io.Discard, nil)),
+		loginFailures: failures,
+		location:      time.UTC,
+	}
+	app.config.login.freeAttempts = 2
+	app.config.login.lockAfter = 5
+	app.config.login.ipLockAfter = 8
+	app.config.login.lockDuration = time.Hour
+	app.config.login.failureWindow = time.Hour
+	return app, failures
+}
+
+// TestCheckLoginThrottle tests that attempts wait after the free failures
+// and are rejected while the account or IP is locked
+func TestCheckLoginThrottle(t *testing.T) {
+	app, failures := newLoginTestApplication()
+	req := httptest.NewRequest(http.MethodPost, "/v1/users/login", nil)
+	check := func() int {
+		rec := httptest.NewRecorder()
+		if app.checkLoginThrottle(rec, req, "Olena@Example.com") {
+			return http.StatusOK
+		}
+		return rec.Code
+	}
+
+	assert.Equal(t, check(), http.StatusOK)
+	failures.RecordFailure(data.LoginFailureAccount, "olena@example.com", time.Hour)
+	assert.Equal(t, check(), http.StatusOK)
+	failures.RecordFailure(data.LoginFailureAccount, "olena@example.com", time.Hour)
+	// the third attempt right after two failures has to wait a second
+	assert.Equal(t, check(), http.StatusTooManyRequests)
+	failures["account:olena@example.com"].LastFailureAt = time.Now().Add(-2 * time.Second)
+	assert.Equal(t, check(), http.StatusOK)
+
+	// IP counters only matter once they are locked
+	ip, _ := failures.RecordFailure(data.LoginFailureIP, "192.0.2.1", time.Hour)
+	ip.Failures = 100
+	assert.Equal(t, check(), http.StatusOK)
+	failures.Lock(ip, time.Now().Add(time.Minute))
+	assert.Equal(t, check(), http.StatusTooManyRequests)
+}
+
+// TestRecordLoginFailure tests that the account and the IP are counted
+// separately and locked at their own limits
+func TestRecordLoginFailure(t *testing.T) {
+	app, failures := newLoginTestApplication()
+	req := httptest.NewRequest(http.MethodPost, "/v1/users/login", nil)
+
+	for i := 0; i < 4; i++ {
+		assert.Equal(t, app.recordLoginFailure(req, "Olena@Example.com"), nil)
+	}
+	account := failures["account:olena@example.com"]
+	assert.Equal(t, account.Failures, 4)
+	assert.Equal(t, account.LockedUntil.Valid, false)
+
+	assert.Equal(t, app.recordLoginFailure(req, "olena@example.com"), nil)
+	assert.Equal(t, account.Failures, 0)
+	assert.Equal(t, account.LockedUntil.Valid, true)
+	assert.Equal(t, failures["ip:192.0.2.1"].LockedUntil.Valid, false)
+
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, app.recordLoginFailure(req, "other@example.com"), nil)
+	}
+	assert.Equal(t, failures["ip:192.0.2.1"].LockedUntil.Valid, true)
+}
+
+func TestClientIP(t *testing.T) {
+	proxies, err := parseTrustedProxies("10.0.0.0/8, 192.0.2.10")
+	assert.Equal(t, err, nil)
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	// without a trusted proxy the header is ignored
+	req.RemoteAddr = "198.51.100.7:1234"
+	req.Header.Set("X-Forwarded-For", "203.0.113.5")
+	assert.Equal(t, proxies.clientIP(req), "198.51.100.7")
+
+	// the last untrusted address is the client, earlier ones may be forged
+	req.RemoteAddr = "10.1.2.3:1234"
+	req.Header.Set("X-Forwarded-For", "1.1.1.1, 203.0.113.5, 192.0.2.10")
+	assert.Equal(t, proxies.clientIP(req), "203.0.113.5")
+
+	req.Header.Del("X-Forwarded-For")
+	assert.Equal(t, proxies.clientIP(req), "10.1.2.3")
+
+	_, err = parseTrustedProxies("10.0.0.0/33")
+	assert.Equal(t, err != nil, true)
+}
@@ -3,26 +3,28 @@ package main
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"flag"
+	"fmt"
 	"log/slog"
+	"net/http"
+	"net/mail"
 	"os"
+	"strings"
 	"sync"
 	"time"
+	_ "time/tzdata"
 
+	"cosmetcab.dp.ua/internal/blobstore"
 	"cosmetcab.dp.ua/internal/data"
-	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"cosmetcab.dp.ua/internal/mailer"
+	"cosmetcab.dp.ua/internal/notifier"
+	"cosmetcab.dp.ua/internal/validator"
 	"github.com/gorilla/sessions"
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
 )
 
-var (
-	blobURL       = goDotEnvVariable("BLOB_URL")
-	containerName = goDotEnvVariable("CONTAINER_NAME")
-	botToken      = goDotEnvVariable("botToken")
-	chatID        = goDotEnvVariable("chatID")
-)
-
 type config struct {
 	port int
 	env  string
@@ -33,19 +35,77 @@ type config struct {
 		maxIdleTime  time.Duration
 	}
 	limiter struct {
-		rps     float64
-		burst   int
-		enabled bool
+		rps          float64
+		burst        int
+		enabled      bool
+		contactRPS   float64
+		contactBurst int
+	}
+	storage struct {
+		blobstore.Config
+		uploadTTL time.Duration
+	}
+	reconcile struct {
+		interval       time.Duration
+		deleteOrphans  bool
+		flagCategories bool
+	}
+	session struct {
+		idleTimeout time.Duration
+		lifetime    time.Duration
+	}
+	tokens struct {
+		authenticationTTL time.Duration
+	}
+	login struct {
+		freeAttempts  int
+		lockAfter     int
+		ipLockAfter   int
+		lockDuration  time.Duration
+		failureWindow time.Duration
+	}
+	timezone        string
+	defaultLanguage string
+	trustedProxies  trustedProxies
+	jobs            struct {
+		workers      int
+		pollInterval time.Duration
+		maxAttempts  int
+	}
+	notify struct {
+		routes   string
+		telegram struct {
+			baseURL string
+			token   string
+			chatID  string
+		}
+		smtp struct {
+			host       string
+			port       int
+			username   string
+			password   string
+			sender     string
+			recipients string
+		}
+		webhook struct {
+			url    string
+			secret string
+		}
 	}
 }
 
 type application struct {
-	config           config
-	logger           *slog.Logger
-	models           data.Models
-	azureBlobStorage *AzureBlobStorage
-	wg               sync.WaitGroup
-	sessionManager   *sessions.CookieStore
+	config         config
+	logger         *slog.Logger
+	models         data.Models
+	loginFailures  loginFailureStore
+	blobStorage    blobstore.BlobStore
+	uploadStorage  blobstore.BlobStore
+	wg             sync.WaitGroup
+	sessionManager sessions.Store
+	location       *time.Location
+	notifier       notifier.Notifier
+	mailer         mailer.Mailer
 }
 
 func goDotEnvVariable(key string) string {
@@ -67,17 +127,98 @@ func main() {
 	flag.Float64Var(&cfg.limiter.rps, "limiter-rps", 2, "Rate limiter maximum requests per second")
 	flag.IntVar(&cfg.limiter.burst, "limiter-burst", 4, "Rate limiter maximum burst")
 	flag.BoolVar(&cfg.limiter.enabled, "limiter-enabled", true, "Enable limiter")
+	flag.Float64Var(&cfg.limiter.contactRPS, "limiter-contact-rps", 1.0/60, "Rate limiter maximum requests per second for the contact form")
+	flag.IntVar(&cfg.limiter.contactBurst, "limiter-contact-burst", 3, "Rate limiter maximum burst for the contact form")
+
+	flag.StringVar(&cfg.storage.Backend, "storage", "azure", "Blob storage backend (azure|local)")
+	flag.StringVar(&cfg.storage.Dir, "storage-dir", "./ui/static/uploads", "Directory for the local blob storage backend")
+	flag.StringVar(&cfg.storage.UploadDir, "upload-storage-dir", "./uploads", "Directory pre-signed uploads are kept in until confirmed with the local blob storage backend, must not be served")
+	flag.DurationVar(&cfg.storage.uploadTTL, "upload-url-ttl", 15*time.Minute, "Lifetime of pre-signed upload URLs")
+	flag.StringVar(&cfg.storage.SigningSecret, "upload-signing-secret", goDotEnvVariable("UPLOAD_SIGNING_SECRET"), "Secret used to sign upload URLs of the local blob storage backend, random when empty")
+	flag.DurationVar(&cfg.reconcile.interval, "reconcile-interval", 0, "How often the blob storage is reconciled with the database, never when 0")
+	flag.BoolVar(&cfg.reconcile.deleteOrphans, "reconcile-delete-orphans", false, "Delete blobs no record refers to when reconciling")
+	flag.BoolVar(&cfg.reconcile.flagCategories, "reconcile-flag-categories", false, "Flag categories whose photo is missing when reconciling")
+
+	flag.IntVar(&cfg.jobs.workers, "jobs-workers", 2, "Number of background job workers")
+	flag.DurationVar(&cfg.jobs.pollInterval, "jobs-poll-interval", time.Second, "How often idle workers look for new jobs")
+	flag.IntVar(&cfg.jobs.maxAttempts, "jobs-max-attempts", 5, "Attempts before a background job is moved to the dead state")
+
+	flag.DurationVar(&cfg.session.idleTimeout, "session-idle-timeout", 30*time.Minute, "Session ends after this long without requests")
+	flag.DurationVar(&cfg.session.lifetime, "session-lifetime", 12*time.Hour, "Session ends this long after login regardless of activity")
+
+	flag.DurationVar(&cfg.tokens.authenticationTTL, "auth-token-ttl", 24*time.Hour, "Lifetime of bearer authentication tokens")
+
+	flag.IntVar(&cfg.login.freeAttempts, "login-free-attempts", 3, "Failed logins of an account before progressive delays start")
+	flag.IntVar(&cfg.login.lockAfter, "login-lock-after", 10, "Failed logins after which an account is locked")
+	flag.IntVar(&cfg.login.ipLockAfter, "login-ip-lock-after", 50, "Failed logins after which a client IP is locked")
+	flag.DurationVar(&cfg.login.lockDuration, "login-lock-duration", 15*time.Minute, "How long a locked account or IP can't log in")
+	flag.DurationVar(&cfg.login.failureWindow, "login-failure-window", time.Hour, "Failed logins older than this are forgotten")
+
+	flag.StringVar(&cfg.timezone, "timezone", "Europe/Kyiv", "Time zone of the salon used for schedules")
+	flag.StringVar(&cfg.defaultLanguage, "default-language", data.LanguageUkrainian, "Language the catalogue text is stored in (uk|en|ru)")
+
+	flag.StringVar(&cfg.notify.routes, "notify-routes", "error:telegram,lead:telegram,booking:telegram,security:telegram", "Notification routes as comma separated event:channel pairs (events: error|lead|booking|security, channels: telegram|email|webhook)")
+	flag.StringVar(&cfg.notify.telegram.baseURL, "telegram-base-url", "https://api.telegram.org", "Telegram Bot API base URL")
+	flag.StringVar(&cfg.notify.telegram.token, "telegram-token", goDotEnvVariable("botToken"), "Telegram bot token")
+	flag.StringVar(&cfg.notify.telegram.chatID, "telegram-chat-id", goDotEnvVariable("chatID"), "Telegram chat ID")
+	flag.StringVar(&cfg.notify.smtp.host, "smtp-host", "", "SMTP host for account emails and email notifications")
+	flag.IntVar(&cfg.notify.smtp.port, "smtp-port", 587, "SMTP port")
+	flag.StringVar(&cfg.notify.smtp.username, "smtp-username", goDotEnvVariable("SMTP_USERNAME"), "SMTP username")
+	flag.StringVar(&cfg.notify.smtp.password, "smtp-password", goDotEnvVariable("SMTP_PASSWORD"), "SMTP password")
+	flag.StringVar(&cfg.notify.smtp.sender, "smtp-sender", "LabBeauty <no-reply@cosmetcab.dp.ua>", "SMTP sender")
+	flag.StringVar(&cfg.notify.smtp.recipients, "notify-email-to", "", "Comma separated recipients of email notifications")
+	flag.StringVar(&cfg.notify.webhook.url, "webhook-url", "", "Webhook URL for notifications")
+	flag.StringVar(&cfg.notify.webhook.secret, "webhook-secret", goDotEnvVariable("WEBHOOK_SECRET"), "Secret used to sign webhook requests")
+	var proxies string
+	flag.StringVar(&proxies, "trusted-proxies", "", "Comma separated IPs or CIDR networks of reverse proxies trusted to set X-Forwarded-For")
+
 	flag.Parse()
 	ctx := context.Background()
 	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
 
-	credential, err := azidentity.NewDefaultAzureCredential(nil)
+	location, err := time.LoadLocation(cfg.timezone)
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+
+	cfg.trustedProxies, err = parseTrustedProxies(proxies)
+	if err != nil {
+		logger.Error(fmt.Sprintf("invalid trusted-proxies: %v", err))
+		os.Exit(1)
+	}
+
+	if !validator.PermittedValue(cfg.defaultLanguage, data.Languages...) {
+		logger.Error(fmt.Sprintf("unsupported default language %q", cfg.defaultLanguage))
+		os.Exit(1)
+	}
+
+	blobStorage, err := blobstore.Open(cfg.storage.Config, ctx)
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+	uploadStorage, err := blobstore.OpenUploads(cfg.storage.Config, ctx)
 	if err != nil {
 		logger.Error(err.Error())
 		os.Exit(1)
 	}
 
-	azureBlobStorage, err := NewAzureBlobStorage(blobURL, credential, ctx)
+	sender, err := mail.ParseAddress(cfg.notify.smtp.sender)
+	if err != nil {
+		logger.Error(fmt.Sprintf("invalid smtp-sender: %v", err))
+		os.Exit(1)
+	}
+	smtp := &mailer.SMTP{
+		Host:     cfg.notify.smtp.host,
+		Port:     cfg.notify.smtp.port,
+		Username: cfg.notify.smtp.username,
+		Password: cfg.notify.smtp.password,
+		Sender:   sender,
+		Attempts: 3,
+	}
+
+	notifications, err := openNotifier(cfg, smtp)
 	if err != nil {
 		logger.Error(err.Error())
 		os.Exit(1)
@@ -93,19 +234,18 @@ func main() {
 
 	logger.Info("DB connection pool established")
 
-	var store = sessions.NewCookieStore([]byte(goDotEnvVariable("TOKEN")))
-	store.Options = &sessions.Options{
-		Path:     "/",
-		MaxAge:   60 * 60,
-		HttpOnly: true,
-	}
-
+	models := data.NewModels(db)
 	app := &application{
-		config:           cfg,
-		logger:           logger,
-		models:           data.NewModels(db),
-		azureBlobStorage: azureBlobStorage,
-		sessionManager:   store,
+		config:         cfg,
+		logger:         logger,
+		models:         models,
+		loginFailures:  models.LoginFailures,
+		blobStorage:    blobStorage,
+		uploadStorage:  uploadStorage,
+		sessionManager: newDBSessionStore(models.Sessions, cfg.session.idleTimeout, cfg.session.lifetime, cfg.trustedProxies),
+		location:       location,
+		notifier:       notifications,
+		mailer:         mailer.New(smtp),
 	}
 	err = app.serve()
 	if err != nil {
@@ -133,3 +273,39 @@ func openDB(cfg config) (*sql.DB, error) {
 	}
 	return db, nil
 }
+
+func openNotifier(cfg config, smtp *mailer.SMTP) (*notifier.Router, error) {
+	client := &http.Client{Timeout: 10 * time.Second}
+	channels := map[string]notifier.Notifier{
+		"telegram": &notifier.Telegram{
+			BaseURL:  cfg.notify.telegram.baseURL,
+			Token:    cfg.notify.telegram.token,
+			ChatID:   cfg.notify.telegram.chatID,
+			Attempts: 3,
+			Client:   client,
+		},
+	}
+	if cfg.notify.smtp.host != "" {
+		if cfg.notify.smtp.recipients == "" {
+			return nil, errors.New("notify-email-to must be set to send email notifications")
+		}
+		channels["email"] = &notifier.Email{
+			SMTP:       smtp,
+			Recipients: strings.Split(cfg.notify.smtp.recipients, ","),
+		}
+	}
+	if cfg.notify.webhook.url != "" {
+		channels["webhook"] = &notifier.Webhook{
+			URL:      cfg.notify.webhook.url,
+			Secret:   cfg.notify.webhook.secret,
+			Attempts: 3,
+			Client:   client,
+		}
+	}
+	router := notifier.NewRouter()
+	err := router.ParseRoutes(cfg.notify.routes, channels)
+	if err != nil {
+		return nil, err
+	}
+	return router, nil
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"cosmetcab.dp.ua/internal/data"
+	"cosmetcab.dp.ua/internal/validator"
+)
+
+// mediaOwnerExists returns ErrRecordNotFound when there is no owner of
+// the type with the id
+func (app *application) mediaOwnerExists(ownerType string, id int64) error {
+	var err error
+	switch ownerType {
+	case data.MediaCategory:
+		_, err = app.models.Categories.Get(id)
+	case data.MediaService:
+		_, err = app.models.Services.Get(id)
+	case data.MediaStaff:
+		_, err = app.models.Staff.Get(id)
+	}
+	return err
+}
+
+// readMediaOwner reads the owner id from the URL and checks the owner
+// exists. It responds itself and returns false when it doesn't.
+func (app *application) readMediaOwner(w http.ResponseWriter, r *http.Request, ownerType string) (int64, bool) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return 0, false
+	}
+	err = app.mediaOwnerExists(ownerType, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return 0, false
+	}
+	return id, true
+}
+
+// deleteGallery queues deletion of the blobs of media whose rows were
+// removed together with their owner
+func (app *application) deleteGallery(gallery []*data.Media) {
+	for _, media := range gallery {
+		app.deletePhotos(media.URL, media.Variants)
+	}
+}
+
+// uploadMediaHandler returns a handler adding a photo to the gallery of
+// an owner of the given type. The photo goes through the same processing
+// as category photos.
+func (app *application) uploadMediaHandler(ownerType string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ownerID, ok := app.readMediaOwner(w, r, ownerType)
+		if !ok {
+			return
+		}
+		err := r.ParseMultipartForm(10 << 20) // max size 10MB
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+		photo, err := app.readPhoto(r)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+		defer photo.Close()
+
+		media := &data.Media{
+			OwnerType: ownerType,
+			OwnerID:   ownerID,
+			AltText:   r.FormValue("alt_text"),
+			Caption:   r.FormValue("caption"),
+		}
+		v := validator.New()
+		if data.ValidateMedia(v, media); !v.Valid() {
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+		gallery, err := app.models.Media.GetAll(ownerType, ownerID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		if len(gallery) >= data.MaxMediaPerOwner {
+			v.AddError("photo", fmt.Sprintf("the gallery can't hold more than %d photos", data.MaxMediaPerOwner))
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+		variants, err := app.processPhoto(photo)
+		if err != nil {
+			switch {
+			case errors.Is(err, errInvalidImage):
+				v.AddError("photo", invalidImageMessage)
+				app.failedValidationResponse(w, r, v.Errors)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+		media.Variants = app.photoVariantURLs(variants)
+		media.URL = media.Variants["hero"]
+		err = app.uploadPhotoVariants(variants)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		err = app.models.Media.Insert(media)
+		if err != nil {
+			app.discardPhotoVariants(variants)
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		app.audit(r, data.AuditCreate, auditMedia, media.ID, nil, media)
+		err = app.writeJSON(w, http.StatusCreated, envelope{"media": media}, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+	}
+}
+
+// updateMediaHandler returns a handler changing the alt text and caption
+// of a photo in the gallery of an owner of the given type
+func (app *application) updateMediaHandler(ownerType string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ownerID, ok := app.readMediaOwner(w, r, ownerType)
+		if !ok {
+			return
+		}
+		mediaID, err := app.readInt64Param(r, "media_id")
+		if err != nil {
+			app.notFoundResponse(w, r)
+			return
+		}
+		media, err := app.models.Media.Get(ownerType, ownerID, mediaID)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				app.notFoundResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+		before := snapshot(media)
+		var input struct {
+			AltText *string `json:"alt_text"`
+			Caption *string `json:"caption"`
+		}
+		err = app.readJSON(w, r, &input)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+		if input.AltText != nil {
+			media.AltText = *input.AltText
+		}
+		if input.Caption != nil {
+			media.Caption = *input.Caption
+		}
+		v := validator.New()
+		if data.ValidateMedia(v, media); !v.Valid() {
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+		err = app.models.Media.Update(media)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		app.audit(r, data.AuditUpdate, auditMedia, media.ID, before, media)
+		err = app.writeJSON(w, http.StatusOK, envelope{"media": media}, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+	}
+}
+
+// reorderMediaHandler returns a handler putting the gallery of an owner
+// of the given type in the order of the media ids sent
+func (app *application) reorderMediaHandler(ownerType string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ownerID, ok := app.readMediaOwner(w, r, ownerType)
+		if !ok {
+			return
+		}
+		var input struct {
+			Order []int64 `json:"order"`
+		}
+		err := app.readJSON(w, r, &input)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+		v := validator.New()
+		before, err := app.models.Media.GetAll(ownerType, ownerID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		err = app.models.Media.Reorder(ownerType, ownerID, input.Order)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrInvalidMediaOrder):
+				v.AddError("order", "must list every photo of the gallery once")
+				app.failedValidationResponse(w, r, v.Errors)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+		gallery, err := app.models.Media.GetAll(ownerType, ownerID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		// the order is recorded under the owner of the gallery
+		app.audit(r, data.AuditUpdate, auditMedia, ownerID, before, gallery)
+		err = app.writeJSON(w, http.StatusOK, envelope{"gallery": gallery}, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+	}
+}
+
+// deleteMediaHandler returns a handler removing a photo from the gallery
+// of an owner of the given type
+func (app *application) deleteMediaHandler(ownerType string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ownerID, ok := app.readMediaOwner(w, r, ownerType)
+		if !ok {
+			return
+		}
+		mediaID, err := app.readInt64Param(r, "media_id")
+		if err != nil {
+			app.notFoundResponse(w, r)
+			return
+		}
+		media, err := app.models.Media.Delete(ownerType, ownerID, mediaID)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				app.notFoundResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+		app.audit(r, data.AuditDelete, auditMedia, media.ID, media, nil)
+		app.deletePhotos(media.URL, media.Variants)
+		err = app.writeJSON(w, http.StatusOK, envelope{"message": "photo successfully deleted"}, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+	}
+}
@@ -1,12 +1,16 @@
 package main
 
 import (
+	"errors"
 	"fmt"
-	"net"
 	"net/http"
+	"regexp"
+	"strings"
 	"sync"
 	"time"
 
+	"cosmetcab.dp.ua/internal/data"
+	"cosmetcab.dp.ua/internal/validator"
 	"golang.org/x/time/rate"
 )
 
@@ -22,6 +26,28 @@ func (app *application) secureHeaders(next http.Handler) http.Handler {
 
 }
 
+// requestIDRX matches request IDs accepted from clients and proxies
+var requestIDRX = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// requestID tags every request with an ID that is returned in the
+// X-Request-ID header and logged with errors and audit entries. An ID set
+// by a proxy in front of the API is kept.
+func (app *application) requestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get("X-Request-ID")
+		if !requestIDRX.MatchString(requestID) {
+			var err error
+			requestID, err = data.RandomString(16)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+		}
+		w.Header().Set("X-Request-ID", requestID)
+		next.ServeHTTP(w, app.contextSetRequestID(r, requestID))
+	})
+}
+
 func (app *application) recoverPanic(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		defer func() {
@@ -36,6 +62,16 @@ func (app *application) recoverPanic(next http.Handler) http.Handler {
 }
 
 func (app *application) rateLimit(next http.Handler) http.Handler {
+	return app.limitClients(next, app.config.limiter.rps, app.config.limiter.burst)
+}
+
+// contactRateLimit applies the stricter limits configured for the contact form
+func (app *application) contactRateLimit(next http.Handler) http.Handler {
+	return app.limitClients(next, app.config.limiter.contactRPS, app.config.limiter.contactBurst)
+}
+
+// limitClients limits every client IP to rps requests per second with the given burst
+func (app *application) limitClients(next http.Handler, rps float64, burst int) http.Handler {
 	type client struct {
 		limiter  *rate.Limiter
 		lastseen time.Time
@@ -61,15 +97,12 @@ func (app *application) rateLimit(next http.Handler) http.Handler {
 
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if app.config.limiter.enabled {
-			ip, _, err := net.SplitHostPort(r.RemoteAddr)
-			if err != nil {
-				app.serverErrorResponse(w, r, err)
-			}
+			ip := app.clientIP(r)
 			mu.Lock()
 
 			if _, found := clients[ip]; !found {
 				clients[ip] = &client{
-					limiter: rate.NewLimiter(rate.Limit(app.config.limiter.rps), app.config.limiter.burst),
+					limiter: rate.NewLimiter(rate.Limit(rps), burst),
 				}
 			}
 			clients[ip].lastseen = time.Now()
@@ -85,18 +118,83 @@ func (app *application) rateLimit(next http.Handler) http.Handler {
 
 }
 
+// checkAuth authenticates the request with a bearer token from the
+// Authorization header or, when there is none, with the session cookie
 func (app *application) checkAuth(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		session, err := app.sessionManager.Get(r, "cookie-auth")
+		w.Header().Add("Vary", "Authorization")
+		authorizationHeader := r.Header.Get("Authorization")
+		if authorizationHeader != "" {
+			headerParts := strings.Split(authorizationHeader, " ")
+			if len(headerParts) != 2 || headerParts[0] != "Bearer" {
+				app.invalidAuthenticationTokenResponse(w, r)
+				return
+			}
+			token := headerParts[1]
+			v := validator.New()
+			if data.ValidateTokenPlaintext(v, token); !v.Valid() {
+				app.invalidAuthenticationTokenResponse(w, r)
+				return
+			}
+			userID, err := app.models.Tokens.GetUserIDForToken(data.ScopeAuthentication, token)
+			if err != nil {
+				switch {
+				case errors.Is(err, data.ErrRecordNotFound):
+					app.invalidAuthenticationTokenResponse(w, r)
+				default:
+					app.serverErrorResponse(w, r, err)
+				}
+				return
+			}
+			next.ServeHTTP(w, app.contextSetUserID(r, userID))
+			return
+		}
+
+		session, err := app.sessionManager.Get(r, sessionCookieName)
 		if err != nil {
 			app.serverErrorResponse(w, r, err)
 			return
 		}
-		if session.Values["authenticated"] == nil || session.Values["authenticated"] == false {
+		userID, ok := session.Values["user_id"].(int64)
+		if !ok {
 			app.unauthorizedUserResponse(w, r)
 			return
 		}
-		next.ServeHTTP(w, r)
+		next.ServeHTTP(w, app.contextSetUserID(r, userID))
 
 	})
 }
+
+// requirePermission allows the request only if the role of the
+// authenticated user grants the permission. Owners and admins must also
+// have two-factor authentication enabled. It must follow checkAuth.
+func (app *application) requirePermission(code string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, err := app.models.Users.Get(app.contextGetUserID(r))
+			if err != nil {
+				switch {
+				case errors.Is(err, data.ErrRecordNotFound):
+					app.unauthorizedUserResponse(w, r)
+				default:
+					app.serverErrorResponse(w, r, err)
+				}
+				return
+			}
+			if user.TwoFactorRequired() && !user.TOTPEnabled {
+				app.twoFactorRequiredResponse(w, r)
+				return
+			}
+			permissions, err := app.models.Permissions.GetAllForUser(user.ID)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+			if !permissions.Include(code) {
+				app.notPermittedResponse(w, r)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"cosmetcab.dp.ua/internal/data"
+	"cosmetcab.dp.ua/internal/validator"
+)
+
+// readPackageForm copies the fields present in the multipart form into
+// the package. Services are sent as a JSON array in the "services" field,
+// e.g. [{"service_id": 3, "quantity": 5}].
+func (app *application) readPackageForm(r *http.Request, pkg *data.Package, v *validator.Validator) {
+	if title := r.FormValue("title"); title != "" {
+		pkg.Title = title
+	}
+	if description := r.FormValue("description"); description != "" {
+		pkg.Description = description
+	}
+	if s := r.FormValue("price"); s != "" {
+		price, err := strconv.Atoi(s)
+		if err != nil {
+			v.AddError("price", "must be an integer value")
+		}
+		pkg.Price = price
+	}
+	if s := r.FormValue("category_id"); s != "" {
+		categoryID, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			v.AddError("category_id", "must be an integer value")
+		}
+		pkg.CategoryID = categoryID
+	}
+	if s := r.FormValue("services"); s != "" {
+		var services []*data.PackageItem
+		err := json.Unmarshal([]byte(s), &services)
+		if err != nil {
+			v.AddError("services", "must be a JSON array of service ids and quantities")
+		}
+		pkg.Services = services
+	}
+}
+
+// checkPackageReferences reports through the validator when the category
+// or any of the services of the package don't exist
+func (app *application) checkPackageReferences(pkg *data.Package, v *validator.Validator) error {
+	_, err := app.models.Categories.Get(pkg.CategoryID)
+	if err != nil {
+		if !errors.Is(err, data.ErrRecordNotFound) {
+			return err
+		}
+		v.AddError("category_id", "no category with this id exists")
+	}
+	for _, item := range pkg.Services {
+		_, err = app.models.Services.Get(item.ServiceID)
+		if err != nil {
+			if !errors.Is(err, data.ErrRecordNotFound) {
+				return err
+			}
+			v.AddError("services", fmt.Sprintf("service %d does not exist", item.ServiceID))
+			return nil
+		}
+	}
+	return nil
+}
+
+func (app *application) createPackageHandler(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseMultipartForm(10 << 20) // max size 10MB
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	photo, err := app.readPhoto(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	defer photo.Close()
+
+	pkg := &data.Package{PhotoURL: app.blobStorage.BlobURL(photo.fileName)}
+	v := validator.New()
+	app.readPackageForm(r, pkg, v)
+	if data.ValidatePackage(pkg, v); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = app.checkPackageReferences(pkg, v)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = app.uploadPhoto(photo)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.models.Packages.Insert(pkg)
+	if err != nil {
+		app.discardPhoto(photo)
+		app.dbErrorResponse(w, r, err)
+		return
+	}
+	app.audit(r, data.AuditCreate, auditPackage, pkg.ID, nil, pkg)
+	// reload to return the services with their descriptions and prices
+	pkg, err = app.models.Packages.Get(pkg.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/packages/%d", pkg.ID))
+
+	err = app.writeJSON(w, http.StatusAccepted, envelope{"package": pkg}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) showPackageHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	pkg, err := app.models.Packages.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"package": pkg}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listPackagesHandler(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+	v := validator.New()
+	categoryID := app.readInt64(qs, "category_id", 0, v)
+	filters := app.readFilters(qs, "id", []string{"id", "title", "price", "-id", "-title", "-price"}, v)
+	if data.ValidateFilters(v, filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	packages, metadata, err := app.models.Packages.GetAll(categoryID, filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"packages": packages, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) updatePackageHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	pkg, err := app.models.Packages.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	before := snapshot(pkg)
+	err = r.ParseMultipartForm(10 << 20) // max size 10MB
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	app.readPackageForm(r, pkg, v)
+	if data.ValidatePackage(pkg, v); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = app.checkPackageReferences(pkg, v)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	var oldPhotoURL string
+	photo, err := app.readPhoto(r)
+	if nil == err {
+		defer photo.Close()
+		err = app.uploadPhoto(photo)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		oldPhotoURL = pkg.PhotoURL
+		pkg.PhotoURL = app.blobStorage.BlobURL(photo.fileName)
+	} else if !errors.Is(err, http.ErrMissingFile) {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	err = app.models.Packages.Update(pkg)
+	if err != nil {
+		if photo != nil {
+			app.discardPhoto(photo)
+		}
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	// the old image is deleted only once the new one is saved
+	if oldPhotoURL != "" {
+		app.deletePhoto(oldPhotoURL)
+	}
+	pkg, err = app.models.Packages.Get(pkg.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	app.audit(r, data.AuditUpdate, auditPackage, pkg.ID, before, pkg)
+	err = app.writeJSON(w, http.StatusAccepted, envelope{"package": pkg}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deletePackageHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	pkg, err := app.models.Packages.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	photoURL, err := app.models.Packages.Delete(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	app.audit(r, data.AuditDelete, auditPackage, id, pkg, nil)
+	app.deletePhoto(photoURL)
+	err = app.writeJSON(w, http.StatusAccepted, envelope{"message": "package successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"io"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"cosmetcab.dp.ua/internal/blobstore"
+	"cosmetcab.dp.ua/internal/data"
+)
+
+// photoUpload holds a photo received in a multipart form together
+// with the unique blob name it will be stored under.
+type photoUpload struct {
+	file     multipart.File
+	header   *multipart.FileHeader
+	fileName string
+	jobID    int64
+}
+
+// readPhoto retrieves the file from the parsed multipart form.
+// The 'photo' key corresponds to the 'name' attribute
+// of the file input field in the form
+func (app *application) readPhoto(r *http.Request) (*photoUpload, error) {
+	file, header, err := r.FormFile("photo")
+	if err != nil {
+		return nil, err
+	}
+	fileName, err := generateUniqueImageName(header.Filename)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &photoUpload{file: file, header: header, fileName: fileName}, nil
+}
+
+func (p *photoUpload) Close() error {
+	return p.file.Close()
+}
+
+// uploadPhoto queues the photo for upload to the blob storage. The content
+// is stored with the job, so the upload survives restarts and is retried
+// by the workers until it succeeds. The photo is read whole for that;
+// clients avoid it with pre-signed uploads, see createUploadHandler.
+func (app *application) uploadPhoto(p *photoUpload) error {
+	content, err := io.ReadAll(p.file)
+	if err != nil {
+		return err
+	}
+	job, err := app.enqueueJob(jobUploadBlob, blobJobPayload{BlobName: p.fileName}, content)
+	if err != nil {
+		return err
+	}
+	p.jobID = job.ID
+	return nil
+}
+
+// discardPhoto removes a photo queued by uploadPhoto. It is used when
+// saving the owning record fails. If the upload has not started yet it is
+// simply cancelled, otherwise the uploaded blob is queued for deletion.
+func (app *application) discardPhoto(p *photoUpload) {
+	app.discardBlob(p.jobID, p.fileName)
+}
+
+func (app *application) discardBlob(jobID int64, blobName string) {
+	cancelled, err := app.models.Jobs.Cancel(jobID)
+	if err != nil {
+		app.logAndSendErr("image upload was not cancelled", blobName, err)
+		return
+	}
+	if !cancelled {
+		app.deleteBlob(blobName)
+	}
+}
+
+// photoVariant is a resized version of an uploaded photo
+type photoVariant struct {
+	*processedImage
+	blobName string
+	jobID    int64
+}
+
+// processPhoto resizes the photo into its variants, see processImage.
+// errInvalidImage is returned when the content isn't an image.
+func (app *application) processPhoto(p *photoUpload) ([]*photoVariant, error) {
+	images, err := processImage(p.file)
+	if err != nil {
+		return nil, err
+	}
+	return newPhotoVariants(p.fileName, images), nil
+}
+
+// newPhotoVariants names the variants after the unique name of the upload
+func newPhotoVariants(fileName string, images []*processedImage) []*photoVariant {
+	base := strings.TrimSuffix(fileName, filepath.Ext(fileName))
+	variants := make([]*photoVariant, len(images))
+	for i, img := range images {
+		variants[i] = &photoVariant{processedImage: img, blobName: base + "-" + img.variant + img.extension}
+	}
+	return variants
+}
+
+// uploadPhotoVariants queues the upload of every variant like uploadPhoto
+func (app *application) uploadPhotoVariants(variants []*photoVariant) error {
+	for i, variant := range variants {
+		job, err := app.enqueueJob(jobUploadBlob, blobJobPayload{BlobName: variant.blobName}, variant.content)
+		if err != nil {
+			app.discardPhotoVariants(variants[:i])
+			return err
+		}
+		variant.jobID = job.ID
+	}
+	return nil
+}
+
+// discardPhotoVariants removes variants queued by uploadPhotoVariants
+func (app *application) discardPhotoVariants(variants []*photoVariant) {
+	for _, variant := range variants {
+		app.discardBlob(variant.jobID, variant.blobName)
+	}
+}
+
+// photoVariantURLs returns the URL of each variant by variant name
+func (app *application) photoVariantURLs(variants []*photoVariant) data.PhotoVariants {
+	photos := make(data.PhotoVariants, len(variants))
+	for _, variant := range variants {
+		photos[variant.variant] = app.blobStorage.BlobURL(variant.blobName)
+	}
+	return photos
+}
+
+// deletePhotos queues deletion of a stored photo and its variants. The
+// photo URL usually is one of the variants and is deleted only once.
+func (app *application) deletePhotos(photoURL string, photos data.PhotoVariants) {
+	deleted := false
+	for _, url := range photos {
+		app.deletePhoto(url)
+		deleted = deleted || url == photoURL
+	}
+	if !deleted && photoURL != "" {
+		app.deletePhoto(photoURL)
+	}
+}
+
+// deletePhoto queues deletion of the blob behind a stored photo URL
+func (app *application) deletePhoto(photoURL string) {
+	app.deleteBlob(blobstore.BlobNameFromURL(photoURL))
+}
+
+func (app *application) deleteBlob(blobName string) {
+	_, err := app.enqueueJob(jobDeleteBlob, blobJobPayload{BlobName: blobName}, nil)
+	if err != nil {
+		app.logAndSendErr("image deletion was not queued", blobName, err)
+	}
+}
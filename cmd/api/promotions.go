@@ -0,0 +1,353 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"cosmetcab.dp.ua/internal/data"
+	"cosmetcab.dp.ua/internal/validator"
+	"github.com/julienschmidt/httprouter"
+)
+
+// discountServices sets the discounted price of the services from the
+// promotions running right now
+func (app *application) discountServices(services ...*data.Service) error {
+	promotions, err := app.models.Promotions.GetRunning()
+	if err != nil {
+		return err
+	}
+	for _, service := range services {
+		promotions.ApplyToService(service)
+	}
+	return nil
+}
+
+// checkPromotionScope reports through the validator when the service,
+// subcategory or category the promotion is for doesn't exist
+func (app *application) checkPromotionScope(promotion *data.Promotion, v *validator.Validator) error {
+	var err error
+	switch promotion.Scope {
+	case data.PromotionScopeService:
+		_, err = app.models.Services.Get(promotion.ScopeID)
+	case data.PromotionScopeSubCategory:
+		_, err = app.models.SubCategories.Get(promotion.ScopeID)
+	case data.PromotionScopeCategory:
+		_, err = app.models.Categories.Get(promotion.ScopeID)
+	default:
+		return nil
+	}
+	if errors.Is(err, data.ErrRecordNotFound) {
+		v.AddError("scope_id", fmt.Sprintf("no %s with this id exists", promotion.Scope))
+		return nil
+	}
+	return err
+}
+
+func (app *application) createPromotionHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Title    string    `json:"title"`
+		Kind     string    `json:"kind"`
+		Value    int       `json:"value"`
+		Scope    string    `json:"scope"`
+		ScopeID  int64     `json:"scope_id"`
+		StartsAt time.Time `json:"starts_at"`
+		EndsAt   time.Time `json:"ends_at"`
+		Code     string    `json:"code"`
+		MaxUses  int       `json:"max_uses"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	promotion := &data.Promotion{
+		Title:    input.Title,
+		Kind:     input.Kind,
+		Value:    input.Value,
+		Scope:    input.Scope,
+		ScopeID:  input.ScopeID,
+		StartsAt: input.StartsAt,
+		EndsAt:   input.EndsAt,
+		Code:     input.Code,
+		MaxUses:  input.MaxUses,
+	}
+	v := validator.New()
+	if data.ValidatePromotion(v, promotion); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = app.checkPromotionScope(promotion, v)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = app.models.Promotions.Insert(promotion)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicatePromoCode):
+			v.AddError("code", "a promotion with this code already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	app.audit(r, data.AuditCreate, auditPromotion, promotion.ID, nil, promotion)
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/promotions/%d", promotion.ID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"promotion": promotion}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) showPromotionHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	promotion, err := app.models.Promotions.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"promotion": promotion}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listPromotionsHandler returns all promotions, or only the running ones
+// with ?active=true
+func (app *application) listPromotionsHandler(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+	v := validator.New()
+	active := app.readString(qs, "active", "false")
+	v.Check(validator.PermittedValue(active, "true", "false"), "active", "must be true or false")
+	filters := app.readFilters(qs, "-starts_at", []string{"id", "starts_at", "ends_at", "-id", "-starts_at", "-ends_at"}, v)
+	if data.ValidateFilters(v, filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	promotions, metadata, err := app.models.Promotions.GetAll(active == "true", filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"promotions": promotions, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) updatePromotionHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	promotion, err := app.models.Promotions.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	before := snapshot(promotion)
+	var input struct {
+		Title    *string    `json:"title"`
+		Kind     *string    `json:"kind"`
+		Value    *int       `json:"value"`
+		Scope    *string    `json:"scope"`
+		ScopeID  *int64     `json:"scope_id"`
+		StartsAt *time.Time `json:"starts_at"`
+		EndsAt   *time.Time `json:"ends_at"`
+		Code     *string    `json:"code"`
+		MaxUses  *int       `json:"max_uses"`
+		Version  *int       `json:"version"`
+	}
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if input.Version != nil && *input.Version != promotion.Version {
+		app.editConflictResponse(w, r)
+		return
+	}
+	if input.Title != nil {
+		promotion.Title = *input.Title
+	}
+	if input.Kind != nil {
+		promotion.Kind = *input.Kind
+	}
+	if input.Value != nil {
+		promotion.Value = *input.Value
+	}
+	if input.Scope != nil {
+		promotion.Scope = *input.Scope
+	}
+	if input.ScopeID != nil {
+		promotion.ScopeID = *input.ScopeID
+	}
+	if input.StartsAt != nil {
+		promotion.StartsAt = *input.StartsAt
+	}
+	if input.EndsAt != nil {
+		promotion.EndsAt = *input.EndsAt
+	}
+	if input.Code != nil {
+		promotion.Code = *input.Code
+	}
+	if input.MaxUses != nil {
+		promotion.MaxUses = *input.MaxUses
+	}
+	v := validator.New()
+	if data.ValidatePromotion(v, promotion); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	if input.Scope != nil || input.ScopeID != nil {
+		err = app.checkPromotionScope(promotion, v)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		if !v.Valid() {
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+	}
+	err = app.models.Promotions.Update(promotion)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		case errors.Is(err, data.ErrDuplicatePromoCode):
+			v.AddError("code", "a promotion with this code already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	app.audit(r, data.AuditUpdate, auditPromotion, promotion.ID, before, promotion)
+	err = app.writeJSON(w, http.StatusOK, envelope{"promotion": promotion}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deletePromotionHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	promotion, err := app.models.Promotions.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.models.Promotions.Delete(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	app.audit(r, data.AuditDelete, auditPromotion, id, promotion, nil)
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "promotion successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// checkPromoCodeHandler lets clients see what a promo code gives them
+// before booking. Only the discount is shown, not the usage counters.
+func (app *application) checkPromoCodeHandler(w http.ResponseWriter, r *http.Request) {
+	code := httprouter.ParamsFromContext(r.Context()).ByName("code")
+	v := validator.New()
+	serviceID := app.readInt64(r.URL.Query(), "service_id", 0, v)
+	v.Check(serviceID > 0, "service_id", "must be provided")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	service, err := app.models.Services.Get(serviceID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundWithIDResponse(w, r, serviceID)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	promotion, err := app.promotionForCode(code, service, v)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{
+		"promotion": envelope{
+			"title":   promotion.Title,
+			"kind":    promotion.Kind,
+			"value":   promotion.Value,
+			"ends_at": promotion.EndsAt,
+		},
+		"price":            service.Price,
+		"discounted_price": promotion.Apply(service.Price),
+	}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// promotionForCode returns the running promotion with the code when it
+// covers the service. Codes that don't are reported through the validator.
+func (app *application) promotionForCode(code string, service *data.Service, v *validator.Validator) (*data.Promotion, error) {
+	promotion, err := app.models.Promotions.GetActiveByCode(code)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("promo_code", "invalid or expired promo code")
+			return nil, nil
+		default:
+			return nil, err
+		}
+	}
+	if !promotion.Matches(service.ID, service.SubCategoryID, service.CategoryID) {
+		v.AddError("promo_code", "does not apply to this service")
+		return nil, nil
+	}
+	return promotion, nil
+}
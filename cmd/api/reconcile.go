@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"cosmetcab.dp.ua/internal/reconcile"
+)
+
+// startReconciler periodically reconciles the blob storage with the photo
+// URLs in the database when an interval is configured. It does the same
+// as the reconcile command.
+func (app *application) startReconciler(ctx context.Context) {
+	if app.config.reconcile.interval <= 0 {
+		return
+	}
+	app.wg.Add(1)
+	go func() {
+		defer app.wg.Done()
+		ticker := time.NewTicker(app.config.reconcile.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				app.reconcileBlobs()
+			}
+		}
+	}()
+}
+
+func (app *application) reconcileBlobs() {
+	report, err := reconcile.Run(app.blobStorage, app.models, reconcile.Options{
+		DeleteOrphans:  app.config.reconcile.deleteOrphans,
+		FlagCategories: app.config.reconcile.flagCategories,
+		MinAge:         reconcile.DefaultMinAge,
+	})
+	if err != nil {
+		app.logger.Error("Error reconciling the blob storage", "err", err)
+	}
+	if report == nil {
+		return
+	}
+	if len(report.Orphaned) > 0 || len(report.Missing) > 0 {
+		app.logger.Warn("blob storage is out of sync",
+			"orphaned", len(report.Orphaned),
+			"missing", len(report.Missing),
+			"deleted", len(report.Deleted),
+			"broken_categories", report.BrokenCategories)
+	}
+}
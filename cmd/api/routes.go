@@ -3,6 +3,8 @@ package main
 import (
 	"net/http"
 
+	"cosmetcab.dp.ua/internal/blobstore"
+	"cosmetcab.dp.ua/internal/data"
 	"github.com/julienschmidt/httprouter"
 	"github.com/justinas/alice"
 )
@@ -11,36 +13,144 @@ func (app *application) routes() http.Handler {
 	router := httprouter.New()
 	router.NotFound = http.HandlerFunc(app.notFoundResponse)
 	router.MethodNotAllowed = http.HandlerFunc(app.notAllowedResponse)
-	fileServer := http.FileServer(http.Dir("./ui/static"))
+	fileServer := http.FileServer(http.Dir(blobstore.StaticDir))
 	authorizedChain := alice.New(app.recoverPanic, app.rateLimit, app.secureHeaders, app.checkAuth)
 	stdChain := alice.New(app.recoverPanic, app.rateLimit, app.secureHeaders)
+	contactChain := alice.New(app.recoverPanic, app.contactRateLimit, app.secureHeaders)
+	// permitted extends authorizedChain with a check of the given permission
+	permitted := func(code string) alice.Chain {
+		return authorizedChain.Append(app.requirePermission(code))
+	}
 	router.Handler(http.MethodGet, "/static/*filepath", http.StripPrefix("/static", fileServer))
 	// categories routesstdChain(
 	router.Handler(http.MethodGet, "/categories", stdChain.ThenFunc(app.listCategoriesHanlder))
-	router.Handler(http.MethodPost, "/categories", authorizedChain.ThenFunc(app.createCategoryHandler))
+	router.Handler(http.MethodPost, "/categories", permitted("categories:write").ThenFunc(app.createCategoryHandler))
 	router.Handler(http.MethodGet, "/categories/:id", stdChain.ThenFunc(app.showCategoryHandler))
-	router.Handler(http.MethodPatch, "/categories/:id", authorizedChain.ThenFunc(app.updateCategoryHandler))
-	router.Handler(http.MethodDelete, "/categories/:id", authorizedChain.ThenFunc(app.deleteCategoryHandler))
+	router.Handler(http.MethodPatch, "/categories/:id", permitted("categories:write").ThenFunc(app.updateCategoryHandler))
+	router.Handler(http.MethodDelete, "/categories/:id", permitted("categories:write").ThenFunc(app.deleteCategoryHandler))
+	router.Handler(http.MethodPost, "/categories/:id/photo", permitted("categories:write").ThenFunc(app.attachCategoryPhotoHandler))
+	router.Handler(http.MethodGet, "/categories/:id/translations", stdChain.ThenFunc(app.listTranslationsHandler(data.TranslationCategory)))
+	router.Handler(http.MethodPut, "/categories/:id/translations/:lang", permitted("categories:write").ThenFunc(app.setTranslationHandler(data.TranslationCategory)))
+	router.Handler(http.MethodDelete, "/categories/:id/translations/:lang", permitted("categories:write").ThenFunc(app.deleteTranslationHandler(data.TranslationCategory)))
+	router.Handler(http.MethodPost, "/categories/:id/media", permitted("categories:write").ThenFunc(app.uploadMediaHandler(data.MediaCategory)))
+	router.Handler(http.MethodPut, "/categories/:id/media", permitted("categories:write").ThenFunc(app.reorderMediaHandler(data.MediaCategory)))
+	router.Handler(http.MethodPatch, "/categories/:id/media/:media_id", permitted("categories:write").ThenFunc(app.updateMediaHandler(data.MediaCategory)))
+	router.Handler(http.MethodDelete, "/categories/:id/media/:media_id", permitted("categories:write").ThenFunc(app.deleteMediaHandler(data.MediaCategory)))
+	// pre-signed uploads, PUT receives the photos of the local storage
+	router.Handler(http.MethodPost, "/uploads", permitted("categories:write").ThenFunc(app.createUploadHandler))
+	router.Handler(http.MethodPut, "/uploads/:blob_name", stdChain.ThenFunc(app.receiveUploadHandler))
 	// subcategories routes
 	router.Handler(http.MethodGet, "/subcategories", stdChain.ThenFunc(app.listSubCategoriesHandler))
-	router.Handler(http.MethodPost, "/subcategories", authorizedChain.ThenFunc(app.createSubCategoryHandler))
+	router.Handler(http.MethodPost, "/subcategories", permitted("subcategories:write").ThenFunc(app.createSubCategoryHandler))
 	router.Handler(http.MethodGet, "/subcategories/:id", stdChain.ThenFunc(app.showSubCategoryHandler))
-	router.Handler(http.MethodPut, "/subcategories/:id", authorizedChain.ThenFunc(app.updateSubCategoryHandler))
-	router.Handler(http.MethodDelete, "/subcategories/:id", authorizedChain.ThenFunc(app.deleteSubCategoryHandler))
+	router.Handler(http.MethodPut, "/subcategories/:id", permitted("subcategories:write").ThenFunc(app.updateSubCategoryHandler))
+	router.Handler(http.MethodDelete, "/subcategories/:id", permitted("subcategories:write").ThenFunc(app.deleteSubCategoryHandler))
+	router.Handler(http.MethodGet, "/subcategories/:id/translations", stdChain.ThenFunc(app.listTranslationsHandler(data.TranslationSubCategory)))
+	router.Handler(http.MethodPut, "/subcategories/:id/translations/:lang", permitted("subcategories:write").ThenFunc(app.setTranslationHandler(data.TranslationSubCategory)))
+	router.Handler(http.MethodDelete, "/subcategories/:id/translations/:lang", permitted("subcategories:write").ThenFunc(app.deleteTranslationHandler(data.TranslationSubCategory)))
 	// services routes
 	router.Handler(http.MethodGet, "/services", stdChain.ThenFunc(app.listServicesHandler))
-	router.Handler(http.MethodPost, "/services", authorizedChain.ThenFunc(app.createServiceHandler))
+	router.Handler(http.MethodPost, "/services", permitted("services:write").ThenFunc(app.createServiceHandler))
 	router.Handler(http.MethodGet, "/services/:id", stdChain.ThenFunc(app.showServiceHandler))
-	router.Handler(http.MethodPatch, "/services/:id", authorizedChain.ThenFunc(app.updateServiceHandler))
-	router.Handler(http.MethodDelete, "/services/:id", authorizedChain.ThenFunc(app.deleteServiceHandler))
+	router.Handler(http.MethodPatch, "/services/:id", permitted("services:write").ThenFunc(app.updateServiceHandler))
+	router.Handler(http.MethodDelete, "/services/:id", permitted("services:write").ThenFunc(app.deleteServiceHandler))
+	router.Handler(http.MethodGet, "/services/:id/staff", stdChain.ThenFunc(app.listServiceMastersHandler))
+	router.Handler(http.MethodGet, "/services/:id/prices", stdChain.ThenFunc(app.listServicePricesHandler))
+	router.Handler(http.MethodPost, "/services/:id/prices", permitted("services:write").ThenFunc(app.scheduleServicePriceHandler))
+	router.Handler(http.MethodDelete, "/services/:id/prices/:price_id", permitted("services:write").ThenFunc(app.deleteServicePriceHandler))
+	router.Handler(http.MethodGet, "/services/:id/translations", stdChain.ThenFunc(app.listTranslationsHandler(data.TranslationService)))
+	router.Handler(http.MethodPut, "/services/:id/translations/:lang", permitted("services:write").ThenFunc(app.setTranslationHandler(data.TranslationService)))
+	router.Handler(http.MethodDelete, "/services/:id/translations/:lang", permitted("services:write").ThenFunc(app.deleteTranslationHandler(data.TranslationService)))
+	router.Handler(http.MethodPost, "/services/:id/media", permitted("services:write").ThenFunc(app.uploadMediaHandler(data.MediaService)))
+	router.Handler(http.MethodPut, "/services/:id/media", permitted("services:write").ThenFunc(app.reorderMediaHandler(data.MediaService)))
+	router.Handler(http.MethodPatch, "/services/:id/media/:media_id", permitted("services:write").ThenFunc(app.updateMediaHandler(data.MediaService)))
+	router.Handler(http.MethodDelete, "/services/:id/media/:media_id", permitted("services:write").ThenFunc(app.deleteMediaHandler(data.MediaService)))
+
+	router.Handler(http.MethodGet, "/packages", stdChain.ThenFunc(app.listPackagesHandler))
+	router.Handler(http.MethodPost, "/packages", permitted("packages:write").ThenFunc(app.createPackageHandler))
+	router.Handler(http.MethodGet, "/packages/:id", stdChain.ThenFunc(app.showPackageHandler))
+	router.Handler(http.MethodPatch, "/packages/:id", permitted("packages:write").ThenFunc(app.updatePackageHandler))
+	router.Handler(http.MethodDelete, "/packages/:id", permitted("packages:write").ThenFunc(app.deletePackageHandler))
+	router.Handler(http.MethodGet, "/promotions", permitted("promotions:read").ThenFunc(app.listPromotionsHandler))
+	router.Handler(http.MethodPost, "/promotions", permitted("promotions:write").ThenFunc(app.createPromotionHandler))
+	router.Handler(http.MethodGet, "/promotions/:id", permitted("promotions:read").ThenFunc(app.showPromotionHandler))
+	router.Handler(http.MethodPatch, "/promotions/:id", permitted("promotions:write").ThenFunc(app.updatePromotionHandler))
+	router.Handler(http.MethodDelete, "/promotions/:id", permitted("promotions:write").ThenFunc(app.deletePromotionHandler))
+	router.Handler(http.MethodGet, "/promo-codes/:code", stdChain.ThenFunc(app.checkPromoCodeHandler))
 
 	router.Handler(http.MethodGet, "/services_with_subcategories/:id", stdChain.ThenFunc(app.listServicesWithSubcategoriesByCategory))
+	router.Handler(http.MethodGet, "/search", stdChain.ThenFunc(app.searchHandler))
+	// staff routes
+	router.Handler(http.MethodGet, "/staff", stdChain.ThenFunc(app.listStaffHandler))
+	router.Handler(http.MethodPost, "/staff", permitted("staff:write").ThenFunc(app.createStaffHandler))
+	router.Handler(http.MethodGet, "/staff/:id", stdChain.ThenFunc(app.showStaffHandler))
+	router.Handler(http.MethodPatch, "/staff/:id", permitted("staff:write").ThenFunc(app.updateStaffHandler))
+	router.Handler(http.MethodDelete, "/staff/:id", permitted("staff:write").ThenFunc(app.deleteStaffHandler))
+	router.Handler(http.MethodPost, "/staff/:id/media", permitted("staff:write").ThenFunc(app.uploadMediaHandler(data.MediaStaff)))
+	router.Handler(http.MethodPut, "/staff/:id/media", permitted("staff:write").ThenFunc(app.reorderMediaHandler(data.MediaStaff)))
+	router.Handler(http.MethodPatch, "/staff/:id/media/:media_id", permitted("staff:write").ThenFunc(app.updateMediaHandler(data.MediaStaff)))
+	router.Handler(http.MethodDelete, "/staff/:id/media/:media_id", permitted("staff:write").ThenFunc(app.deleteMediaHandler(data.MediaStaff)))
+	router.Handler(http.MethodGet, "/staff/:id/services", stdChain.ThenFunc(app.listStaffServicesHandler))
+	router.Handler(http.MethodPut, "/staff/:id/services/:service_id", permitted("staff:write").ThenFunc(app.assignStaffServiceHandler))
+	router.Handler(http.MethodDelete, "/staff/:id/services/:service_id", permitted("staff:write").ThenFunc(app.unassignStaffServiceHandler))
+	// schedules routes
+	router.Handler(http.MethodGet, "/staff/:id/schedule", permitted("schedules:read").ThenFunc(app.showScheduleHandler))
+	router.Handler(http.MethodPut, "/staff/:id/schedule/working_hours", permitted("schedules:write").ThenFunc(app.updateWorkingHoursHandler))
+	router.Handler(http.MethodPut, "/staff/:id/schedule/breaks", permitted("schedules:write").ThenFunc(app.updateBreaksHandler))
+	router.Handler(http.MethodPost, "/staff/:id/schedule/exceptions", permitted("schedules:write").ThenFunc(app.setScheduleExceptionHandler))
+	router.Handler(http.MethodDelete, "/staff/:id/schedule/exceptions/:exception_id", permitted("schedules:write").ThenFunc(app.deleteScheduleExceptionHandler))
+	router.Handler(http.MethodGet, "/availability", stdChain.ThenFunc(app.availabilityHandler))
+	// appointments routes
+	router.Handler(http.MethodGet, "/appointments", permitted("appointments:read").ThenFunc(app.listAppointmentsHandler))
+	router.Handler(http.MethodPost, "/appointments", stdChain.ThenFunc(app.createAppointmentHandler))
+	router.Handler(http.MethodGet, "/appointments/:id", permitted("appointments:read").ThenFunc(app.showAppointmentHandler))
+	router.Handler(http.MethodPatch, "/appointments/:id", permitted("appointments:write").ThenFunc(app.updateAppointmentHandler))
+	// contact form and leads routes
+	router.Handler(http.MethodPost, "/contact", contactChain.ThenFunc(app.sendToTelegramHandler))
+	router.Handler(http.MethodGet, "/leads", permitted("leads:read").ThenFunc(app.listLeadsHandler))
+	router.Handler(http.MethodGet, "/leads/:id", permitted("leads:read").ThenFunc(app.showLeadHandler))
+	router.Handler(http.MethodPatch, "/leads/:id", permitted("leads:write").ThenFunc(app.updateLeadHandler))
+	// background jobs routes
+	router.Handler(http.MethodGet, "/admin/jobs", permitted("jobs:read").ThenFunc(app.listJobsHandler))
+	router.Handler(http.MethodGet, "/admin/jobs/:id", permitted("jobs:read").ThenFunc(app.showJobHandler))
+	router.Handler(http.MethodPost, "/admin/jobs/:id/retry", permitted("jobs:write").ThenFunc(app.retryJobHandler))
+	// user management routes
+	router.Handler(http.MethodGet, "/admin/users", permitted("users:read").ThenFunc(app.listUsersHandler))
+	router.Handler(http.MethodGet, "/admin/users/:id", permitted("users:read").ThenFunc(app.showUserHandler))
+	router.Handler(http.MethodPatch, "/admin/users/:id", permitted("users:write").ThenFunc(app.updateUserHandler))
+	router.Handler(http.MethodPut, "/admin/users/:id/activated", permitted("users:write").ThenFunc(app.updateUserActivatedHandler))
+	router.Handler(http.MethodPost, "/admin/users/:id/password-reset", permitted("users:write").ThenFunc(app.forcePasswordChangeHandler))
+	router.Handler(http.MethodDelete, "/admin/users/:id", permitted("users:write").ThenFunc(app.deleteUserHandler))
+	// audit log routes
+	router.Handler(http.MethodGet, "/admin/audit", permitted("audit:read").ThenFunc(app.listAuditHandler))
+	// login lockouts routes
+	router.Handler(http.MethodGet, "/admin/lockouts", permitted("lockouts:read").ThenFunc(app.listLockoutsHandler))
+	router.Handler(http.MethodDelete, "/admin/lockouts/:id", permitted("lockouts:write").ThenFunc(app.deleteLockoutHandler))
+	// tokens routes
+	router.Handler(http.MethodPost, "/tokens/authentication", stdChain.ThenFunc(app.createAuthenticationTokenHandler))
+	router.Handler(http.MethodPost, "/tokens/authentication/totp", stdChain.ThenFunc(app.createAuthenticationTokenTwoFactorHandler))
+	router.Handler(http.MethodPost, "/tokens/activation", stdChain.ThenFunc(app.createActivationTokenHandler))
+	router.Handler(http.MethodPost, "/tokens/password-reset", stdChain.ThenFunc(app.createPasswordResetTokenHandler))
+	router.Handler(http.MethodGet, "/tokens", authorizedChain.ThenFunc(app.listAuthenticationTokensHandler))
+	router.Handler(http.MethodDelete, "/tokens", authorizedChain.ThenFunc(app.deleteAllAuthenticationTokensHandler))
+	router.Handler(http.MethodDelete, "/tokens/:id", authorizedChain.ThenFunc(app.deleteAuthenticationTokenHandler))
 	// users routes
-	router.Handler(http.MethodPost, "/user/register", authorizedChain.ThenFunc(app.registerUserHandler))
+	router.Handler(http.MethodPost, "/user/register", permitted("users:write").ThenFunc(app.registerUserHandler))
 	router.Handler(http.MethodPost, "/user/login", stdChain.ThenFunc(app.loginHandler))
+	router.Handler(http.MethodPost, "/user/login/totp", stdChain.ThenFunc(app.loginTwoFactorHandler))
+	router.Handler(http.MethodPut, "/user/activated", stdChain.ThenFunc(app.activateUserHandler))
+	router.Handler(http.MethodPut, "/user/password", stdChain.ThenFunc(app.updateUserPasswordHandler))
 	// TODO change logout to POST
 	router.Handler(http.MethodGet, "/user/logout", authorizedChain.ThenFunc(app.logoutHandler))
+	router.Handler(http.MethodGet, "/user/me", authorizedChain.ThenFunc(app.showCurrentUserHandler))
+	router.Handler(http.MethodGet, "/user/sessions", authorizedChain.ThenFunc(app.listSessionsHandler))
+	router.Handler(http.MethodDelete, "/user/sessions", authorizedChain.ThenFunc(app.deleteAllSessionsHandler))
+	router.Handler(http.MethodDelete, "/user/sessions/:id", authorizedChain.ThenFunc(app.deleteSessionHandler))
+	router.Handler(http.MethodPost, "/user/totp/setup", authorizedChain.ThenFunc(app.setupTOTPHandler))
+	router.Handler(http.MethodPost, "/user/totp/enable", authorizedChain.ThenFunc(app.enableTOTPHandler))
+	router.Handler(http.MethodDelete, "/user/totp", authorizedChain.ThenFunc(app.disableTOTPHandler))
+	router.Handler(http.MethodPost, "/user/totp/recovery-codes", authorizedChain.ThenFunc(app.regenerateRecoveryCodesHandler))
 	router.Handler(http.MethodGet, "/healthcheck", authorizedChain.ThenFunc(app.healthcheckHandler))
 
-	return router
+	return app.requestID(router)
 }
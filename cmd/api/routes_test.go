@@ -0,0 +1,17 @@
+package main
+
+import (
+	"testing"
+)
+
+// TestRoutes makes sure that every route can be registered
+// without conflicting with another one
+func TestRoutes(t *testing.T) {
+	app := &application{}
+	defer func() {
+		if err := recover(); err != nil {
+			t.Fatalf("routes could not be registered: %v", err)
+		}
+	}()
+	app.routes()
+}
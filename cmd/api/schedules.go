@@ -0,0 +1,284 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"cosmetcab.dp.ua/internal/data"
+	"cosmetcab.dp.ua/internal/validator"
+)
+
+// slotStep is the interval between start times of offered slots
+const slotStep = 15 * time.Minute
+
+func (app *application) showScheduleHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	_, err = app.models.Staff.Get(id)
+	if err != nil {
+		app.notFoundWithIDResponse(w, r, id)
+		return
+	}
+	schedule, err := app.models.Schedules.Get(id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"schedule": schedule}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) updateWorkingHoursHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	_, err = app.models.Staff.Get(id)
+	if err != nil {
+		app.notFoundWithIDResponse(w, r, id)
+		return
+	}
+	schedule, err := app.models.Schedules.Get(id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	var input struct {
+		WorkingHours []*data.WorkingHours `json:"working_hours"`
+	}
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	if data.ValidateWorkingHours(v, input.WorkingHours); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = app.models.Schedules.SetWorkingHours(id, input.WorkingHours)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	app.audit(r, data.AuditUpdate, auditWorkingHours, id, schedule.WorkingHours, input.WorkingHours)
+	err = app.writeJSON(w, http.StatusOK, envelope{"working_hours": input.WorkingHours}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) updateBreaksHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	_, err = app.models.Staff.Get(id)
+	if err != nil {
+		app.notFoundWithIDResponse(w, r, id)
+		return
+	}
+	schedule, err := app.models.Schedules.Get(id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	var input struct {
+		Breaks []*data.Break `json:"breaks"`
+	}
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	if data.ValidateBreaks(v, input.Breaks); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = app.models.Schedules.SetBreaks(id, input.Breaks)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	app.audit(r, data.AuditUpdate, auditBreaks, id, schedule.Breaks, input.Breaks)
+	err = app.writeJSON(w, http.StatusOK, envelope{"breaks": input.Breaks}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// setScheduleExceptionHandler adds a day off or changed working hours for a
+// single date, replacing an exception already set for that date.
+func (app *application) setScheduleExceptionHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	_, err = app.models.Staff.Get(id)
+	if err != nil {
+		app.notFoundWithIDResponse(w, r, id)
+		return
+	}
+	schedule, err := app.models.Schedules.Get(id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	var input struct {
+		Date     string         `json:"date"`
+		DayOff   bool           `json:"day_off"`
+		StartsAt data.TimeOfDay `json:"starts_at"`
+		EndsAt   data.TimeOfDay `json:"ends_at"`
+		Note     string         `json:"note"`
+	}
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	exception := &data.ScheduleException{
+		StaffID:  id,
+		Date:     input.Date,
+		DayOff:   input.DayOff,
+		StartsAt: input.StartsAt,
+		EndsAt:   input.EndsAt,
+		Note:     input.Note,
+	}
+	v := validator.New()
+	if data.ValidateScheduleException(v, exception); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = app.models.Schedules.SetException(exception)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	// an exception already set for the date is replaced
+	action := data.AuditCreate
+	var before *data.ScheduleException
+	for _, e := range schedule.Exceptions {
+		if e.Date == exception.Date {
+			action, before = data.AuditUpdate, e
+		}
+	}
+	app.audit(r, action, auditScheduleException, exception.ID, before, exception)
+	err = app.writeJSON(w, http.StatusOK, envelope{"exception": exception}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteScheduleExceptionHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	exceptionID, err := app.readInt64Param(r, "exception_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	schedule, err := app.models.Schedules.Get(id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.models.Schedules.DeleteException(id, exceptionID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	for _, e := range schedule.Exceptions {
+		if e.ID == exceptionID {
+			app.audit(r, data.AuditDelete, auditScheduleException, exceptionID, e, nil)
+		}
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "exception successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// availabilityHandler computes the free slots for a service on a date
+// for every master offering it, or for a single master when staff_id is set.
+func (app *application) availabilityHandler(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+	v := validator.New()
+	serviceID := app.readInt64(qs, "service_id", 0, v)
+	staffID := app.readInt64(qs, "staff_id", 0, v)
+	dateParam := app.readString(qs, "date", "")
+
+	v.Check(serviceID > 0, "service_id", "must be provided")
+	date, err := time.ParseInLocation(data.DateLayout, dateParam, app.location)
+	v.Check(err == nil, "date", "must be a date in YYYY-MM-DD format")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	_, err = app.models.Services.Get(serviceID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundWithIDResponse(w, r, serviceID)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	masters, err := app.models.Staff.GetMastersForService(serviceID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	type masterAvailability struct {
+		Staff *data.ServiceMaster `json:"staff"`
+		Slots []time.Time         `json:"slots"`
+	}
+	day := data.Interval{Start: date, End: date.AddDate(0, 0, 1)}
+	availability := []*masterAvailability{}
+	for _, master := range masters {
+		if staffID != 0 && master.ID != staffID {
+			continue
+		}
+		schedule, err := app.models.Schedules.Get(master.ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		busy, err := app.models.Appointments.GetBusyIntervals(master.ID, day)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		slots := data.FreeSlots(schedule.WorkingIntervals(date), busy, master.Duration(), slotStep, time.Now())
+		availability = append(availability, &masterAvailability{Staff: master, Slots: slots})
+	}
+
+	env := envelope{
+		"service_id":   serviceID,
+		"date":         date.Format(data.DateLayout),
+		"availability": availability,
+	}
+	err = app.writeJSON(w, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
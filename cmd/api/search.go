@@ -0,0 +1,54 @@
+package main
+
+import (
+	"net/http"
+
+	"cosmetcab.dp.ua/internal/data"
+	"cosmetcab.dp.ua/internal/validator"
+)
+
+// searchHandler searches the service catalogue. Results are always
+// ordered by relevance, so only the page parameters are accepted.
+func (app *application) searchHandler(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+	q := app.readString(qs, "q", "")
+	v := validator.New()
+	data.ValidateSearchQuery(v, q)
+	filters := app.readFilters(qs, "rank", []string{"rank"}, v)
+	if data.ValidateFilters(v, filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	services, metadata, err := app.models.Services.Search(q, filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	promotions, err := app.models.Promotions.GetRunning()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	withSubcategories := make([]*data.ServiceWithSubcategory, len(services))
+	categories := make([]*data.Category, len(services))
+	for i, service := range services {
+		promotions.ApplyToServiceWithSubcategory(&service.ServiceWithSubcategory, service.Category.ID)
+		withSubcategories[i] = &service.ServiceWithSubcategory
+		categories[i] = &service.Category
+	}
+	lang := app.language(w, r)
+	err = app.localizeServicesWithSubcategories(lang, withSubcategories...)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.localizeCategories(lang, categories...)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"services": services, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
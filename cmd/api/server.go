@@ -21,6 +21,13 @@ func (app *application) serve() error {
 		WriteTimeout: 10 * time.Second,
 		ErrorLog:     slog.NewLogLogger(app.logger.Handler(), slog.LevelError),
 	}
+	workersCtx, stopWorkers := context.WithCancel(context.Background())
+	app.startWorkers(workersCtx)
+	app.startAuthCleanup(workersCtx)
+	app.startPriceScheduler(workersCtx)
+	app.startUploadCleanup(workersCtx)
+	app.startReconciler(workersCtx)
+
 	shutdownErr := make(chan error)
 	// start a background goroutine
 	go func() {
@@ -37,6 +44,7 @@ func (app *application) serve() error {
 			shutdownErr <- err
 		}
 		app.logger.Info("completing background tasks", "addr", srv.Addr)
+		stopWorkers()
 		app.wg.Wait()
 		shutdownErr <- nil
 	}()
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"cosmetcab.dp.ua/internal/data"
+	"cosmetcab.dp.ua/internal/validator"
+)
+
+// priceSchedulerInterval is how often prices that took effect are
+// applied to their services
+const priceSchedulerInterval = time.Minute
+
+// startPriceScheduler periodically applies scheduled prices until ctx is
+// cancelled, so a new price list takes effect without manual edits
+func (app *application) startPriceScheduler(ctx context.Context) {
+	app.wg.Add(1)
+	go func() {
+		defer app.wg.Done()
+		// prices that took effect while the server was down are applied first
+		app.applyDuePrices()
+		ticker := time.NewTicker(priceSchedulerInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				app.applyDuePrices()
+			}
+		}
+	}()
+}
+
+func (app *application) applyDuePrices() {
+	changed, err := app.models.ServicePrices.ApplyDue()
+	if err != nil {
+		app.logger.Error("Error applying scheduled prices", "err", err)
+	} else if changed > 0 {
+		app.logger.Info("applied scheduled prices", "count", changed)
+	}
+}
+
+// listServicePricesHandler returns the price timeline of a service
+// including prices scheduled for the future
+func (app *application) listServicePricesHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	service, err := app.models.Services.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	prices, err := app.models.ServicePrices.GetAllForService(id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"current_price": service.Price, "prices": prices}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// scheduleServicePriceHandler sets a new price of a service from the given
+// time on, or right away when no time is given
+func (app *application) scheduleServicePriceHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	_, err = app.models.Services.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	var input struct {
+		Price         int        `json:"price"`
+		EffectiveFrom *time.Time `json:"effective_from"`
+	}
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	// the database keeps whole seconds, see ServicePriceModel.Schedule
+	now := time.Now().Truncate(time.Second)
+	price := &data.ServicePrice{
+		ServiceID:     id,
+		Price:         input.Price,
+		EffectiveFrom: now,
+	}
+	if input.EffectiveFrom != nil {
+		price.EffectiveFrom = input.EffectiveFrom.Truncate(time.Second)
+	}
+	v := validator.New()
+	if data.ValidateServicePrice(v, price, now); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = app.models.ServicePrices.Schedule(price)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !price.Scheduled {
+		app.applyDuePrices()
+		price.Current = true
+	}
+	app.audit(r, data.AuditCreate, auditServicePrice, price.ID, nil, price)
+	err = app.writeJSON(w, http.StatusCreated, envelope{"price": price}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteServicePriceHandler cancels a price that hasn't taken effect yet
+func (app *application) deleteServicePriceHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	priceID, err := app.readInt64Param(r, "price_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	price, err := app.models.ServicePrices.DeleteScheduled(id, priceID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.errorResponse(w, r, http.StatusNotFound, "no scheduled price with this id could be found")
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	app.audit(r, data.AuditDelete, auditServicePrice, price.ID, price, nil)
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "scheduled price successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -53,9 +53,15 @@ func (app *application) createServiceHandler(w http.ResponseWriter, r *http.Requ
 		app.dbErrorResponse(w, r, err)
 		return
 	}
+	app.audit(r, data.AuditCreate, auditService, service.ID, nil, service)
 	headers := make(http.Header)
 	headers.Set("Location", fmt.Sprintf("/services/%d", service.ID))
 
+	err = app.discountServices(service)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
 	err = app.writeJSON(w, http.StatusCreated, envelope{"service": service}, headers)
 
 	if err != nil {
@@ -81,19 +87,60 @@ func (app *application) showServiceHandler(w http.ResponseWriter, r *http.Reques
 		}
 		return
 	}
-	err = app.writeJSON(w, http.StatusOK, envelope{"service": service}, nil)
+	err = app.discountServices(service)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.localizeServices(app.language(w, r), service)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	gallery, err := app.models.Media.GetAll(data.MediaService, service.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"service": service, "gallery": gallery}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 }
 
 func (app *application) listServicesHandler(w http.ResponseWriter, r *http.Request) {
-	services, err := app.models.Services.GetAll()
+	qs := r.URL.Query()
+	v := validator.New()
+	filter := data.ServiceFilter{
+		CategoryID:    app.readInt64(qs, "category_id", 0, v),
+		SubCategoryID: app.readInt64(qs, "subcategory_id", 0, v),
+		MinPrice:      app.readInt(qs, "min_price", 0, v),
+		MaxPrice:      app.readInt(qs, "max_price", 0, v),
+	}
+	v.Check(filter.MinPrice >= 0, "min_price", "must not be negative")
+	v.Check(filter.MaxPrice >= 0, "max_price", "must not be negative")
+	v.Check(filter.MaxPrice == 0 || filter.MinPrice <= filter.MaxPrice, "max_price", "must not be less than min_price")
+	filters := app.readFilters(qs, "id", []string{"id", "price", "time", "description", "-id", "-price", "-time", "-description"}, v)
+	if data.ValidateFilters(v, filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	services, metadata, err := app.models.Services.GetAll(filter, filters)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
-	err = app.writeJSON(w, http.StatusOK, envelope{"services": services}, nil)
+	err = app.discountServices(services...)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.localizeServices(app.language(w, r), services...)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"services": services, "metadata": metadata}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -122,7 +169,25 @@ func (app *application) listServicesWithSubcategoriesByCategory(w http.ResponseW
 		}
 		return
 	}
-	err = app.writeJSON(w, http.StatusOK, envelope{"services_with_subcategories": servicesWithSubcategories}, nil)
+	promotions, err := app.models.Promotions.GetRunning()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	for _, service := range servicesWithSubcategories {
+		promotions.ApplyToServiceWithSubcategory(service, category_id)
+	}
+	packages, err := app.models.Packages.GetAllForCategory(category_id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.localizeServicesWithSubcategories(app.language(w, r), servicesWithSubcategories...)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"services_with_subcategories": servicesWithSubcategories, "packages": packages}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -136,8 +201,15 @@ func (app *application) updateServiceHandler(w http.ResponseWriter, r *http.Requ
 	}
 	service, err := app.models.Services.Get(id)
 	if err != nil {
-
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
 	}
+	before := snapshot(service)
 
 	var input struct {
 		Time          *sql.NullInt16 `json:"time"`
@@ -187,6 +259,12 @@ func (app *application) updateServiceHandler(w http.ResponseWriter, r *http.Requ
 	}
 	err = app.models.Services.Update(service)
 
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	app.audit(r, data.AuditUpdate, auditService, service.ID, before, service)
+	err = app.discountServices(service)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
@@ -203,17 +281,37 @@ func (app *application) deleteServiceHandler(w http.ResponseWriter, r *http.Requ
 	id, err := app.readIDParam(r)
 	if err != nil {
 		app.notFoundResponse(w, r)
+		return
+	}
+	service, err := app.models.Services.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	gallery, err := app.models.Media.GetAll(data.MediaService, id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
 	}
 	err = app.models.Services.Delete(id)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
 			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrServiceInPackage):
+			app.serviceInPackageResponse(w, r)
 		default:
 			app.serverErrorResponse(w, r, err)
 		}
 		return
 	}
+	app.audit(r, data.AuditDelete, auditService, id, service, nil)
+	app.deleteGallery(gallery)
 	err = app.writeJSON(w, http.StatusOK, envelope{"message": "service succesfully deleted"}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
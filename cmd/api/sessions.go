@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"cosmetcab.dp.ua/internal/data"
+)
+
+const sessionCookieName = "cookie-auth"
+
+// authCleanupInterval is how often ended sessions, expired tokens and
+// stale login failures are removed from the database
+const authCleanupInterval = 10 * time.Minute
+
+// startAuthCleanup periodically deletes ended sessions, expired tokens
+// and stale login failures until ctx is cancelled
+func (app *application) startAuthCleanup(ctx context.Context) {
+	app.wg.Add(1)
+	go func() {
+		defer app.wg.Done()
+		ticker := time.NewTicker(authCleanupInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				deleted, err := app.models.Sessions.DeleteExpired(app.config.session.idleTimeout)
+				if err != nil {
+					app.logger.Error("Error deleting expired sessions", "err", err)
+				} else if deleted > 0 {
+					app.logger.Info("deleted expired sessions", "count", deleted)
+				}
+				deleted, err = app.models.Tokens.DeleteExpired()
+				if err != nil {
+					app.logger.Error("Error deleting expired tokens", "err", err)
+				} else if deleted > 0 {
+					app.logger.Info("deleted expired tokens", "count", deleted)
+				}
+				_, err = app.models.LoginFailures.DeleteStale(app.config.login.failureWindow)
+				if err != nil {
+					app.logger.Error("Error deleting stale login failures", "err", err)
+				}
+			}
+		}
+	}()
+}
+
+// listSessionsHandler returns the active sessions of the logged in user
+func (app *application) listSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	session, err := app.sessionManager.Get(r, sessionCookieName)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	sessions, err := app.models.Sessions.GetAllForUser(app.contextGetUserID(r), app.config.session.idleTimeout)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	currentHash := data.HashToken(session.ID)
+	for _, s := range sessions {
+		s.Current = bytes.Equal(s.TokenHash, currentHash)
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"sessions": sessions}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteSessionHandler logs the user out of one of their sessions
+func (app *application) deleteSessionHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	err = app.models.Sessions.Delete(id, app.contextGetUserID(r))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "session successfully revoked"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteAllSessionsHandler logs the user out everywhere, including the current session
+func (app *application) deleteAllSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	err := app.models.Sessions.DeleteAllForUser(app.contextGetUserID(r))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	session, err := app.sessionManager.Get(r, sessionCookieName)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	session.Options.MaxAge = -1
+	err = session.Save(r, w)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"logout": "successful"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"net/http"
+	"time"
+
+	"cosmetcab.dp.ua/internal/data"
+	"github.com/gorilla/sessions"
+)
+
+// newSessionToken returns 128 random bits encoded in base32
+func newSessionToken() (string, error) {
+	return data.RandomString(16)
+}
+
+// dbSessionStore is a sessions.Store that keeps session data in PostgreSQL.
+// The cookie only carries a random token, so sessions can be revoked server
+// side. A session ends after idleTimeout without requests or lifetime after
+// it was created, whichever comes first.
+type dbSessionStore struct {
+	model       data.SessionModel
+	options     *sessions.Options
+	idleTimeout time.Duration
+	lifetime    time.Duration
+	proxies     trustedProxies
+}
+
+func newDBSessionStore(model data.SessionModel, idleTimeout, lifetime time.Duration, proxies trustedProxies) *dbSessionStore {
+	return &dbSessionStore{
+		model: model,
+		options: &sessions.Options{
+			Path:     "/",
+			MaxAge:   int(lifetime.Seconds()),
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		},
+		idleTimeout: idleTimeout,
+		lifetime:    lifetime,
+		proxies:     proxies,
+	}
+}
+
+// Get returns the session cached for the request or loads it
+func (s *dbSessionStore) Get(r *http.Request, name string) (*sessions.Session, error) {
+	return sessions.GetRegistry(r).Get(s, name)
+}
+
+// New loads the session referenced by the request cookie. A new empty
+// session is returned when there is no cookie or the session has ended.
+func (s *dbSessionStore) New(r *http.Request, name string) (*sessions.Session, error) {
+	session := sessions.NewSession(s, name)
+	options := *s.options
+	session.Options = &options
+	session.IsNew = true
+
+	cookie, err := r.Cookie(name)
+	if err != nil {
+		return session, nil
+	}
+	stored, err := s.model.GetByToken(data.HashToken(cookie.Value), s.idleTimeout)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			return session, nil
+		}
+		return session, err
+	}
+	err = gob.NewDecoder(bytes.NewReader(stored.Data)).Decode(&session.Values)
+	if err != nil {
+		return session, err
+	}
+	session.ID = cookie.Value
+	session.IsNew = false
+	return session, nil
+}
+
+// Save stores the session and sets the cookie. A negative MaxAge deletes
+// the session.
+func (s *dbSessionStore) Save(r *http.Request, w http.ResponseWriter, session *sessions.Session) error {
+	if session.Options.MaxAge < 0 {
+		if session.ID != "" {
+			err := s.model.DeleteByToken(data.HashToken(session.ID))
+			if err != nil {
+				return err
+			}
+		}
+		http.SetCookie(w, sessions.NewCookie(session.Name(), "", session.Options))
+		return nil
+	}
+
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(session.Values)
+	if err != nil {
+		return err
+	}
+	userID, _ := session.Values["user_id"].(int64)
+
+	if session.ID == "" {
+		token, err := newSessionToken()
+		if err != nil {
+			return err
+		}
+		stored := &data.Session{
+			TokenHash: data.HashToken(token),
+			UserID:    userID,
+			Data:      buf.Bytes(),
+			UserAgent: r.UserAgent(),
+			IP:        s.proxies.clientIP(r),
+			ExpiresAt: time.Now().Add(s.lifetime),
+		}
+		err = s.model.Insert(stored)
+		if err != nil {
+			return err
+		}
+		session.ID = token
+	} else {
+		stored := &data.Session{
+			TokenHash: data.HashToken(session.ID),
+			UserID:    userID,
+			Data:      buf.Bytes(),
+		}
+		err = s.model.Update(stored)
+		if err != nil {
+			return err
+		}
+	}
+	http.SetCookie(w, sessions.NewCookie(session.Name(), session.ID, session.Options))
+	return nil
+}
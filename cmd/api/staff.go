@@ -0,0 +1,353 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"cosmetcab.dp.ua/internal/data"
+	"cosmetcab.dp.ua/internal/validator"
+)
+
+func (app *application) createStaffHandler(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseMultipartForm(10 << 20) // max size 10MB
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	photo, err := app.readPhoto(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	defer photo.Close()
+
+	staff := &data.Staff{
+		Name:     r.FormValue("name"),
+		Bio:      r.FormValue("bio"),
+		PhotoURL: app.blobStorage.BlobURL(photo.fileName),
+	}
+	v := validator.New()
+	if data.ValidateStaff(staff, v); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = app.uploadPhoto(photo)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.models.Staff.Insert(staff)
+	if err != nil {
+		app.discardPhoto(photo)
+		app.dbErrorResponse(w, r, err)
+		return
+	}
+	app.audit(r, data.AuditCreate, auditStaff, staff.ID, nil, staff)
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/staff/%d", staff.ID))
+
+	err = app.writeJSON(w, http.StatusAccepted, envelope{"staff": staff}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) showStaffHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	staff, err := app.models.Staff.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	gallery, err := app.models.Media.GetAll(data.MediaStaff, staff.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"staff": staff, "gallery": gallery}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listStaffHandler(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+	v := validator.New()
+	name := app.readString(qs, "name", "")
+	filters := app.readFilters(qs, "id", []string{"id", "name", "-id", "-name"}, v)
+	if data.ValidateFilters(v, filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	staff, metadata, err := app.models.Staff.GetAll(name, filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"staff": staff, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) updateStaffHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	staff, err := app.models.Staff.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	before := snapshot(staff)
+	err = r.ParseMultipartForm(10 << 20) // max size 10MB
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if name := r.FormValue("name"); name != "" {
+		staff.Name = name
+	}
+	if bio := r.FormValue("bio"); bio != "" {
+		staff.Bio = bio
+	}
+	v := validator.New()
+	if data.ValidateStaff(staff, v); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	var oldPhotoURL string
+	photo, err := app.readPhoto(r)
+	if nil == err {
+		// this means user specified the file and therefore
+		// we need to upload it to the blob
+		defer photo.Close()
+		err = app.uploadPhoto(photo)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		oldPhotoURL = staff.PhotoURL
+		staff.PhotoURL = app.blobStorage.BlobURL(photo.fileName)
+	} else if !errors.Is(err, http.ErrMissingFile) {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	err = app.models.Staff.Update(staff)
+	if err != nil {
+		if photo != nil {
+			app.discardPhoto(photo)
+		}
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	app.audit(r, data.AuditUpdate, auditStaff, staff.ID, before, staff)
+	// the old image is deleted only once the new one is saved
+	if oldPhotoURL != "" {
+		app.deletePhoto(oldPhotoURL)
+	}
+	err = app.writeJSON(w, http.StatusAccepted, envelope{"staff": staff}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteStaffHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	staff, err := app.models.Staff.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	gallery, err := app.models.Media.GetAll(data.MediaStaff, id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	photoURL, err := app.models.Staff.Delete(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrAppointmentOverlap):
+			app.staffAppointmentsOverlapResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	app.audit(r, data.AuditDelete, auditStaff, id, staff, nil)
+	app.deletePhoto(photoURL)
+	app.deleteGallery(gallery)
+	err = app.writeJSON(w, http.StatusAccepted, envelope{"message": "staff member successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listStaffServicesHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	_, err = app.models.Staff.Get(id)
+	if err != nil {
+		app.notFoundWithIDResponse(w, r, id)
+		return
+	}
+	services, err := app.models.Staff.GetServices(id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.discountServices(services...)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.localizeServices(app.language(w, r), services...)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"services": services}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listServiceMastersHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	_, err = app.models.Services.Get(id)
+	if err != nil {
+		app.notFoundWithIDResponse(w, r, id)
+		return
+	}
+	masters, err := app.models.Staff.GetMastersForService(id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"staff": masters}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) assignStaffServiceHandler(w http.ResponseWriter, r *http.Request) {
+	staffID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	serviceID, err := app.readInt64Param(r, "service_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	_, err = app.models.Staff.Get(staffID)
+	if err != nil {
+		app.notFoundWithIDResponse(w, r, staffID)
+		return
+	}
+	_, err = app.models.Services.Get(serviceID)
+	if err != nil {
+		app.notFoundWithIDResponse(w, r, serviceID)
+		return
+	}
+	// an empty body assigns the service without overrides
+	var input struct {
+		Price sql.NullInt32 `json:"price"`
+		Time  sql.NullInt16 `json:"time"`
+	}
+	if r.ContentLength != 0 {
+		err = app.readJSON(w, r, &input)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+	}
+	staffService := &data.StaffService{
+		StaffID:   staffID,
+		ServiceID: serviceID,
+		Price:     input.Price,
+		Time:      input.Time,
+	}
+	v := validator.New()
+	if data.ValidateStaffService(staffService, v); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = app.models.Staff.AssignService(staffService)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	app.audit(r, data.AuditCreate, auditStaffService, staffID, nil, staffService)
+	err = app.writeJSON(w, http.StatusOK, envelope{"staff_service": staffService}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) unassignStaffServiceHandler(w http.ResponseWriter, r *http.Request) {
+	staffID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	serviceID, err := app.readInt64Param(r, "service_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	err = app.models.Staff.UnassignService(staffID, serviceID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	app.audit(r, data.AuditDelete, auditStaffService, staffID, &data.StaffService{StaffID: staffID, ServiceID: serviceID}, nil)
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "service successfully unassigned"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -28,7 +28,9 @@ func (app *application) createSubCategoryHandler(w http.ResponseWriter, r *http.
 	err = app.models.SubCategories.Insert(subCategory)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
+		return
 	}
+	app.audit(r, data.AuditCreate, auditSubCategory, subCategory.ID, nil, subCategory)
 	err = app.writeJSON(w, http.StatusCreated, envelope{"subcategory": subCategory}, nil)
 }
 
@@ -48,6 +50,11 @@ func (app *application) showSubCategoryHandler(w http.ResponseWriter, r *http.Re
 		}
 		return
 	}
+	err = app.localizeSubCategories(app.language(w, r), subCategory)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
 	err = app.writeJSON(w, http.StatusOK, envelope{"subcategory": subCategory}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
@@ -56,12 +63,25 @@ func (app *application) showSubCategoryHandler(w http.ResponseWriter, r *http.Re
 }
 
 func (app *application) listSubCategoriesHandler(w http.ResponseWriter, r *http.Request) {
-	subCategories, err := app.models.SubCategories.GetAll()
+	qs := r.URL.Query()
+	v := validator.New()
+	name := app.readString(qs, "name", "")
+	filters := app.readFilters(qs, "id", []string{"id", "name", "-id", "-name"}, v)
+	if data.ValidateFilters(v, filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	subCategories, metadata, err := app.models.SubCategories.GetAll(name, filters)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
-	err = app.writeJSON(w, http.StatusOK, envelope{"sub_categories": subCategories}, nil)
+	err = app.localizeSubCategories(app.language(w, r), subCategories...)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"sub_categories": subCategories, "metadata": metadata}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -83,12 +103,14 @@ func (app *application) updateSubCategoryHandler(w http.ResponseWriter, r *http.
 		}
 		return
 	}
+	before := snapshot(subCategory)
 	var input struct {
 		Name string `json:"name"`
 	}
 	err = app.readJSON(w, r, &input)
 	if err != nil {
 		app.badRequestResponse(w, r, err)
+		return
 	}
 	subCategory.Name = input.Name
 	v := validator.New()
@@ -102,6 +124,7 @@ func (app *application) updateSubCategoryHandler(w http.ResponseWriter, r *http.
 		app.serverErrorResponse(w, r, err)
 		return
 	}
+	app.audit(r, data.AuditUpdate, auditSubCategory, subCategory.ID, before, subCategory)
 
 	err = app.writeJSON(w, http.StatusOK, envelope{"subcategory": subCategory}, nil)
 	if err != nil {
@@ -116,16 +139,36 @@ func (app *application) deleteSubCategoryHandler(w http.ResponseWriter, r *http.
 		app.notFoundResponse(w, r)
 		return
 	}
+	subCategory, err := app.models.SubCategories.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	// the services of the subcategory are deleted with it, their media too
+	serviceGalleries, err := app.models.Media.GetAllOfSubCategoryServices(id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
 	err = app.models.SubCategories.Delete(id)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
 			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrServiceInPackage):
+			app.serviceInPackageResponse(w, r)
 		default:
 			app.serverErrorResponse(w, r, err)
 		}
 		return
 	}
+	app.audit(r, data.AuditDelete, auditSubCategory, id, subCategory, nil)
+	app.deleteGallery(serviceGalleries)
 	err = app.writeJSON(w, http.StatusOK, envelope{"message": "subcategory succesfully deleted"}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
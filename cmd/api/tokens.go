@@ -0,0 +1,82 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"cosmetcab.dp.ua/internal/data"
+)
+
+// createAuthenticationTokenHandler exchanges an email and password for a
+// bearer token for clients that can't use the session cookie
+func (app *application) createAuthenticationTokenHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.verifyCredentials(w, r)
+	if user == nil {
+		return
+	}
+	if user.TOTPEnabled {
+		app.twoFactorChallengeResponse(w, r, user)
+		return
+	}
+	app.issueAuthenticationToken(w, r, user)
+}
+
+func (app *application) issueAuthenticationToken(w http.ResponseWriter, r *http.Request, user *data.User) {
+	token, err := app.models.Tokens.New(user.ID, app.config.tokens.authenticationTTL, data.ScopeAuthentication)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusCreated, envelope{"authentication_token": token}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listAuthenticationTokensHandler returns the active bearer tokens of the user.
+// Only the plaintext of a token is secret, so it is never listed.
+func (app *application) listAuthenticationTokensHandler(w http.ResponseWriter, r *http.Request) {
+	tokens, err := app.models.Tokens.GetAllForUser(data.ScopeAuthentication, app.contextGetUserID(r))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"authentication_tokens": tokens}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteAuthenticationTokenHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	err = app.models.Tokens.Delete(id, app.contextGetUserID(r))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "token successfully revoked"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteAllAuthenticationTokensHandler(w http.ResponseWriter, r *http.Request) {
+	err := app.models.Tokens.DeleteAllForUser(data.ScopeAuthentication, app.contextGetUserID(r))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "tokens successfully revoked"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
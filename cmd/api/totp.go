@@ -0,0 +1,266 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"cosmetcab.dp.ua/internal/data"
+	"cosmetcab.dp.ua/internal/totp"
+	"cosmetcab.dp.ua/internal/validator"
+)
+
+const (
+	// totpIssuer is the account name shown in authenticator apps
+	totpIssuer        = "LabBeauty"
+	twoFactorTokenTTL = 5 * time.Minute
+)
+
+// twoFactorChallengeResponse answers a login with a valid password for a
+// user with two-factor authentication. The returned token has to be sent
+// together with a code to finish the login.
+func (app *application) twoFactorChallengeResponse(w http.ResponseWriter, r *http.Request, user *data.User) {
+	token, err := app.models.Tokens.New(user.ID, twoFactorTokenTTL, data.ScopeTwoFactor)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	env := envelope{"two_factor_required": true, "two_factor_token": token.Plaintext}
+	err = app.writeJSON(w, http.StatusAccepted, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// checkSecondFactor accepts either a current TOTP code or an unused
+// recovery code of the user
+func (app *application) checkSecondFactor(user *data.User, code string) (bool, error) {
+	step, ok := totp.Validate(user.TOTPSecret, code, time.Now(), user.TOTPLastStep)
+	if ok {
+		return app.models.Users.UseTOTPStep(user.ID, step)
+	}
+	return app.models.RecoveryCodes.Use(user.ID, code)
+}
+
+// verifySecondFactor reads the token issued by twoFactorChallengeResponse and
+// a code from the request body and returns the user logging in. On failure
+// the error response has already been sent and nil is returned.
+func (app *application) verifySecondFactor(w http.ResponseWriter, r *http.Request) *data.User {
+	var input struct {
+		TokenPlaintext string `json:"two_factor_token"`
+		Code           string `json:"code"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return nil
+	}
+	v := validator.New()
+	data.ValidateTokenPlaintext(v, input.TokenPlaintext)
+	v.Check(input.Code != "", "code", "must be provided")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return nil
+	}
+	user, err := app.models.Users.GetForToken(data.ScopeTwoFactor, input.TokenPlaintext)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.invalidAuthenticationTokenResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil
+	}
+	if !app.checkLoginThrottle(w, r, user.Email) {
+		return nil
+	}
+	ok, err := app.checkSecondFactor(user, input.Code)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return nil
+	}
+	if !ok {
+		app.failedLoginResponse(w, r, user.Email)
+		return nil
+	}
+	err = app.resetLoginFailures(user.Email)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return nil
+	}
+	err = app.models.Tokens.DeleteAllForUser(data.ScopeTwoFactor, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return nil
+	}
+	return user
+}
+
+func (app *application) loginTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.verifySecondFactor(w, r)
+	if user == nil {
+		return
+	}
+	app.startSession(w, r, user)
+}
+
+func (app *application) createAuthenticationTokenTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.verifySecondFactor(w, r)
+	if user == nil {
+		return
+	}
+	app.issueAuthenticationToken(w, r, user)
+}
+
+// setupTOTPHandler starts the enrolment by generating a new secret. The
+// provisioning URI is meant to be shown as a QR code for authenticator apps.
+func (app *application) setupTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.currentUser(w, r)
+	if user == nil {
+		return
+	}
+	if user.TOTPEnabled {
+		app.errorResponse(w, r, http.StatusConflict, "two-factor authentication is already enabled")
+		return
+	}
+	user.TOTPSecret = totp.GenerateSecret()
+	if !app.updateCurrentUser(w, r, user) {
+		return
+	}
+	env := envelope{
+		"secret":           user.TOTPSecret,
+		"provisioning_uri": totp.ProvisioningURI(totpIssuer, user.Email, user.TOTPSecret),
+	}
+	err := app.writeJSON(w, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// enableTOTPHandler finishes the enrolment once the user proves their
+// authenticator app works and returns the recovery codes
+func (app *application) enableTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Code string `json:"code"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	user := app.currentUser(w, r)
+	if user == nil {
+		return
+	}
+	if user.TOTPEnabled {
+		app.errorResponse(w, r, http.StatusConflict, "two-factor authentication is already enabled")
+		return
+	}
+	v := validator.New()
+	v.Check(user.TOTPSecret != "", "code", "two-factor setup must be started first")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	step, ok := totp.Validate(user.TOTPSecret, input.Code, time.Now(), user.TOTPLastStep)
+	if !ok {
+		v.AddError("code", "invalid code")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	_, err = app.models.Users.UseTOTPStep(user.ID, step)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	user.TOTPEnabled = true
+	if !app.updateCurrentUser(w, r, user) {
+		return
+	}
+	codes, err := app.models.RecoveryCodes.Generate(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"user": user, "recovery_codes": codes}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readSecondFactorCode reads a code from the request body and checks it for
+// the authenticated user, who must have two-factor authentication enabled
+func (app *application) readSecondFactorCode(w http.ResponseWriter, r *http.Request) *data.User {
+	var input struct {
+		Code string `json:"code"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return nil
+	}
+	user := app.currentUser(w, r)
+	if user == nil {
+		return nil
+	}
+	if !user.TOTPEnabled {
+		app.errorResponse(w, r, http.StatusConflict, "two-factor authentication is not enabled")
+		return nil
+	}
+	ok, err := app.checkSecondFactor(user, input.Code)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return nil
+	}
+	if !ok {
+		v := validator.New()
+		v.AddError("code", "invalid code")
+		app.failedValidationResponse(w, r, v.Errors)
+		return nil
+	}
+	return user
+}
+
+func (app *application) disableTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.readSecondFactorCode(w, r)
+	if user == nil {
+		return
+	}
+	// without it the user could no longer use any permitted route
+	if user.TwoFactorRequired() {
+		app.errorResponse(w, r, http.StatusForbidden, "two-factor authentication is required for your role and can't be disabled")
+		return
+	}
+	user.TOTPEnabled = false
+	user.TOTPSecret = ""
+	if !app.updateCurrentUser(w, r, user) {
+		return
+	}
+	err := app.models.RecoveryCodes.DeleteAllForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"user": user}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// regenerateRecoveryCodesHandler replaces all recovery codes of the user
+func (app *application) regenerateRecoveryCodesHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.readSecondFactorCode(w, r)
+	if user == nil {
+		return
+	}
+	codes, err := app.models.RecoveryCodes.Generate(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"recovery_codes": codes}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
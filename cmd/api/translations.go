@@ -0,0 +1,255 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"cosmetcab.dp.ua/internal/data"
+	"cosmetcab.dp.ua/internal/validator"
+	"github.com/julienschmidt/httprouter"
+)
+
+// negotiateLanguage returns the supported language the Accept-Language
+// header prefers most, or "" when it accepts none of them. Regional
+// variants count as their language, so en-GB picks en.
+func negotiateLanguage(header string, supported []string) string {
+	best, bestQ := "", 0.0
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		lang, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(tag)), "-")
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		if q > bestQ && validator.PermittedValue(lang, supported...) {
+			best, bestQ = lang, q
+		}
+	}
+	return best
+}
+
+// language picks the language of the catalogue text for the request: the
+// lang query parameter, then the Accept-Language header and finally the
+// default language. The choice is reported in Content-Language.
+func (app *application) language(w http.ResponseWriter, r *http.Request) string {
+	lang := r.URL.Query().Get("lang")
+	if !validator.PermittedValue(lang, data.Languages...) {
+		lang = negotiateLanguage(r.Header.Get("Accept-Language"), data.Languages)
+	}
+	if lang == "" {
+		lang = app.config.defaultLanguage
+	}
+	w.Header().Add("Vary", "Accept-Language")
+	w.Header().Set("Content-Language", lang)
+	return lang
+}
+
+// translations returns the translations of the entities to lang, nothing
+// when lang is the default language the entities are stored in
+func (app *application) translations(entity, lang string, ids []int64) (map[int64]*data.Translation, error) {
+	if lang == app.config.defaultLanguage {
+		return nil, nil
+	}
+	return app.models.Translations.GetForLanguage(entity, lang, ids)
+}
+
+func (app *application) localizeCategories(lang string, categories ...*data.Category) error {
+	ids := make([]int64, len(categories))
+	for i, category := range categories {
+		ids[i] = category.ID
+	}
+	translations, err := app.translations(data.TranslationCategory, lang, ids)
+	if err != nil {
+		return err
+	}
+	for _, category := range categories {
+		category.Localize(translations[category.ID])
+	}
+	return nil
+}
+
+func (app *application) localizeSubCategories(lang string, subCategories ...*data.SubCategory) error {
+	ids := make([]int64, len(subCategories))
+	for i, subCategory := range subCategories {
+		ids[i] = subCategory.ID
+	}
+	translations, err := app.translations(data.TranslationSubCategory, lang, ids)
+	if err != nil {
+		return err
+	}
+	for _, subCategory := range subCategories {
+		subCategory.Localize(translations[subCategory.ID])
+	}
+	return nil
+}
+
+func (app *application) localizeServices(lang string, services ...*data.Service) error {
+	ids := make([]int64, len(services))
+	for i, service := range services {
+		ids[i] = service.ID
+	}
+	translations, err := app.translations(data.TranslationService, lang, ids)
+	if err != nil {
+		return err
+	}
+	for _, service := range services {
+		service.Localize(translations[service.ID])
+	}
+	return nil
+}
+
+func (app *application) localizeServicesWithSubcategories(lang string, services ...*data.ServiceWithSubcategory) error {
+	serviceIDs := make([]int64, len(services))
+	subCategoryIDs := make([]int64, len(services))
+	for i, service := range services {
+		serviceIDs[i] = service.ID
+		subCategoryIDs[i] = service.Subcategory.ID
+	}
+	serviceTranslations, err := app.translations(data.TranslationService, lang, serviceIDs)
+	if err != nil {
+		return err
+	}
+	subCategoryTranslations, err := app.translations(data.TranslationSubCategory, lang, subCategoryIDs)
+	if err != nil {
+		return err
+	}
+	for _, service := range services {
+		service.Localize(serviceTranslations[service.ID], subCategoryTranslations[service.Subcategory.ID])
+	}
+	return nil
+}
+
+// translatedEntityExists returns ErrRecordNotFound when there is no
+// entity of the kind with the id
+func (app *application) translatedEntityExists(entity string, id int64) error {
+	var err error
+	switch entity {
+	case data.TranslationCategory:
+		_, err = app.models.Categories.Get(id)
+	case data.TranslationSubCategory:
+		_, err = app.models.SubCategories.Get(id)
+	case data.TranslationService:
+		_, err = app.models.Services.Get(id)
+	}
+	return err
+}
+
+// listTranslationsHandler returns a handler listing the translations of
+// an entity of the given kind
+func (app *application) listTranslationsHandler(entity string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := app.readIDParam(r)
+		if err != nil {
+			app.notFoundResponse(w, r)
+			return
+		}
+		err = app.translatedEntityExists(entity, id)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				app.notFoundResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+		translations, err := app.models.Translations.GetAll(entity, id)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		err = app.writeJSON(w, http.StatusOK, envelope{"default_language": app.config.defaultLanguage, "translations": translations}, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+	}
+}
+
+// setTranslationHandler returns a handler adding or replacing the
+// translation of an entity of the given kind to the language in the URL
+func (app *application) setTranslationHandler(entity string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := app.readIDParam(r)
+		if err != nil {
+			app.notFoundResponse(w, r)
+			return
+		}
+		err = app.translatedEntityExists(entity, id)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				app.notFoundResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+		var input struct {
+			Title       string `json:"title"`
+			Description string `json:"description"`
+			Name        string `json:"name"`
+		}
+		err = app.readJSON(w, r, &input)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+		translation := &data.Translation{
+			Lang:        httprouter.ParamsFromContext(r.Context()).ByName("lang"),
+			Title:       input.Title,
+			Description: input.Description,
+			Name:        input.Name,
+		}
+		v := validator.New()
+		v.Check(translation.Lang != app.config.defaultLanguage, "lang", "the default language is edited on the entity itself")
+		if data.ValidateTranslation(v, entity, translation); !v.Valid() {
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+		err = app.models.Translations.Set(entity, id, translation)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		// translations are recorded under the entity they belong to
+		app.audit(r, data.AuditUpdate, entity+"_translation", id, nil, translation)
+		err = app.writeJSON(w, http.StatusOK, envelope{"translation": translation}, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+	}
+}
+
+// deleteTranslationHandler returns a handler removing the translation of
+// an entity of the given kind, so it falls back to the default language
+func (app *application) deleteTranslationHandler(entity string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := app.readIDParam(r)
+		if err != nil {
+			app.notFoundResponse(w, r)
+			return
+		}
+		lang := httprouter.ParamsFromContext(r.Context()).ByName("lang")
+		err = app.models.Translations.Delete(entity, id, lang)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				app.notFoundResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+		app.audit(r, data.AuditDelete, entity+"_translation", id, &data.Translation{Lang: lang}, nil)
+		err = app.writeJSON(w, http.StatusOK, envelope{"message": "translation successfully deleted"}, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+	}
+}
@@ -0,0 +1,17 @@
+package main
+
+import (
+	"testing"
+
+	"cosmetcab.dp.ua/internal/assert"
+	"cosmetcab.dp.ua/internal/data"
+)
+
+func TestNegotiateLanguage(t *testing.T) {
+	assert.Equal(t, negotiateLanguage("", data.Languages), "")
+	assert.Equal(t, negotiateLanguage("en-GB,en;q=0.9", data.Languages), "en")
+	assert.Equal(t, negotiateLanguage("de-DE, ru;q=0.5, uk;q=0.8", data.Languages), "uk")
+	assert.Equal(t, negotiateLanguage("fr, de;q=0.7", data.Languages), "")
+	assert.Equal(t, negotiateLanguage("en;q=0, ru;q=0.1", data.Languages), "ru")
+	assert.Equal(t, negotiateLanguage("*", data.Languages), "")
+}
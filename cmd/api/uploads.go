@@ -0,0 +1,322 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"cosmetcab.dp.ua/internal/blobstore"
+	"cosmetcab.dp.ua/internal/data"
+	"cosmetcab.dp.ua/internal/validator"
+	"github.com/julienschmidt/httprouter"
+)
+
+// maxUploadSize is the largest photo accepted through a pre-signed URL,
+// the same as for multipart forms
+const maxUploadSize = 10 << 20
+
+var errUploadTooLarge = errors.New("the uploaded file is too large")
+
+const (
+	uploadCleanupInterval = 10 * time.Minute
+	// uploadCleanupGrace keeps expired uploads for a while, so that a
+	// confirmation started just before the expiry can finish
+	uploadCleanupGrace = 5 * time.Minute
+)
+
+// startUploadCleanup periodically removes uploads that were never
+// confirmed together with their blobs
+func (app *application) startUploadCleanup(ctx context.Context) {
+	app.wg.Add(1)
+	go func() {
+		defer app.wg.Done()
+		ticker := time.NewTicker(uploadCleanupInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				blobNames, err := app.models.Uploads.DeleteExpired(uploadCleanupGrace)
+				if err != nil {
+					app.logger.Error("Error deleting expired uploads", "err", err)
+					continue
+				}
+				for _, blobName := range blobNames {
+					// most expired uploads were never sent at all
+					exists, err := app.uploadStorage.BlobExists(blobName)
+					if err != nil {
+						app.logger.Error("Error checking an expired upload", "blob", blobName, "err", err)
+						continue
+					}
+					if exists {
+						app.deleteUpload(blobName)
+					}
+				}
+				if len(blobNames) > 0 {
+					app.logger.Info("deleted expired uploads", "count", len(blobNames))
+				}
+			}
+		}
+	}()
+}
+
+// deleteUpload queues deletion of a blob in the upload storage
+func (app *application) deleteUpload(blobName string) {
+	_, err := app.enqueueJob(jobDeleteUpload, blobJobPayload{BlobName: blobName}, nil)
+	if err != nil {
+		app.logAndSendErr("upload deletion was not queued", blobName, err)
+	}
+}
+
+// createUploadHandler issues a short-lived pre-signed URL the client
+// uploads a photo to without passing it through the API. The photo goes
+// to the private upload storage and is attached once the upload is
+// confirmed, see attachCategoryPhotoHandler.
+func (app *application) createUploadHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		FileName string `json:"file_name"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	blobName, err := generateUniqueImageName(input.FileName)
+	if err != nil {
+		v.AddError("file_name", "must have an image extension")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	upload := &data.Upload{
+		BlobName: blobName,
+		UserID:   app.contextGetUserID(r),
+		// the database keeps whole seconds
+		ExpiresAt: time.Now().Add(app.config.storage.uploadTTL).Truncate(time.Second),
+	}
+	presigned, err := app.uploadStorage.PresignUpload(upload.BlobName, upload.ExpiresAt)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.models.Uploads.Insert(upload)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusCreated, envelope{"upload": upload, "presigned_upload": presigned}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// receiveUploadHandler stores a photo sent to a pre-signed URL of the
+// local upload storage. The body is streamed to the disk. With Azure the
+// photos are sent to the storage itself and the route doesn't exist.
+func (app *application) receiveUploadHandler(w http.ResponseWriter, r *http.Request) {
+	local, ok := app.uploadStorage.(*blobstore.LocalBlobStorage)
+	if !ok {
+		app.notFoundResponse(w, r)
+		return
+	}
+	blobName := httprouter.ParamsFromContext(r.Context()).ByName("blob_name")
+	query := r.URL.Query()
+	if !local.VerifyUpload(blobName, query.Get("expires"), query.Get("signature")) {
+		app.invalidUploadURLResponse(w, r)
+		return
+	}
+	// a confirmed upload must not be replaced
+	_, err := app.models.Uploads.GetByBlobName(blobName)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.invalidUploadURLResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	// a large photo may take longer than the server read timeout, the
+	// error only means the deadline couldn't be changed
+	_ = http.NewResponseController(w).SetReadDeadline(time.Now().Add(time.Minute))
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize)
+	err = local.UploadBlob(blobName, r.Body)
+	if err != nil {
+		local.DeleteBlob(blobName)
+		var maxBytesError *http.MaxBytesError
+		switch {
+		case errors.As(err, &maxBytesError):
+			app.errorResponse(w, r, http.StatusRequestEntityTooLarge, fmt.Sprintf("the photo must not be larger than %d bytes", maxUploadSize))
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "photo successfully uploaded"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// uploadReader streams an uploaded blob. Reading fails with
+// errUploadTooLarge past maxUploadSize, a limit the Azure SAS can't
+// enforce on the client.
+type uploadReader struct {
+	body      io.ReadCloser
+	remaining int64
+}
+
+// readUpload opens an uploaded blob. ErrBlobNotFound is returned when
+// nothing was uploaded.
+func (app *application) readUpload(blobName string) (*uploadReader, error) {
+	body, err := app.uploadStorage.DownloadBlob(blobName)
+	if err != nil {
+		return nil, err
+	}
+	return &uploadReader{body: body, remaining: maxUploadSize}, nil
+}
+
+func (u *uploadReader) Read(p []byte) (int, error) {
+	if u.remaining < 0 {
+		return 0, errUploadTooLarge
+	}
+	// one byte more than allowed tells whether the blob is too large
+	if int64(len(p)) > u.remaining+1 {
+		p = p[:u.remaining+1]
+	}
+	n, err := u.body.Read(p)
+	if int64(n) <= u.remaining {
+		u.remaining -= int64(n)
+		return n, err
+	}
+	n = int(u.remaining)
+	u.remaining = -1
+	return n, errUploadTooLarge
+}
+
+// tooLarge reports whether reading stopped at the size limit. Decoders
+// don't pass read errors on reliably, so it is checked when they fail.
+func (u *uploadReader) tooLarge() bool {
+	return u.remaining < 0
+}
+
+func (u *uploadReader) Close() error {
+	return u.body.Close()
+}
+
+// attachCategoryPhotoHandler confirms a pre-signed upload and makes the
+// photo the photo of the category. The uploaded blob is checked to be an
+// image and resized like photos sent in forms; the original is deleted.
+func (app *application) attachCategoryPhotoHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	category, err := app.models.Categories.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	before := snapshot(category)
+	var input struct {
+		UploadID int64 `json:"upload_id"`
+	}
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	upload, err := app.models.Uploads.Get(input.UploadID)
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	// other users' uploads are reported as missing
+	if err != nil || upload.UserID != app.contextGetUserID(r) {
+		v.AddError("upload_id", "must be an upload that wasn't confirmed yet")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	if upload.Expired() {
+		v.AddError("upload_id", "the upload has expired")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	content, err := app.readUpload(upload.BlobName)
+	if err != nil {
+		switch {
+		case errors.Is(err, blobstore.ErrBlobNotFound):
+			v.AddError("upload_id", "the photo wasn't uploaded")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	images, err := processImage(content)
+	content.Close()
+	if err != nil {
+		switch {
+		case content.tooLarge():
+			v.AddError("upload_id", fmt.Sprintf("the photo must not be larger than %d bytes", maxUploadSize))
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, errInvalidImage):
+			v.AddError("upload_id", invalidImageMessage)
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	// deleting the upload claims it, a concurrent confirmation fails here
+	err = app.models.Uploads.Delete(upload.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("upload_id", "must be an upload that wasn't confirmed yet")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	// only the resized variants are kept
+	defer app.deleteUpload(upload.BlobName)
+
+	variants := newPhotoVariants(upload.BlobName, images)
+	err = app.uploadPhotoVariants(variants)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	oldPhotoURL, oldPhotos := category.PhotoURL, category.Photos
+	category.Photos = app.photoVariantURLs(variants)
+	category.PhotoURL = category.Photos["hero"]
+	err = app.models.Categories.Update(category)
+	if err != nil {
+		app.discardPhotoVariants(variants)
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	app.audit(r, data.AuditUpdate, auditCategory, category.ID, before, category)
+	if oldPhotoURL != "" {
+		app.deletePhotos(oldPhotoURL, oldPhotos)
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"category": category}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"cosmetcab.dp.ua/internal/assert"
+)
+
+func TestUploadReader(t *testing.T) {
+	content := strings.Repeat("a", maxUploadSize)
+	upload := &uploadReader{body: io.NopCloser(strings.NewReader(content)), remaining: maxUploadSize}
+	read, err := io.ReadAll(upload)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, len(read), maxUploadSize)
+	assert.Equal(t, upload.tooLarge(), false)
+
+	// the limit is enforced while the blob is read
+	upload = &uploadReader{body: io.NopCloser(strings.NewReader(content + "a")), remaining: maxUploadSize}
+	read, err = io.ReadAll(upload)
+	assert.Equal(t, err, errUploadTooLarge)
+	assert.Equal(t, len(read), maxUploadSize)
+	assert.Equal(t, upload.tooLarge(), true)
+}
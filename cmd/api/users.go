@@ -3,16 +3,23 @@ package main
 import (
 	"errors"
 	"net/http"
+	"time"
 
 	"cosmetcab.dp.ua/internal/data"
 	"cosmetcab.dp.ua/internal/validator"
 )
 
+const (
+	activationTokenTTL    = 3 * 24 * time.Hour
+	passwordResetTokenTTL = 45 * time.Minute
+)
+
 func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Request) {
 	var input struct {
 		Name     string `json:"name"`
 		Email    string `json:"email"`
 		Password string `json:"password"`
+		Role     string `json:"role"`
 	}
 
 	err := app.readJSON(w, r, &input)
@@ -20,11 +27,15 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 		app.badRequestResponse(w, r, err)
 		return
 	}
+	if input.Role == "" {
+		input.Role = data.RoleViewer
+	}
 
 	user := &data.User{
 		Name:      input.Name,
 		Email:     input.Email,
-		Activated: true,
+		Activated: false,
+		Role:      input.Role,
 	}
 
 	err = user.Password.Set(input.Password)
@@ -49,13 +60,27 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 		}
 		return
 	}
+	app.audit(r, data.AuditCreate, auditUser, user.ID, nil, user)
+	token, err := app.models.Tokens.New(user.ID, activationTokenTTL, data.ScopeActivation)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	app.sendEmail(user.Email, "user_welcome.tmpl", map[string]any{
+		"name":            user.Name,
+		"userID":          user.ID,
+		"activationToken": token.Plaintext,
+	})
 	err = app.writeJSON(w, http.StatusCreated, envelope{"user": user}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 }
 
-func (app *application) loginHandler(w http.ResponseWriter, r *http.Request) {
+// verifyCredentials reads an email and password from the request body and
+// returns the matching active user. On failure the error response has
+// already been sent and nil is returned.
+func (app *application) verifyCredentials(w http.ResponseWriter, r *http.Request) *data.User {
 	var input struct {
 		Email    string `json:"email"`
 		Password string `json:"password"`
@@ -63,46 +88,96 @@ func (app *application) loginHandler(w http.ResponseWriter, r *http.Request) {
 	err := app.readJSON(w, r, &input)
 	if err != nil {
 		app.badRequestResponse(w, r, err)
-		return
+		return nil
 	}
 	v := validator.New()
 	data.ValidateEmail(v, input.Email)
 	data.ValidatePasswordPlaintext(v, input.Password)
 	if !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
-		return
+		return nil
+	}
+	if !app.checkLoginThrottle(w, r, input.Email) {
+		return nil
 	}
 	user, err := app.models.Users.GetByEmail(input.Email)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
-			app.invalidCredentialsResponse(w, r)
+			// unknown emails count as failures too, so probing for
+			// accounts is throttled the same way as guessing passwords
+			app.failedLoginResponse(w, r, input.Email)
 		default:
 			app.serverErrorResponse(w, r, err)
 		}
-		return
-	}
-	if !user.Activated {
-		app.inactiveAccountResponse(w, r)
-		return
+		return nil
 	}
 	match, err := user.Password.Matches(input.Password)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
-		return
+		return nil
 	}
 	if !match {
-		app.invalidCredentialsResponse(w, r)
+		app.failedLoginResponse(w, r, input.Email)
+		return nil
+	}
+	if !user.Activated {
+		app.inactiveAccountResponse(w, r)
+		return nil
+	}
+	if user.PasswordChangeRequired {
+		app.passwordChangeRequiredResponse(w, r)
+		return nil
+	}
+	// with two-factor authentication the failures are only forgotten once
+	// the code was checked too, otherwise they could be reset by anyone
+	// knowing the password in between guessing codes
+	if !user.TOTPEnabled {
+		err = app.resetLoginFailures(user.Email)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return nil
+		}
+	}
+	return user
+}
+
+func (app *application) loginHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.verifyCredentials(w, r)
+	if user == nil {
 		return
 	}
-	session, err := app.sessionManager.Get(r, "cookie-auth")
+	if user.TOTPEnabled {
+		app.twoFactorChallengeResponse(w, r, user)
+		return
+	}
+	app.startSession(w, r, user)
+}
+
+// startSession logs the user in with a new session cookie
+func (app *application) startSession(w http.ResponseWriter, r *http.Request, user *data.User) {
+	session, err := app.sessionManager.Get(r, sessionCookieName)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 
 	}
-	session.Values["authenticated"] = true
-	session.Options.MaxAge = 3600
+	// rotate the session on login, so a session identifier planted
+	// before authentication can't be used to take over the account
+	if !session.IsNew {
+		session.Options.MaxAge = -1
+		err = session.Save(r, w)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		session, err = app.sessionManager.New(r, sessionCookieName)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+	session.Values["user_id"] = user.ID
 	err = session.Save(r, w)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
@@ -112,11 +187,10 @@ func (app *application) loginHandler(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
-
 }
 
 func (app *application) logoutHandler(w http.ResponseWriter, r *http.Request) {
-	session, err := app.sessionManager.Get(r, "cookie-auth")
+	session, err := app.sessionManager.Get(r, sessionCookieName)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
@@ -133,3 +207,259 @@ func (app *application) logoutHandler(w http.ResponseWriter, r *http.Request) {
 
 	}
 }
+
+// currentUser returns the authenticated user. On failure the error
+// response has already been sent and nil is returned.
+func (app *application) currentUser(w http.ResponseWriter, r *http.Request) *data.User {
+	user, err := app.models.Users.Get(app.contextGetUserID(r))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.unauthorizedUserResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil
+	}
+	return user
+}
+
+// updateCurrentUser saves changes of the authenticated user
+func (app *application) updateCurrentUser(w http.ResponseWriter, r *http.Request, user *data.User) bool {
+	err := app.models.Users.Update(user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return false
+	}
+	return true
+}
+
+// showCurrentUserHandler returns the logged in user with the permissions of their role
+func (app *application) showCurrentUserHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.currentUser(w, r)
+	if user == nil {
+		return
+	}
+	permissions, err := app.models.Permissions.GetAllForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"user": user, "permissions": permissions}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		TokenPlaintext string `json:"token"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	if data.ValidateTokenPlaintext(v, input.TokenPlaintext); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	user, err := app.models.Users.GetForToken(data.ScopeActivation, input.TokenPlaintext)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("token", "invalid or expired activation token")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	user.Activated = true
+	err = app.models.Users.Update(user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.models.Tokens.DeleteAllForUser(data.ScopeActivation, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"user": user}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// createActivationTokenHandler sends a new activation token to a user
+// whose previous one expired
+func (app *application) createActivationTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email string `json:"email"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	if data.ValidateEmail(v, input.Email); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	user, err := app.models.Users.GetByEmail(input.Email)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("email", "no matching email address found")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	if user.Activated {
+		v.AddError("email", "user has already been activated")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	token, err := app.models.Tokens.New(user.ID, activationTokenTTL, data.ScopeActivation)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	app.sendEmail(user.Email, "token_activation.tmpl", map[string]any{
+		"activationToken": token.Plaintext,
+	})
+	env := envelope{"message": "an email will be sent to you containing activation instructions"}
+	err = app.writeJSON(w, http.StatusAccepted, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) createPasswordResetTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email string `json:"email"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	if data.ValidateEmail(v, input.Email); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	user, err := app.models.Users.GetByEmail(input.Email)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("email", "no matching email address found")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	if !user.Activated {
+		v.AddError("email", "user account must be activated")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	token, err := app.models.Tokens.New(user.ID, passwordResetTokenTTL, data.ScopePasswordReset)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	app.sendEmail(user.Email, "token_password_reset.tmpl", map[string]any{
+		"passwordResetToken": token.Plaintext,
+	})
+	env := envelope{"message": "an email will be sent to you containing password reset instructions"}
+	err = app.writeJSON(w, http.StatusAccepted, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateUserPasswordHandler sets a new password using a password reset
+// token. All sessions and bearer tokens of the user are revoked, so
+// whoever knew the old password is logged out.
+func (app *application) updateUserPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Password       string `json:"password"`
+		TokenPlaintext string `json:"token"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	data.ValidatePasswordPlaintext(v, input.Password)
+	data.ValidateTokenPlaintext(v, input.TokenPlaintext)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	user, err := app.models.Users.GetForToken(data.ScopePasswordReset, input.TokenPlaintext)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("token", "invalid or expired password reset token")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = user.Password.Set(input.Password)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	user.PasswordChangeRequired = false
+	err = app.models.Users.Update(user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.models.Tokens.DeleteAllForUser(data.ScopePasswordReset, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.models.Tokens.DeleteAllForUser(data.ScopeAuthentication, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.models.Sessions.DeleteAllForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	env := envelope{"message": "your password was successfully reset"}
+	err = app.writeJSON(w, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,83 @@
+// Command reconcile compares the blob storage with the photo URLs in the
+// database and reports orphaned blobs and missing photos. It can delete
+// the orphans and flag categories whose photo is missing.
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"log/slog"
+	"os"
+	"time"
+
+	"cosmetcab.dp.ua/internal/blobstore"
+	"cosmetcab.dp.ua/internal/data"
+	"cosmetcab.dp.ua/internal/reconcile"
+	"github.com/joho/godotenv"
+	_ "github.com/lib/pq"
+)
+
+type config struct {
+	dsn     string
+	storage blobstore.Config
+	reconcile.Options
+}
+
+func main() {
+	_ = godotenv.Load(".env")
+
+	var cfg config
+	flag.StringVar(&cfg.dsn, "db-dsn", os.Getenv("LABBEAUTY_DB_DSN"), "PostgreSQL DSN")
+	flag.StringVar(&cfg.storage.Backend, "storage", "azure", "Blob storage backend (azure|local)")
+	flag.StringVar(&cfg.storage.Dir, "storage-dir", "./ui/static/uploads", "Directory for the local blob storage backend")
+	flag.BoolVar(&cfg.DeleteOrphans, "delete-orphans", false, "Delete blobs no record refers to")
+	flag.BoolVar(&cfg.FlagCategories, "flag-categories", false, "Flag categories whose photo is missing and clear the flag of the others")
+	flag.BoolVar(&cfg.DryRun, "dry-run", false, "Report what would be deleted and flagged without changing anything")
+	flag.DurationVar(&cfg.MinAge, "min-age", reconcile.DefaultMinAge, "Blobs modified more recently are never reported as orphans")
+	flag.Parse()
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+
+	storage, err := blobstore.Open(cfg.storage, context.Background())
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+
+	db, err := openDB(cfg.dsn)
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	report, err := reconcile.Run(storage, data.NewModels(db), cfg.Options)
+	if report != nil {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "\t")
+		if encodeErr := encoder.Encode(report); encodeErr != nil {
+			logger.Error(encodeErr.Error())
+		}
+	}
+	if err != nil {
+		logger.Error(err.Error())
+		db.Close()
+		os.Exit(1)
+	}
+}
+
+func openDB(dsn string) (*sql.DB, error) {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err = db.PingContext(ctx)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
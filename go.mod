@@ -6,14 +6,15 @@ require github.com/julienschmidt/httprouter v1.3.0
 
 require github.com/lib/pq v1.10.9
 
-require golang.org/x/time v0.3.0
-
 require (
-	github.com/gorilla/securecookie v1.1.2 // indirect
-	github.com/gorilla/sessions v1.2.2 // indirect
-	github.com/justinas/alice v1.2.0 // indirect
+	github.com/gorilla/sessions v1.2.2
+	github.com/justinas/alice v1.2.0
+	golang.org/x/image v0.18.0
+	golang.org/x/time v0.3.0
 )
 
+require github.com/gorilla/securecookie v1.1.2 // indirect
+
 require (
 	github.com/Azure/azure-sdk-for-go/sdk/azcore v1.7.1
 	github.com/Azure/azure-sdk-for-go/sdk/azidentity v1.3.1
@@ -28,5 +29,5 @@ require (
 	golang.org/x/crypto v0.14.0
 	golang.org/x/net v0.14.0 // indirect
 	golang.org/x/sys v0.13.0 // indirect
-	golang.org/x/text v0.13.0 // indirect
+	golang.org/x/text v0.16.0 // indirect
 )
@@ -0,0 +1,325 @@
+// Package blobstore keeps uploaded photos in Azure Blob Storage or on the
+// local disk.
+package blobstore
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/sas"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/service"
+)
+
+var ErrBlobNotFound = errors.New("blob not found")
+
+// BlobStore is implemented by every storage backend that can hold
+// uploaded photos.
+type BlobStore interface {
+	UploadBlob(blobName string, file io.Reader) error
+	DownloadBlob(blobName string) (io.ReadCloser, error)
+	DeleteBlob(blobName string) error
+	BlobExists(blobName string) (bool, error)
+	BlobURL(blobName string) string
+	PresignUpload(blobName string, expiresAt time.Time) (*PresignedUpload, error)
+	ListBlobs() ([]*Blob, error)
+}
+
+// Blob is a stored blob as listed by ListBlobs
+type Blob struct {
+	Name         string
+	LastModified time.Time
+}
+
+// BlobNameFromURL returns the blob name that a photo URL points to.
+// Blob names are generated by the API from UUIDs and never contain
+// slashes, so the last path segment is the name for every backend.
+func BlobNameFromURL(photoURL string) string {
+	return path.Base(photoURL)
+}
+
+// PresignedUpload tells a client how to upload a blob straight to the
+// storage: the content is sent with the method to the URL together with
+// the headers. The URL can't be used after it expires.
+type PresignedUpload struct {
+	URL       string            `json:"url"`
+	Method    string            `json:"method"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	ExpiresAt time.Time         `json:"expires_at"`
+}
+
+type AzureBlobStorage struct {
+	client        *azblob.Client
+	ctx           context.Context
+	blobURL       string
+	containerName string
+}
+
+func NewAzureBlobStorage(blobURL, containerName string, credential azcore.TokenCredential, ctx context.Context) (*AzureBlobStorage, error) {
+	client, err := azblob.NewClient(blobURL, credential, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &AzureBlobStorage{client: client, ctx: ctx, blobURL: blobURL, containerName: containerName}, nil
+}
+
+// UploadBlob streams the content to the blob in blocks rather than
+// reading all of it into memory first. A failed upload is retried only
+// when the content can be rewound.
+func (abs *AzureBlobStorage) UploadBlob(blobName string, file io.Reader) error {
+	seeker, rewindable := file.(io.Seeker)
+	attempts := 1
+	if rewindable {
+		attempts = 3
+	}
+	var err error
+	for i := 1; i <= attempts; i++ {
+		if i > 1 {
+			time.Sleep(1 * time.Second)
+			if _, err = seeker.Seek(0, io.SeekStart); err != nil {
+				return err
+			}
+		}
+		_, err = abs.client.UploadStream(abs.ctx, abs.containerName, blobName, file, &azblob.UploadStreamOptions{})
+		if nil == err {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("failed to upload a blob after %d attempts: %w", attempts, err)
+
+}
+
+func (abs *AzureBlobStorage) DownloadBlob(blobName string) (io.ReadCloser, error) {
+	response, err := abs.client.DownloadStream(abs.ctx, abs.containerName, blobName, nil)
+	if err != nil {
+		if bloberror.HasCode(err, bloberror.BlobNotFound) {
+			return nil, ErrBlobNotFound
+		}
+		return nil, err
+	}
+	return response.Body, nil
+}
+
+func (abs *AzureBlobStorage) DeleteBlob(blobName string) error {
+
+	for i := 1; i <= 3; i++ {
+		_, err := abs.client.DeleteBlob(abs.ctx, abs.containerName, blobName, nil)
+		if nil == err || bloberror.HasCode(err, bloberror.BlobNotFound) {
+			return nil
+		}
+		time.Sleep(1 * time.Second)
+	}
+	return errors.New("failed to delete a blob after 3 attempts")
+
+}
+
+func (abs *AzureBlobStorage) BlobExists(blobName string) (bool, error) {
+	blobClient := abs.client.ServiceClient().NewContainerClient(abs.containerName).NewBlobClient(blobName)
+	_, err := blobClient.GetProperties(abs.ctx, nil)
+	if err != nil {
+		if bloberror.HasCode(err, bloberror.BlobNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func (abs *AzureBlobStorage) BlobURL(blobName string) string {
+	return abs.blobURL + abs.containerName + blobName
+}
+
+func (abs *AzureBlobStorage) ListBlobs() ([]*Blob, error) {
+	blobs := []*Blob{}
+	pager := abs.client.NewListBlobsFlatPager(abs.containerName, nil)
+	for pager.More() {
+		page, err := pager.NextPage(abs.ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range page.Segment.BlobItems {
+			blob := &Blob{Name: *item.Name}
+			if item.Properties != nil && item.Properties.LastModified != nil {
+				blob.LastModified = *item.Properties.LastModified
+			}
+			blobs = append(blobs, blob)
+		}
+	}
+	return blobs, nil
+}
+
+// PresignUpload issues a SAS allowing only the creation of the blob. The
+// client authenticates with Azure AD rather than an account key, so the
+// SAS is signed with a user delegation key.
+func (abs *AzureBlobStorage) PresignUpload(blobName string, expiresAt time.Time) (*PresignedUpload, error) {
+	// the start is set in the past to allow for clock skew
+	start := time.Now().UTC().Add(-5 * time.Minute)
+	expiry := expiresAt.UTC()
+	credential, err := abs.client.ServiceClient().GetUserDelegationCredential(abs.ctx, service.KeyInfo{
+		Start:  to.Ptr(start.Format(sas.TimeFormat)),
+		Expiry: to.Ptr(expiry.Format(sas.TimeFormat)),
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+	query, err := sas.BlobSignatureValues{
+		Protocol:      sas.ProtocolHTTPS,
+		StartTime:     start,
+		ExpiryTime:    expiry,
+		Permissions:   (&sas.BlobPermissions{Create: true, Write: true}).String(),
+		ContainerName: strings.Trim(abs.containerName, "/"),
+		BlobName:      blobName,
+	}.SignWithUserDelegation(credential)
+	if err != nil {
+		return nil, err
+	}
+	return &PresignedUpload{
+		URL:       abs.BlobURL(blobName) + "?" + query.Encode(),
+		Method:    http.MethodPut,
+		Headers:   map[string]string{"x-ms-blob-type": "BlockBlob"},
+		ExpiresAt: expiry,
+	}, nil
+}
+
+// LocalBlobStorage keeps blobs on the local disk. The directory of photos is
+// expected to live under ./ui/static so that files are served by the /static
+// file server, while pre-signed uploads go to a directory that isn't served.
+// They are received by the API itself and their URLs are signed with the
+// signing key.
+type LocalBlobStorage struct {
+	dir        string
+	urlPrefix  string
+	signingKey []byte
+}
+
+func NewLocalBlobStorage(dir, urlPrefix string, signingKey []byte) (*LocalBlobStorage, error) {
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return nil, err
+	}
+	return &LocalBlobStorage{dir: dir, urlPrefix: urlPrefix, signingKey: signingKey}, nil
+}
+
+func (lbs *LocalBlobStorage) path(blobName string) string {
+	// filepath.Base prevents blob names from escaping the storage directory
+	return filepath.Join(lbs.dir, filepath.Base(blobName))
+}
+
+func (lbs *LocalBlobStorage) UploadBlob(blobName string, file io.Reader) error {
+	dst, err := os.Create(lbs.path(blobName))
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+
+	_, err = io.Copy(dst, file)
+	return err
+}
+
+func (lbs *LocalBlobStorage) DownloadBlob(blobName string) (io.ReadCloser, error) {
+	file, err := os.Open(lbs.path(blobName))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, ErrBlobNotFound
+		}
+		return nil, err
+	}
+	return file, nil
+}
+
+// DeleteBlob removes the file. A file that is already gone counts as
+// deleted, so a retried deletion job doesn't fail forever.
+func (lbs *LocalBlobStorage) DeleteBlob(blobName string) error {
+	err := os.Remove(lbs.path(blobName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (lbs *LocalBlobStorage) BlobExists(blobName string) (bool, error) {
+	_, err := os.Stat(lbs.path(blobName))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func (lbs *LocalBlobStorage) BlobURL(blobName string) string {
+	return lbs.urlPrefix + blobName
+}
+
+func (lbs *LocalBlobStorage) ListBlobs() ([]*Blob, error) {
+	entries, err := os.ReadDir(lbs.dir)
+	if err != nil {
+		return nil, err
+	}
+	blobs := []*Blob{}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			// the file was deleted since the directory was read
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return nil, err
+		}
+		blobs = append(blobs, &Blob{Name: entry.Name(), LastModified: info.ModTime()})
+	}
+	return blobs, nil
+}
+
+// PresignUpload returns an URL of the API relative to its address. The
+// blob name and expiry are signed, so the URL can't be changed to upload
+// another blob or to upload later.
+func (lbs *LocalBlobStorage) PresignUpload(blobName string, expiresAt time.Time) (*PresignedUpload, error) {
+	expires := strconv.FormatInt(expiresAt.Unix(), 10)
+	query := url.Values{
+		"expires":   {expires},
+		"signature": {lbs.sign(blobName, expires)},
+	}
+	return &PresignedUpload{
+		URL:       "/uploads/" + url.PathEscape(blobName) + "?" + query.Encode(),
+		Method:    http.MethodPut,
+		ExpiresAt: time.Unix(expiresAt.Unix(), 0).UTC(),
+	}, nil
+}
+
+// VerifyUpload reports whether the expiry and signature of a pre-signed
+// URL were issued for the blob by PresignUpload and haven't expired
+func (lbs *LocalBlobStorage) VerifyUpload(blobName, expires, signature string) bool {
+	unix, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || !time.Now().Before(time.Unix(unix, 0)) {
+		return false
+	}
+	return hmac.Equal([]byte(signature), []byte(lbs.sign(blobName, expires)))
+}
+
+func (lbs *LocalBlobStorage) sign(blobName, expires string) string {
+	mac := hmac.New(sha256.New, lbs.signingKey)
+	mac.Write([]byte(blobName + "\n" + expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,87 @@
+package blobstore
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"cosmetcab.dp.ua/internal/assert"
+)
+
+// TestLocalBlobStorage tests upload, exists and delete on the local backend
+func TestLocalBlobStorage(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewLocalBlobStorage(dir, "/static/uploads/", []byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = store.UploadBlob("photo.png", strings.NewReader("image"))
+	assert.Equal(t, err, nil)
+
+	content, err := os.ReadFile(filepath.Join(dir, "photo.png"))
+	assert.Equal(t, err, nil)
+	assert.Equal(t, string(content), "image")
+
+	exists, err := store.BlobExists("photo.png")
+	assert.Equal(t, err, nil)
+	assert.Equal(t, exists, true)
+	assert.Equal(t, store.BlobURL("photo.png"), "/static/uploads/photo.png")
+	assert.Equal(t, BlobNameFromURL(store.BlobURL("photo.png")), "photo.png")
+
+	err = store.DeleteBlob("photo.png")
+	assert.Equal(t, err, nil)
+	exists, err = store.BlobExists("photo.png")
+	assert.Equal(t, err, nil)
+	assert.Equal(t, exists, false)
+	// deleting it again succeeds, so retried deletions don't fail
+	err = store.DeleteBlob("photo.png")
+	assert.Equal(t, err, nil)
+}
+
+// TestLocalPresignUpload tests that upload URLs only verify for the blob
+// and expiry they were signed for
+func TestLocalPresignUpload(t *testing.T) {
+	store, err := NewLocalBlobStorage(t.TempDir(), "/static/uploads/", []byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	presigned, err := store.PresignUpload("photo.png", time.Now().Add(time.Minute))
+	assert.Equal(t, err, nil)
+	assert.Equal(t, presigned.Method, http.MethodPut)
+	u, err := url.Parse(presigned.URL)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, u.Path, "/uploads/photo.png")
+	expires, signature := u.Query().Get("expires"), u.Query().Get("signature")
+
+	assert.Equal(t, store.VerifyUpload("photo.png", expires, signature), true)
+	assert.Equal(t, store.VerifyUpload("other.png", expires, signature), false)
+	later := strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10)
+	assert.Equal(t, store.VerifyUpload("photo.png", later, signature), false)
+
+	expired, err := store.PresignUpload("photo.png", time.Now().Add(-time.Minute))
+	assert.Equal(t, err, nil)
+	u, err = url.Parse(expired.URL)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, store.VerifyUpload("photo.png", u.Query().Get("expires"), u.Query().Get("signature")), false)
+}
+
+// TestOpenLocalDirs tests that photos are kept inside StaticDir
+// and uploads outside of it
+func TestOpenLocalDirs(t *testing.T) {
+	_, err := Open(Config{Backend: "local", Dir: t.TempDir()}, context.Background())
+	assert.Equal(t, err != nil, true)
+
+	_, err = OpenUploads(Config{Backend: "local", UploadDir: StaticDir + "/uploads"}, context.Background())
+	assert.Equal(t, err != nil, true)
+
+	_, err = Open(Config{Backend: "s3"}, context.Background())
+	assert.Equal(t, err != nil, true)
+}
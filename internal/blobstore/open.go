@@ -0,0 +1,95 @@
+package blobstore
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/joho/godotenv"
+)
+
+// StaticDir is served by the API under /static/. Photos kept by the local
+// backend live inside it, pre-signed uploads never do.
+const StaticDir = "./ui/static"
+
+// Config selects the storage backend shared by the API and the
+// reconciliation command. The Azure account and containers are read from
+// the BLOB_URL, CONTAINER_NAME and UPLOAD_CONTAINER_NAME environment
+// variables, which may be set in .env.
+type Config struct {
+	// Backend is azure or local
+	Backend string
+	// Dir keeps the photos of the local backend
+	Dir string
+	// UploadDir keeps the pre-signed uploads of the local backend until
+	// they are confirmed
+	UploadDir string
+	// SigningSecret signs upload URLs of the local backend. Without it a
+	// random key is used and the URLs stop working on restart.
+	SigningSecret string
+}
+
+func envVariable(key string) string {
+	_ = godotenv.Load(".env")
+	return os.Getenv(key)
+}
+
+// Open opens the storage the photos are kept in
+func Open(cfg Config, ctx context.Context) (BlobStore, error) {
+	switch cfg.Backend {
+	case "azure":
+		credential, err := azidentity.NewDefaultAzureCredential(nil)
+		if err != nil {
+			return nil, err
+		}
+		return NewAzureBlobStorage(envVariable("BLOB_URL"), envVariable("CONTAINER_NAME"), credential, ctx)
+	case "local":
+		// local blobs are served by the /static file server, so the
+		// directory has to live inside StaticDir
+		rel, err := filepath.Rel(StaticDir, cfg.Dir)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			return nil, fmt.Errorf("storage directory %q must be inside %q", cfg.Dir, StaticDir)
+		}
+		return NewLocalBlobStorage(cfg.Dir, "/static/"+filepath.ToSlash(rel)+"/", nil)
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", cfg.Backend)
+	}
+}
+
+// OpenUploads opens the storage pre-signed uploads are sent to. The
+// originals still carry their EXIF data, GPS position included, so they
+// must not be readable by the public like the photos are.
+func OpenUploads(cfg Config, ctx context.Context) (BlobStore, error) {
+	switch cfg.Backend {
+	case "azure":
+		containerName := envVariable("UPLOAD_CONTAINER_NAME")
+		if containerName == "" || containerName == envVariable("CONTAINER_NAME") {
+			return nil, errors.New("UPLOAD_CONTAINER_NAME must name a private container other than CONTAINER_NAME")
+		}
+		credential, err := azidentity.NewDefaultAzureCredential(nil)
+		if err != nil {
+			return nil, err
+		}
+		return NewAzureBlobStorage(envVariable("BLOB_URL"), containerName, credential, ctx)
+	case "local":
+		rel, err := filepath.Rel(StaticDir, cfg.UploadDir)
+		if err == nil && !strings.HasPrefix(rel, "..") {
+			return nil, fmt.Errorf("upload storage directory %q must not be inside %q", cfg.UploadDir, StaticDir)
+		}
+		signingKey := []byte(cfg.SigningSecret)
+		if len(signingKey) == 0 {
+			signingKey = make([]byte, 32)
+			if _, err := rand.Read(signingKey); err != nil {
+				return nil, err
+			}
+		}
+		return NewLocalBlobStorage(cfg.UploadDir, "", signingKey)
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", cfg.Backend)
+	}
+}
@@ -0,0 +1,268 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"cosmetcab.dp.ua/internal/validator"
+	"github.com/lib/pq"
+)
+
+var (
+	ErrAppointmentOverlap = errors.New("appointment overlaps another booking")
+)
+
+const (
+	AppointmentPending   = "pending"
+	AppointmentConfirmed = "confirmed"
+	AppointmentCancelled = "cancelled"
+)
+
+type Appointment struct {
+	ID          int64         `json:"id"`
+	ServiceID   int64         `json:"service_id"`
+	StaffID     sql.NullInt64 `json:"staff_id"`
+	ClientName  string        `json:"client_name"`
+	ClientPhone string        `json:"client_phone"`
+	StartsAt    time.Time     `json:"starts_at"`
+	EndsAt      time.Time     `json:"ends_at"`
+	Status      string        `json:"status"`
+	// PromotionID is the promotion of the promo code used for booking
+	PromotionID int64     `json:"promotion_id,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	Version     int       `json:"version"`
+}
+
+// AppointmentFilter restricts the appointments returned by AppointmentModel.GetAll
+type AppointmentFilter struct {
+	Status    string
+	ServiceID int64
+	StaffID   int64
+}
+
+type AppointmentModel struct {
+	DB *sql.DB
+}
+
+func ValidateAppointment(appointment *Appointment, v *validator.Validator) {
+	v.Check(appointment.ClientName != "", "name", "must be provided")
+	v.Check(len([]rune(appointment.ClientName)) <= 100, "name", "must not be more than 100 chars")
+	v.Check(appointment.ClientPhone != "", "phone", "must be provided")
+	v.Check(v.Matches(appointment.ClientPhone, validator.PhoneRX), "phone", "must be valid phone number")
+	v.Check(!appointment.StartsAt.IsZero(), "starts_at", "must be provided")
+	v.Check(appointment.EndsAt.After(appointment.StartsAt), "starts_at", "service must have a duration to be booked")
+	v.Check(validator.PermittedValue(appointment.Status, AppointmentPending, AppointmentConfirmed, AppointmentCancelled), "status", "must be pending, confirmed or cancelled")
+}
+
+// SetSlot sets the start of the appointment and calculates its end
+// using the duration of the booked service.
+func (a *Appointment) SetSlot(startsAt time.Time, duration time.Duration) {
+	a.StartsAt = startsAt
+	a.EndsAt = startsAt.Add(duration)
+}
+
+func (a *Appointment) Interval() Interval {
+	return Interval{Start: a.StartsAt, End: a.EndsAt}
+}
+
+// Overlaps reports whether the appointment intersects any other booking
+// of the same master that has not been cancelled. Bookings without a
+// master only conflict with each other.
+func (m AppointmentModel) Overlaps(appointment *Appointment) (bool, error) {
+	query := `
+	SELECT EXISTS (
+		SELECT 1
+		FROM appointments
+		WHERE status <> 'cancelled'
+		AND starts_at < $2 AND ends_at > $1
+		AND id <> $3
+		AND COALESCE(staff_id, 0) = COALESCE($4, 0)
+	)`
+	args := []any{appointment.StartsAt, appointment.EndsAt, appointment.ID, appointment.StaffID}
+	var overlaps bool
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&overlaps)
+	return overlaps, err
+}
+
+func (m AppointmentModel) Insert(appointment *Appointment) error {
+	query := `
+	INSERT INTO appointments (service_id, staff_id, client_name, client_phone, starts_at, ends_at, status, promotion_id)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, NULLIF($8, 0))
+	RETURNING id, created_at, version`
+	args := []any{
+		appointment.ServiceID,
+		appointment.StaffID,
+		appointment.ClientName,
+		appointment.ClientPhone,
+		appointment.StartsAt,
+		appointment.EndsAt,
+		appointment.Status,
+		appointment.PromotionID,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&appointment.ID, &appointment.CreatedAt, &appointment.Version)
+	if err != nil {
+		return appointmentError(err)
+	}
+	return nil
+}
+
+func (m AppointmentModel) Get(id int64) (*Appointment, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := `
+	SELECT id, service_id, staff_id, client_name, client_phone, starts_at, ends_at, status, COALESCE(promotion_id, 0), created_at, version
+	FROM appointments
+	WHERE id=$1`
+	var appointment Appointment
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&appointment.ID,
+		&appointment.ServiceID,
+		&appointment.StaffID,
+		&appointment.ClientName,
+		&appointment.ClientPhone,
+		&appointment.StartsAt,
+		&appointment.EndsAt,
+		&appointment.Status,
+		&appointment.PromotionID,
+		&appointment.CreatedAt,
+		&appointment.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &appointment, nil
+}
+
+// GetAll returns a page of appointments matching the filter.
+// Zero values in the filter do not restrict the result.
+func (m AppointmentModel) GetAll(filter AppointmentFilter, filters Filters) ([]*Appointment, Metadata, error) {
+	query := fmt.Sprintf(`
+	SELECT count(*) OVER(), id, service_id, staff_id, client_name, client_phone, starts_at, ends_at, status, COALESCE(promotion_id, 0), created_at, version
+	FROM appointments
+	WHERE (status = $1 OR $1 = '')
+	AND (service_id = $2 OR $2 = 0)
+	AND (staff_id = $3 OR $3 = 0)
+	ORDER BY %s %s, id ASC
+	LIMIT $4 OFFSET $5`, filters.sortColumn(), filters.sortDirection())
+	args := []any{filter.Status, filter.ServiceID, filter.StaffID, filters.limit(), filters.offset()}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+	totalRecords := 0
+	appointments := []*Appointment{}
+	for rows.Next() {
+		var appointment Appointment
+		err = rows.Scan(
+			&totalRecords,
+			&appointment.ID,
+			&appointment.ServiceID,
+			&appointment.StaffID,
+			&appointment.ClientName,
+			&appointment.ClientPhone,
+			&appointment.StartsAt,
+			&appointment.EndsAt,
+			&appointment.Status,
+			&appointment.PromotionID,
+			&appointment.CreatedAt,
+			&appointment.Version,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		appointments = append(appointments, &appointment)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return appointments, metadata, nil
+}
+
+// GetBusyIntervals returns the time taken by bookings of a master
+// that intersect the given interval.
+func (m AppointmentModel) GetBusyIntervals(staffID int64, within Interval) ([]Interval, error) {
+	query := `
+	SELECT starts_at, ends_at
+	FROM appointments
+	WHERE staff_id = $1
+	AND status <> 'cancelled'
+	AND starts_at < $3 AND ends_at > $2
+	ORDER BY starts_at`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, staffID, within.Start, within.End)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	busy := []Interval{}
+	for rows.Next() {
+		var interval Interval
+		err = rows.Scan(&interval.Start, &interval.End)
+		if err != nil {
+			return nil, err
+		}
+		busy = append(busy, interval)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return busy, nil
+}
+
+func (m AppointmentModel) Update(appointment *Appointment) error {
+	query := `
+	UPDATE appointments
+	SET staff_id=$1, starts_at=$2, ends_at=$3, status=$4, version = version + 1
+	WHERE id=$5 AND version=$6
+	RETURNING version`
+	args := []any{
+		appointment.StaffID,
+		appointment.StartsAt,
+		appointment.EndsAt,
+		appointment.Status,
+		appointment.ID,
+		appointment.Version,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&appointment.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return appointmentError(err)
+		}
+	}
+	return nil
+}
+
+// appointmentError converts a violation of the appointments_no_overlap
+// exclusion constraint, which guards against concurrent bookings,
+// into ErrAppointmentOverlap.
+func appointmentError(err error) error {
+	if pgErr, ok := err.(*pq.Error); ok && pgErr.Code == "23P01" {
+		return ErrAppointmentOverlap
+	}
+	return err
+}
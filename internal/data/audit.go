@@ -0,0 +1,145 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"cosmetcab.dp.ua/internal/validator"
+)
+
+const (
+	AuditCreate = "create"
+	AuditUpdate = "update"
+	AuditDelete = "delete"
+)
+
+// AuditEntry records a change of an entity. Before is empty for creations
+// and After for deletions.
+type AuditEntry struct {
+	ID         int64           `json:"id"`
+	ActorID    int64           `json:"actor_id,omitempty"`
+	Action     string          `json:"action"`
+	EntityType string          `json:"entity_type"`
+	EntityID   int64           `json:"entity_id"`
+	Before     json.RawMessage `json:"before,omitempty"`
+	After      json.RawMessage `json:"after,omitempty"`
+	RequestID  string          `json:"request_id"`
+	CreatedAt  time.Time       `json:"created_at"`
+}
+
+// AuditFilter narrows the entries returned by GetAll. Zero values match
+// everything.
+type AuditFilter struct {
+	ActorID    int64
+	Action     string
+	EntityType string
+	EntityID   int64
+	From       time.Time
+	To         time.Time
+}
+
+type AuditModel struct {
+	DB *sql.DB
+}
+
+func ValidateAuditFilter(v *validator.Validator, filter AuditFilter) {
+	v.Check(filter.Action == "" || validator.PermittedValue(filter.Action, AuditCreate, AuditUpdate, AuditDelete), "action", "must be create, update or delete")
+	v.Check(len(filter.EntityType) <= 50, "entity_type", "must not be more than 50 bytes long")
+	v.Check(filter.From.IsZero() || filter.To.IsZero() || filter.From.Before(filter.To), "to", "must be after from")
+}
+
+func (m AuditModel) Insert(entry *AuditEntry) error {
+	query := `
+	INSERT INTO audit_log (actor_id, action, entity_type, entity_id, before, after, request_id)
+	VALUES (NULLIF($1, 0), $2, $3, $4, $5, $6, $7)
+	RETURNING id, created_at`
+	args := []any{
+		entry.ActorID,
+		entry.Action,
+		entry.EntityType,
+		entry.EntityID,
+		nullJSON(entry.Before),
+		nullJSON(entry.After),
+		entry.RequestID,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&entry.ID, &entry.CreatedAt)
+}
+
+// GetAll returns the entries matching the filter
+func (m AuditModel) GetAll(filter AuditFilter, filters Filters) ([]*AuditEntry, Metadata, error) {
+	query := fmt.Sprintf(`
+	SELECT count(*) OVER(), id, COALESCE(actor_id, 0), action, entity_type, entity_id, before, after, request_id, created_at
+	FROM audit_log
+	WHERE (actor_id = $1 OR $1 = 0)
+	AND (action = $2 OR $2 = '')
+	AND (entity_type = $3 OR $3 = '')
+	AND (entity_id = $4 OR $4 = 0)
+	AND (created_at >= $5 OR $5 IS NULL)
+	AND (created_at < $6 OR $6 IS NULL)
+	ORDER BY %s %s, id DESC
+	LIMIT $7 OFFSET $8`, filters.sortColumn(), filters.sortDirection())
+	args := []any{
+		filter.ActorID,
+		filter.Action,
+		filter.EntityType,
+		filter.EntityID,
+		nullTime(filter.From),
+		nullTime(filter.To),
+		filters.limit(),
+		filters.offset(),
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+	totalRecords := 0
+	entries := []*AuditEntry{}
+	for rows.Next() {
+		var entry AuditEntry
+		var before, after []byte
+		err = rows.Scan(
+			&totalRecords,
+			&entry.ID,
+			&entry.ActorID,
+			&entry.Action,
+			&entry.EntityType,
+			&entry.EntityID,
+			&before,
+			&after,
+			&entry.RequestID,
+			&entry.CreatedAt,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		entry.Before = before
+		entry.After = after
+		entries = append(entries, &entry)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return entries, metadata, nil
+}
+
+// nullJSON stores an empty document as NULL
+func nullJSON(doc json.RawMessage) any {
+	if len(doc) == 0 {
+		return nil
+	}
+	return []byte(doc)
+}
+
+// nullTime stores the zero time as NULL
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
@@ -3,10 +3,14 @@ package data
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"time"
 
 	"cosmetcab.dp.ua/internal/validator"
+	"github.com/lib/pq"
 )
 
 type Category struct {
@@ -14,6 +18,35 @@ type Category struct {
 	Title       string `json:"title"`
 	Description string `json:"description"`
 	PhotoURL    string `json:"photo_url"`
+	// Photos holds the resized variants of the photo, PhotoURL is the
+	// largest of them
+	Photos PhotoVariants `json:"photos"`
+	// PhotoMissing is set by the reconciliation of the blob storage when
+	// the photo is no longer stored. Saving another photo clears it.
+	PhotoMissing bool `json:"photo_missing"`
+}
+
+// PhotoVariants maps variant names (thumbnail, card, hero) to the URLs of
+// the resized photos. It is stored as a JSON object.
+type PhotoVariants map[string]string
+
+func (p *PhotoVariants) Scan(src any) error {
+	switch value := src.(type) {
+	case []byte:
+		return json.Unmarshal(value, p)
+	case string:
+		return json.Unmarshal([]byte(value), p)
+	default:
+		return fmt.Errorf("cannot scan %T into PhotoVariants", src)
+	}
+}
+
+func (p PhotoVariants) Value() (driver.Value, error) {
+	if p == nil {
+		return "{}", nil
+	}
+	js, err := json.Marshal(p)
+	return string(js), err
 }
 
 func ValidateCategory(category *Category, v *validator.Validator) {
@@ -30,11 +63,11 @@ type CategoryModel struct {
 
 func (c CategoryModel) Insert(category *Category) error {
 	query := `
-	INSERT INTO categories (title, description, photo_url)
-	VALUES ($1, $2, $3)
+	INSERT INTO categories (title, description, photo_url, photos)
+	VALUES ($1, $2, $3, $4)
 	RETURNING id`
 
-	args := []any{category.Title, category.Description, category.PhotoURL}
+	args := []any{category.Title, category.Description, category.PhotoURL, category.Photos}
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 	return c.DB.QueryRowContext(ctx, query, args...).Scan(&category.ID)
@@ -45,7 +78,7 @@ func (c CategoryModel) Get(id int64) (*Category, error) {
 		return nil, ErrRecordNotFound
 	}
 	query := `
-			SELECT id, title, description, photo_url
+			SELECT id, title, description, photo_url, photos, photo_missing
 			FROM categories 
 			WHERE id=$1`
 
@@ -57,6 +90,8 @@ func (c CategoryModel) Get(id int64) (*Category, error) {
 		&category.Title,
 		&category.Description,
 		&category.PhotoURL,
+		&category.Photos,
+		&category.PhotoMissing,
 	)
 	if err != nil {
 		switch {
@@ -70,81 +105,128 @@ func (c CategoryModel) Get(id int64) (*Category, error) {
 
 	return &category, nil
 }
-func (c CategoryModel) GetAll() ([]*Category, error) {
-	query := `
-	SELECT id, title, description, photo_url 
+
+// GetAll returns a page of categories whose title contains the given text
+func (c CategoryModel) GetAll(title string, filters Filters) ([]*Category, Metadata, error) {
+	query := fmt.Sprintf(`
+	SELECT count(*) OVER(), id, title, description, photo_url, photos, photo_missing
 	FROM categories
-	ORDER BY id`
+	WHERE (title ILIKE '%%' || $1 || '%%' OR $1 = '')
+	ORDER BY %s %s, id ASC
+	LIMIT $2 OFFSET $3`, filters.sortColumn(), filters.sortDirection())
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	rows, err := c.DB.QueryContext(ctx, query)
+	rows, err := c.DB.QueryContext(ctx, query, title, filters.limit(), filters.offset())
 	if err != nil {
-		return nil, err
+		return nil, Metadata{}, err
 	}
 	defer rows.Close()
 
+	totalRecords := 0
 	categories := []*Category{}
 	for rows.Next() {
 		var category Category
 		err := rows.Scan(
+			&totalRecords,
 			&category.ID,
 			&category.Title,
 			&category.Description,
 			&category.PhotoURL,
+			&category.Photos,
+			&category.PhotoMissing,
 		)
 		if err != nil {
-			return nil, err
+			return nil, Metadata{}, err
 		}
 		categories = append(categories, &category)
 
 	}
 	if err = rows.Err(); err != nil {
-		return nil, err
+		return nil, Metadata{}, err
 	}
-	return categories, nil
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return categories, metadata, nil
 
 }
 
 func (c CategoryModel) Update(category *Category) error {
 	query := `
 		UPDATE categories
-		SET title=$1, description=$2, photo_url=$3
-		WHERE id=$4`
+		SET title=$1, description=$2, photo_url=$3, photos=$4,
+			photo_missing = photo_missing AND photo_url = $3
+		WHERE id=$5
+		RETURNING photo_missing`
 	args := []any{
 		category.Title,
 		category.Description,
 		category.PhotoURL,
+		category.Photos,
 		category.ID,
 	}
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
-	_, err := c.DB.ExecContext(ctx, query, args...)
-
+	err := c.DB.QueryRowContext(ctx, query, args...).Scan(&category.PhotoMissing)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrRecordNotFound
+	}
 	return err
+}
 
+// SetPhotoMissing flags the categories with the ids as having lost their
+// photo and clears the flag of every other category. It returns how many
+// categories changed.
+func (c CategoryModel) SetPhotoMissing(ids []int64) (int64, error) {
+	query := `
+	UPDATE categories
+	SET photo_missing = (id = ANY($1))
+	WHERE photo_missing <> (id = ANY($1))`
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	result, err := c.DB.ExecContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
 }
 
+// Delete removes the category with its services and packages. The
+// packages go first, so only packages of other categories keep the
+// services from being deleted, which fails with ErrServiceInPackage.
 func (c CategoryModel) Delete(id int64) (string, error) {
 	if id < 1 {
 		return "", ErrRecordNotFound
 	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	tx, err := c.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM packages WHERE category_id=$1`, id)
+	if err != nil {
+		return "", err
+	}
 	query := `
 		DELETE FROM categories
 		WHERE id=$1
 		RETURNING photo_url`
 	var category Category
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-	err := c.DB.QueryRowContext(ctx, query, id).Scan(&category.PhotoURL)
+	err = tx.QueryRowContext(ctx, query, id).Scan(&category.PhotoURL)
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
 			return "", ErrRecordNotFound
 		default:
-			return "", err
+			return "", packageServiceError(err)
 		}
 	}
+	err = tx.Commit()
+	if err != nil {
+		return "", err
+	}
 	return category.PhotoURL, nil
 
 }
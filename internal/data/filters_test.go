@@ -0,0 +1,35 @@
+package data
+
+import (
+	"testing"
+
+	"cosmetcab.dp.ua/internal/assert"
+	"cosmetcab.dp.ua/internal/validator"
+)
+
+func TestFilters(t *testing.T) {
+	filters := Filters{Page: 3, PageSize: 20, Sort: "-price", SortSafelist: []string{"id", "price", "-id", "-price"}}
+
+	v := validator.New()
+	ValidateFilters(v, filters)
+	assert.Equal(t, v.Valid(), true)
+	assert.Equal(t, filters.sortColumn(), "price")
+	assert.Equal(t, filters.sortDirection(), "DESC")
+	assert.Equal(t, filters.offset(), 40)
+
+	filters.Sort = "price; DROP TABLE services"
+	v = validator.New()
+	ValidateFilters(v, filters)
+	assert.Equal(t, v.Valid(), false)
+}
+
+func TestCalculateMetadata(t *testing.T) {
+	assert.Equal(t, calculateMetadata(0, 1, 20), Metadata{})
+	assert.Equal(t, calculateMetadata(41, 2, 20), Metadata{
+		CurrentPage:  2,
+		PageSize:     20,
+		FirstPage:    1,
+		LastPage:     3,
+		TotalRecords: 41,
+	})
+}
@@ -0,0 +1,281 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	JobPending   = "pending"
+	JobRunning   = "running"
+	JobDone      = "done"
+	JobDead      = "dead"
+	JobCancelled = "cancelled"
+)
+
+// Job is a unit of background work stored in the database so that it
+// survives restarts. Data holds binary content such as an uploaded photo.
+type Job struct {
+	ID          int64           `json:"id"`
+	Kind        string          `json:"kind"`
+	Payload     json.RawMessage `json:"payload"`
+	Data        []byte          `json:"-"`
+	Status      string          `json:"status"`
+	Attempts    int             `json:"attempts"`
+	MaxAttempts int             `json:"max_attempts"`
+	RunAt       time.Time       `json:"run_at"`
+	LastError   string          `json:"last_error"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+}
+
+type JobModel struct {
+	DB *sql.DB
+}
+
+// JobBackoff returns how long to wait before running a job again
+// after its given failed attempt.
+func JobBackoff(attempts int) time.Duration {
+	if attempts > 12 {
+		return time.Hour
+	}
+	backoff := time.Duration(1<<attempts) * time.Second
+	if backoff > time.Hour {
+		return time.Hour
+	}
+	return backoff
+}
+
+func (m JobModel) Enqueue(job *Job) error {
+	query := `
+	INSERT INTO jobs (kind, payload, data, max_attempts)
+	VALUES ($1, $2, $3, $4)
+	RETURNING id, status, run_at, created_at, updated_at`
+	if job.Payload == nil {
+		job.Payload = json.RawMessage("{}")
+	}
+	args := []any{job.Kind, []byte(job.Payload), job.Data, job.MaxAttempts}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&job.ID, &job.Status, &job.RunAt, &job.CreatedAt, &job.UpdatedAt)
+}
+
+// Claim locks the next job that is due and marks it as running. Jobs left
+// running for longer than lockTimeout are considered abandoned by a crashed
+// worker and claimed again, or moved to the dead state when that was their
+// last attempt. ErrRecordNotFound is returned when nothing is due.
+func (m JobModel) Claim(lockTimeout time.Duration) (*Job, error) {
+	query := `
+	WITH exhausted AS (
+		UPDATE jobs
+		SET status = 'dead', last_error = 'abandoned by a worker on its last attempt', locked_at = NULL, updated_at = NOW()
+		WHERE status = 'running' AND locked_at < NOW() - make_interval(secs => $1)
+		AND attempts >= max_attempts
+	)
+	UPDATE jobs
+	SET status = 'running', attempts = attempts + 1, locked_at = NOW(), updated_at = NOW()
+	WHERE id = (
+		SELECT id
+		FROM jobs
+		WHERE (status = 'pending' AND run_at <= NOW())
+		OR (status = 'running' AND locked_at < NOW() - make_interval(secs => $1)
+			AND attempts < max_attempts)
+		ORDER BY run_at, id
+		FOR UPDATE SKIP LOCKED
+		LIMIT 1
+	)
+	RETURNING id, kind, payload, data, status, attempts, max_attempts, run_at, last_error, created_at, updated_at`
+	var job Job
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, lockTimeout.Seconds()).Scan(
+		&job.ID,
+		&job.Kind,
+		&job.Payload,
+		&job.Data,
+		&job.Status,
+		&job.Attempts,
+		&job.MaxAttempts,
+		&job.RunAt,
+		&job.LastError,
+		&job.CreatedAt,
+		&job.UpdatedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &job, nil
+}
+
+// Complete marks the job as done and drops its binary data
+func (m JobModel) Complete(id int64) error {
+	query := `
+	UPDATE jobs
+	SET status = 'done', data = NULL, locked_at = NULL, last_error = '', updated_at = NOW()
+	WHERE id = $1`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err := m.DB.ExecContext(ctx, query, id)
+	return err
+}
+
+// Fail records a failed attempt. The job is scheduled again with an
+// exponential backoff or moved to the dead state once it has used all
+// of its attempts. The new status is stored in job.Status.
+func (m JobModel) Fail(job *Job, jobErr error) error {
+	job.Status = JobPending
+	if job.Attempts >= job.MaxAttempts {
+		job.Status = JobDead
+	}
+	job.LastError = jobErr.Error()
+	query := `
+	UPDATE jobs
+	SET status = $1, last_error = $2, run_at = NOW() + make_interval(secs => $3), locked_at = NULL, updated_at = NOW()
+	WHERE id = $4
+	RETURNING run_at, updated_at`
+	args := []any{job.Status, job.LastError, JobBackoff(job.Attempts).Seconds(), job.ID}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&job.RunAt, &job.UpdatedAt)
+}
+
+// Cancel cancels a job that has not been picked up by a worker yet and
+// reports whether it did so.
+func (m JobModel) Cancel(id int64) (bool, error) {
+	query := `
+	UPDATE jobs
+	SET status = 'cancelled', data = NULL, updated_at = NOW()
+	WHERE id = $1 AND status = 'pending'`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected > 0, nil
+}
+
+// Retry schedules a dead job to run again with a fresh set of attempts
+func (m JobModel) Retry(id int64) (*Job, error) {
+	query := `
+	UPDATE jobs
+	SET status = 'pending', attempts = 0, run_at = NOW(), updated_at = NOW()
+	WHERE id = $1 AND status = 'dead'
+	RETURNING id, kind, payload, status, attempts, max_attempts, run_at, last_error, created_at, updated_at`
+	var job Job
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&job.ID,
+		&job.Kind,
+		&job.Payload,
+		&job.Status,
+		&job.Attempts,
+		&job.MaxAttempts,
+		&job.RunAt,
+		&job.LastError,
+		&job.CreatedAt,
+		&job.UpdatedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &job, nil
+}
+
+func (m JobModel) Get(id int64) (*Job, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := `
+	SELECT id, kind, payload, status, attempts, max_attempts, run_at, last_error, created_at, updated_at
+	FROM jobs
+	WHERE id = $1`
+	var job Job
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&job.ID,
+		&job.Kind,
+		&job.Payload,
+		&job.Status,
+		&job.Attempts,
+		&job.MaxAttempts,
+		&job.RunAt,
+		&job.LastError,
+		&job.CreatedAt,
+		&job.UpdatedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &job, nil
+}
+
+// GetAll returns a page of jobs with the given status,
+// or of all jobs when status is empty.
+func (m JobModel) GetAll(status string, filters Filters) ([]*Job, Metadata, error) {
+	query := fmt.Sprintf(`
+	SELECT count(*) OVER(), id, kind, payload, status, attempts, max_attempts, run_at, last_error, created_at, updated_at
+	FROM jobs
+	WHERE (status = $1 OR $1 = '')
+	ORDER BY %s %s, id DESC
+	LIMIT $2 OFFSET $3`, filters.sortColumn(), filters.sortDirection())
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, status, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+	totalRecords := 0
+	jobs := []*Job{}
+	for rows.Next() {
+		var job Job
+		err = rows.Scan(
+			&totalRecords,
+			&job.ID,
+			&job.Kind,
+			&job.Payload,
+			&job.Status,
+			&job.Attempts,
+			&job.MaxAttempts,
+			&job.RunAt,
+			&job.LastError,
+			&job.CreatedAt,
+			&job.UpdatedAt,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		jobs = append(jobs, &job)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return jobs, metadata, nil
+}
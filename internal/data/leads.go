@@ -0,0 +1,154 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"cosmetcab.dp.ua/internal/validator"
+)
+
+const (
+	LeadNew       = "new"
+	LeadContacted = "contacted"
+	LeadBooked    = "booked"
+	LeadSpam      = "spam"
+)
+
+// Lead is a message left by a client through the contact form
+type Lead struct {
+	ID        int64     `json:"id"`
+	Name      string    `json:"name"`
+	Phone     string    `json:"phone"`
+	Message   string    `json:"message"`
+	Status    string    `json:"status"`
+	Note      string    `json:"note"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Version   int       `json:"version"`
+}
+
+type LeadModel struct {
+	DB *sql.DB
+}
+
+func ValidateLeadStatus(v *validator.Validator, status string) {
+	v.Check(validator.PermittedValue(status, LeadNew, LeadContacted, LeadBooked, LeadSpam), "status", "must be new, contacted, booked or spam")
+}
+
+func ValidateLead(v *validator.Validator, lead *Lead) {
+	ValidateLeadStatus(v, lead.Status)
+	v.Check(len([]rune(lead.Note)) <= 1000, "note", "must not be more than 1000 chars")
+}
+
+func (m LeadModel) Insert(lead *Lead) error {
+	query := `
+	INSERT INTO leads (name, phone, message, status)
+	VALUES ($1, $2, $3, $4)
+	RETURNING id, created_at, updated_at, version`
+	args := []any{lead.Name, lead.Phone, lead.Message, lead.Status}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&lead.ID, &lead.CreatedAt, &lead.UpdatedAt, &lead.Version)
+}
+
+func (m LeadModel) Get(id int64) (*Lead, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := `
+	SELECT id, name, phone, message, status, note, created_at, updated_at, version
+	FROM leads
+	WHERE id=$1`
+	var lead Lead
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&lead.ID,
+		&lead.Name,
+		&lead.Phone,
+		&lead.Message,
+		&lead.Status,
+		&lead.Note,
+		&lead.CreatedAt,
+		&lead.UpdatedAt,
+		&lead.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &lead, nil
+}
+
+// GetAll returns a page of leads. Empty status and phone
+// arguments do not filter the result.
+func (m LeadModel) GetAll(status, phone string, filters Filters) ([]*Lead, Metadata, error) {
+	query := fmt.Sprintf(`
+	SELECT count(*) OVER(), id, name, phone, message, status, note, created_at, updated_at, version
+	FROM leads
+	WHERE (status = $1 OR $1 = '')
+	AND (phone = $2 OR $2 = '')
+	ORDER BY %s %s, id DESC
+	LIMIT $3 OFFSET $4`, filters.sortColumn(), filters.sortDirection())
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, status, phone, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+	totalRecords := 0
+	leads := []*Lead{}
+	for rows.Next() {
+		var lead Lead
+		err = rows.Scan(
+			&totalRecords,
+			&lead.ID,
+			&lead.Name,
+			&lead.Phone,
+			&lead.Message,
+			&lead.Status,
+			&lead.Note,
+			&lead.CreatedAt,
+			&lead.UpdatedAt,
+			&lead.Version,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		leads = append(leads, &lead)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return leads, metadata, nil
+}
+
+func (m LeadModel) Update(lead *Lead) error {
+	query := `
+	UPDATE leads
+	SET status=$1, note=$2, updated_at = NOW(), version = version + 1
+	WHERE id=$3 AND version=$4
+	RETURNING updated_at, version`
+	args := []any{lead.Status, lead.Note, lead.ID, lead.Version}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&lead.UpdatedAt, &lead.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,198 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+const (
+	LoginFailureAccount = "account"
+	LoginFailureIP      = "ip"
+)
+
+// LoginFailure counts failed login attempts for an account or a client IP
+type LoginFailure struct {
+	ID            int64        `json:"id"`
+	Kind          string       `json:"kind"`
+	Key           string       `json:"key"`
+	Failures      int          `json:"failures"`
+	LastFailureAt time.Time    `json:"last_failure_at"`
+	LockedUntil   sql.NullTime `json:"locked_until"`
+}
+
+type LoginFailureModel struct {
+	DB *sql.DB
+}
+
+// Get returns the counter for the account or IP. ErrRecordNotFound means
+// there were no recent failures.
+func (m LoginFailureModel) Get(kind, key string) (*LoginFailure, error) {
+	query := `
+	SELECT id, kind, key, failures, last_failure_at, locked_until
+	FROM login_failures
+	WHERE kind = $1 AND key = $2`
+	var failure LoginFailure
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, kind, key).Scan(
+		&failure.ID,
+		&failure.Kind,
+		&failure.Key,
+		&failure.Failures,
+		&failure.LastFailureAt,
+		&failure.LockedUntil,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &failure, nil
+}
+
+// RecordFailure counts a failed attempt. Failures older than window are
+// forgotten, so the count starts again from one.
+func (m LoginFailureModel) RecordFailure(kind, key string, window time.Duration) (*LoginFailure, error) {
+	query := `
+	INSERT INTO login_failures (kind, key, failures, last_failure_at)
+	VALUES ($1, $2, 1, NOW())
+	ON CONFLICT (kind, key) DO UPDATE
+	SET failures = CASE
+			WHEN login_failures.last_failure_at < NOW() - make_interval(secs => $3) THEN 1
+			ELSE login_failures.failures + 1
+		END,
+		last_failure_at = NOW()
+	RETURNING id, kind, key, failures, last_failure_at, locked_until`
+	var failure LoginFailure
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, kind, key, window.Seconds()).Scan(
+		&failure.ID,
+		&failure.Kind,
+		&failure.Key,
+		&failure.Failures,
+		&failure.LastFailureAt,
+		&failure.LockedUntil,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &failure, nil
+}
+
+// Lock blocks logins until the given time and starts counting failures
+// from zero again
+func (m LoginFailureModel) Lock(failure *LoginFailure, until time.Time) error {
+	query := `
+	UPDATE login_failures
+	SET failures = 0, locked_until = $1
+	WHERE id = $2`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err := m.DB.ExecContext(ctx, query, until, failure.ID)
+	if err != nil {
+		return err
+	}
+	failure.Failures = 0
+	failure.LockedUntil = sql.NullTime{Time: until, Valid: true}
+	return nil
+}
+
+// Reset forgets the failures of an account or IP after a successful login
+func (m LoginFailureModel) Reset(kind, key string) error {
+	query := `
+	DELETE FROM login_failures
+	WHERE kind = $1 AND key = $2`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err := m.DB.ExecContext(ctx, query, kind, key)
+	return err
+}
+
+// GetAll returns the counters with recent failures or an active lock,
+// locked ones first
+func (m LoginFailureModel) GetAll(window time.Duration) ([]*LoginFailure, error) {
+	query := `
+	SELECT id, kind, key, failures, last_failure_at, locked_until
+	FROM login_failures
+	WHERE locked_until > NOW()
+	OR last_failure_at > NOW() - make_interval(secs => $1)
+	ORDER BY locked_until DESC NULLS LAST, last_failure_at DESC
+	LIMIT 500`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, window.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	failures := []*LoginFailure{}
+	for rows.Next() {
+		var failure LoginFailure
+		err = rows.Scan(
+			&failure.ID,
+			&failure.Kind,
+			&failure.Key,
+			&failure.Failures,
+			&failure.LastFailureAt,
+			&failure.LockedUntil,
+		)
+		if err != nil {
+			return nil, err
+		}
+		failures = append(failures, &failure)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return failures, nil
+}
+
+// Delete unlocks an account or IP, clears its failures and returns the
+// removed counter
+func (m LoginFailureModel) Delete(id int64) (*LoginFailure, error) {
+	query := `
+	DELETE FROM login_failures
+	WHERE id = $1
+	RETURNING id, kind, key, failures, last_failure_at, locked_until`
+	var failure LoginFailure
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&failure.ID,
+		&failure.Kind,
+		&failure.Key,
+		&failure.Failures,
+		&failure.LastFailureAt,
+		&failure.LockedUntil,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &failure, nil
+}
+
+// DeleteStale removes counters without recent failures or an active lock
+func (m LoginFailureModel) DeleteStale(window time.Duration) (int64, error) {
+	query := `
+	DELETE FROM login_failures
+	WHERE (locked_until IS NULL OR locked_until <= NOW())
+	AND last_failure_at <= NOW() - make_interval(secs => $1)`
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	result, err := m.DB.ExecContext(ctx, query, window.Seconds())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,272 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"cosmetcab.dp.ua/internal/validator"
+	"github.com/lib/pq"
+)
+
+var (
+	ErrInvalidMediaOrder = errors.New("the order must list every media item of the owner once")
+)
+
+// Owners media can belong to
+const (
+	MediaCategory = "category"
+	MediaService  = "service"
+	MediaStaff    = "staff"
+)
+
+// MaxMediaPerOwner limits the size of a gallery
+const MaxMediaPerOwner = 30
+
+// Media is a photo in the gallery of a category, service or master
+type Media struct {
+	ID        int64  `json:"id"`
+	OwnerType string `json:"owner_type"`
+	OwnerID   int64  `json:"owner_id"`
+	// URL is the largest variant of the photo
+	URL       string        `json:"url"`
+	Variants  PhotoVariants `json:"variants"`
+	AltText   string        `json:"alt_text"`
+	Caption   string        `json:"caption"`
+	Position  int           `json:"position"`
+	CreatedAt time.Time     `json:"created_at"`
+}
+
+type MediaModel struct {
+	DB *sql.DB
+}
+
+func ValidateMedia(v *validator.Validator, media *Media) {
+	v.Check(validator.PermittedValue(media.OwnerType, MediaCategory, MediaService, MediaStaff), "owner_type", "must be category, service or staff")
+	v.Check(len([]rune(media.AltText)) <= 200, "alt_text", "must not be more than 200 chars")
+	v.Check(len([]rune(media.Caption)) <= 500, "caption", "must not be more than 500 chars")
+}
+
+// Insert adds the media at the end of the owner's gallery
+func (m MediaModel) Insert(media *Media) error {
+	query := `
+	INSERT INTO media (owner_type, owner_id, url, variants, alt_text, caption, position)
+	SELECT $1, $2, $3, $4, $5, $6, COALESCE(MAX(position), 0) + 1
+	FROM media
+	WHERE owner_type = $1 AND owner_id = $2
+	RETURNING id, position, created_at`
+	args := []any{media.OwnerType, media.OwnerID, media.URL, media.Variants, media.AltText, media.Caption}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&media.ID, &media.Position, &media.CreatedAt)
+}
+
+func (m MediaModel) Get(ownerType string, ownerID, id int64) (*Media, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := `
+	SELECT id, owner_type, owner_id, url, variants, alt_text, caption, position, created_at
+	FROM media
+	WHERE id = $1 AND owner_type = $2 AND owner_id = $3`
+	var media Media
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, id, ownerType, ownerID).Scan(
+		&media.ID,
+		&media.OwnerType,
+		&media.OwnerID,
+		&media.URL,
+		&media.Variants,
+		&media.AltText,
+		&media.Caption,
+		&media.Position,
+		&media.CreatedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &media, nil
+}
+
+// GetAll returns the gallery of an owner in display order
+func (m MediaModel) GetAll(ownerType string, ownerID int64) ([]*Media, error) {
+	query := `
+	SELECT id, owner_type, owner_id, url, variants, alt_text, caption, position, created_at
+	FROM media
+	WHERE owner_type = $1 AND owner_id = $2
+	ORDER BY position, id`
+	return m.query(query, ownerType, ownerID)
+}
+
+// GetAllOfCategoryServices returns the galleries of the services of a
+// category. Deleting the category deletes the services and their media.
+func (m MediaModel) GetAllOfCategoryServices(categoryID int64) ([]*Media, error) {
+	query := `
+	SELECT id, owner_type, owner_id, url, variants, alt_text, caption, position, created_at
+	FROM media
+	WHERE owner_type = 'service' AND owner_id IN (SELECT id FROM services WHERE category_id = $1)
+	ORDER BY owner_id, position, id`
+	return m.query(query, categoryID)
+}
+
+// GetAllOfSubCategoryServices returns the galleries of the services of a
+// subcategory, which are deleted with it like GetAllOfCategoryServices
+func (m MediaModel) GetAllOfSubCategoryServices(subCategoryID int64) ([]*Media, error) {
+	query := `
+	SELECT id, owner_type, owner_id, url, variants, alt_text, caption, position, created_at
+	FROM media
+	WHERE owner_type = 'service' AND owner_id IN (SELECT id FROM services WHERE subcategory_id = $1)
+	ORDER BY owner_id, position, id`
+	return m.query(query, subCategoryID)
+}
+
+func (m MediaModel) query(query string, args ...any) ([]*Media, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	gallery := []*Media{}
+	for rows.Next() {
+		var media Media
+		err = rows.Scan(
+			&media.ID,
+			&media.OwnerType,
+			&media.OwnerID,
+			&media.URL,
+			&media.Variants,
+			&media.AltText,
+			&media.Caption,
+			&media.Position,
+			&media.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		gallery = append(gallery, &media)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return gallery, nil
+}
+
+// Update saves the alt text and caption of the media
+func (m MediaModel) Update(media *Media) error {
+	query := `
+	UPDATE media
+	SET alt_text = $1, caption = $2
+	WHERE id = $3`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err := m.DB.ExecContext(ctx, query, media.AltText, media.Caption, media.ID)
+	return err
+}
+
+// Reorder puts the owner's gallery in the order of the ids, which must
+// list every media item of the owner exactly once
+func (m MediaModel) Reorder(ownerType string, ownerID int64, ids []int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `
+	SELECT id FROM media
+	WHERE owner_type = $1 AND owner_id = $2
+	FOR UPDATE`, ownerType, ownerID)
+	if err != nil {
+		return err
+	}
+	existing := make(map[int64]bool)
+	for rows.Next() {
+		var id int64
+		if err = rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		existing[id] = true
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	err = checkMediaOrder(existing, ids)
+	if err != nil {
+		return err
+	}
+
+	query := `
+	UPDATE media
+	SET position = o.position
+	FROM unnest($1::bigint[]) WITH ORDINALITY AS o (id, position)
+	WHERE media.id = o.id`
+	_, err = tx.ExecContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// checkMediaOrder returns ErrInvalidMediaOrder unless the ids list every
+// existing id exactly once. The existing ids are consumed.
+func checkMediaOrder(existing map[int64]bool, ids []int64) error {
+	if len(ids) != len(existing) {
+		return ErrInvalidMediaOrder
+	}
+	for _, id := range ids {
+		if !existing[id] {
+			return ErrInvalidMediaOrder
+		}
+		// a repeated id is caught as the other id is then missing
+		delete(existing, id)
+	}
+	return nil
+}
+
+// Delete removes the media from the owner's gallery and returns it, so
+// its blobs can be deleted
+func (m MediaModel) Delete(ownerType string, ownerID, id int64) (*Media, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := `
+	DELETE FROM media
+	WHERE id = $1 AND owner_type = $2 AND owner_id = $3
+	RETURNING id, owner_type, owner_id, url, variants, alt_text, caption, position, created_at`
+	var media Media
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, id, ownerType, ownerID).Scan(
+		&media.ID,
+		&media.OwnerType,
+		&media.OwnerID,
+		&media.URL,
+		&media.Variants,
+		&media.AltText,
+		&media.Caption,
+		&media.Position,
+		&media.CreatedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &media, nil
+}
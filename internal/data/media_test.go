@@ -0,0 +1,33 @@
+package data
+
+import (
+	"strings"
+	"testing"
+
+	"cosmetcab.dp.ua/internal/assert"
+	"cosmetcab.dp.ua/internal/validator"
+)
+
+func TestValidateMedia(t *testing.T) {
+	v := validator.New()
+	ValidateMedia(v, &Media{OwnerType: MediaService, AltText: "Manicure", Caption: strings.Repeat("ї", 500)})
+	assert.Equal(t, v.Valid(), true)
+
+	v = validator.New()
+	ValidateMedia(v, &Media{OwnerType: "package", AltText: strings.Repeat("a", 201), Caption: strings.Repeat("a", 501)})
+	assert.Equal(t, v.Errors["owner_type"], "must be category, service or staff")
+	assert.Equal(t, v.Errors["alt_text"], "must not be more than 200 chars")
+	assert.Equal(t, v.Errors["caption"], "must not be more than 500 chars")
+}
+
+func TestCheckMediaOrder(t *testing.T) {
+	existing := func() map[int64]bool {
+		return map[int64]bool{1: true, 2: true, 3: true}
+	}
+	assert.Equal(t, checkMediaOrder(existing(), []int64{3, 1, 2}), nil)
+	// missing, extra, unknown and duplicate ids
+	assert.Equal(t, checkMediaOrder(existing(), []int64{3, 1}), ErrInvalidMediaOrder)
+	assert.Equal(t, checkMediaOrder(existing(), []int64{3, 1, 2, 4}), ErrInvalidMediaOrder)
+	assert.Equal(t, checkMediaOrder(existing(), []int64{3, 1, 4}), ErrInvalidMediaOrder)
+	assert.Equal(t, checkMediaOrder(existing(), []int64{3, 1, 1}), ErrInvalidMediaOrder)
+}
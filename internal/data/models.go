@@ -15,6 +15,24 @@ type Models struct {
 	SubCategories SubCategoryModel
 	Services      ServiceModel
 	Users         UserModel
+	Appointments  AppointmentModel
+	Staff         StaffModel
+	Schedules     ScheduleModel
+	Leads         LeadModel
+	Jobs          JobModel
+	Permissions   PermissionModel
+	Sessions      SessionModel
+	Tokens        TokenModel
+	RecoveryCodes RecoveryCodeModel
+	LoginFailures LoginFailureModel
+	Audit         AuditModel
+	ServicePrices ServicePriceModel
+	Promotions    PromotionModel
+	Packages      PackageModel
+	Translations  TranslationModel
+	Media         MediaModel
+	Uploads       UploadModel
+	Photos        PhotoModel
 }
 
 func NewModels(db *sql.DB) Models {
@@ -23,5 +41,23 @@ func NewModels(db *sql.DB) Models {
 		SubCategories: SubCategoryModel{DB: db},
 		Services:      ServiceModel{DB: db},
 		Users:         UserModel{DB: db},
+		Appointments:  AppointmentModel{DB: db},
+		Staff:         StaffModel{DB: db},
+		Schedules:     ScheduleModel{DB: db},
+		Leads:         LeadModel{DB: db},
+		Jobs:          JobModel{DB: db},
+		Permissions:   PermissionModel{DB: db},
+		Sessions:      SessionModel{DB: db},
+		Tokens:        TokenModel{DB: db},
+		RecoveryCodes: RecoveryCodeModel{DB: db},
+		LoginFailures: LoginFailureModel{DB: db},
+		Audit:         AuditModel{DB: db},
+		ServicePrices: ServicePriceModel{DB: db},
+		Promotions:    PromotionModel{DB: db},
+		Packages:      PackageModel{DB: db},
+		Translations:  TranslationModel{DB: db},
+		Media:         MediaModel{DB: db},
+		Uploads:       UploadModel{DB: db},
+		Photos:        PhotoModel{DB: db},
 	}
 }
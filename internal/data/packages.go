@@ -0,0 +1,331 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"cosmetcab.dp.ua/internal/validator"
+	"github.com/lib/pq"
+)
+
+var (
+	ErrServiceInPackage = errors.New("service is included in a package")
+)
+
+// Package is a course or combo of services sold at its own price,
+// e.g. five sessions of mesotherapy
+type Package struct {
+	ID          int64          `json:"id"`
+	Title       string         `json:"title"`
+	Description string         `json:"description"`
+	Price       int            `json:"price"`
+	PhotoURL    string         `json:"photo_url"`
+	CategoryID  int64          `json:"category_id"`
+	Services    []*PackageItem `json:"services"`
+	// RegularPrice is what the services would cost when booked one by one
+	RegularPrice int       `json:"regular_price"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// PackageItem is a service included in a package the given number of times
+type PackageItem struct {
+	ServiceID   int64  `json:"service_id"`
+	Description string `json:"description"`
+	Price       int    `json:"price"`
+	Quantity    int    `json:"quantity"`
+}
+
+type PackageModel struct {
+	DB *sql.DB
+}
+
+func ValidatePackage(pkg *Package, v *validator.Validator) {
+	v.Check(pkg.Title != "", "title", "must be provided")
+	v.Check(len([]rune(pkg.Title)) <= 200, "title", "must not be more than 200 chars")
+	v.Check(len([]rune(pkg.Description)) <= 2000, "description", "must not be more than 2000 chars")
+	v.Check(pkg.Price > 0, "price", "must be greater than zero")
+	v.Check(pkg.CategoryID > 0, "category_id", "must be provided")
+	v.Check(len(pkg.Services) > 0, "services", "must contain at least one service")
+	v.Check(len(pkg.Services) <= 20, "services", "must not contain more than 20 services")
+	seen := make(map[int64]bool, len(pkg.Services))
+	for _, item := range pkg.Services {
+		v.Check(item.ServiceID > 0, "services", "must only contain valid service ids")
+		v.Check(item.Quantity > 0 && item.Quantity <= 100, "services", "quantities must be between 1 and 100")
+		v.Check(!seen[item.ServiceID], "services", "must not contain duplicate services")
+		seen[item.ServiceID] = true
+	}
+}
+
+// packageServiceError converts a violation of the foreign key keeping
+// services included in packages from being deleted into
+// ErrServiceInPackage
+func packageServiceError(err error) error {
+	if pgErr, ok := err.(*pq.Error); ok && pgErr.Code == "23503" && pgErr.Constraint == "package_services_service_id_fkey" {
+		return ErrServiceInPackage
+	}
+	return err
+}
+
+// Insert adds the package together with its services
+func (m PackageModel) Insert(pkg *Package) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+	INSERT INTO packages (title, description, price, photo_url, category_id)
+	VALUES ($1, $2, $3, $4, $5)
+	RETURNING id, created_at`
+	args := []any{pkg.Title, pkg.Description, pkg.Price, pkg.PhotoURL, pkg.CategoryID}
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&pkg.ID, &pkg.CreatedAt)
+	if err != nil {
+		return err
+	}
+	err = setPackageServices(ctx, tx, pkg)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// setPackageServices replaces the services of the package
+func setPackageServices(ctx context.Context, tx *sql.Tx, pkg *Package) error {
+	_, err := tx.ExecContext(ctx, `DELETE FROM package_services WHERE package_id=$1`, pkg.ID)
+	if err != nil {
+		return err
+	}
+	query := `
+	INSERT INTO package_services (package_id, service_id, quantity)
+	VALUES ($1, $2, $3)`
+	for _, item := range pkg.Services {
+		_, err = tx.ExecContext(ctx, query, pkg.ID, item.ServiceID, item.Quantity)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m PackageModel) Get(id int64) (*Package, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := `
+	SELECT id, title, description, price, photo_url, category_id, created_at
+	FROM packages
+	WHERE id=$1`
+	var pkg Package
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&pkg.ID,
+		&pkg.Title,
+		&pkg.Description,
+		&pkg.Price,
+		&pkg.PhotoURL,
+		&pkg.CategoryID,
+		&pkg.CreatedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	err = m.loadServices(ctx, []*Package{&pkg})
+	if err != nil {
+		return nil, err
+	}
+	return &pkg, nil
+}
+
+// GetAll returns a page of packages, only those of the category when
+// categoryID is set
+func (m PackageModel) GetAll(categoryID int64, filters Filters) ([]*Package, Metadata, error) {
+	query := fmt.Sprintf(`
+	SELECT count(*) OVER(), id, title, description, price, photo_url, category_id, created_at
+	FROM packages
+	WHERE (category_id = $1 OR $1 = 0)
+	ORDER BY %s %s, id ASC
+	LIMIT $2 OFFSET $3`, filters.sortColumn(), filters.sortDirection())
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, categoryID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+	totalRecords := 0
+	packages := []*Package{}
+	for rows.Next() {
+		var pkg Package
+		err = rows.Scan(
+			&totalRecords,
+			&pkg.ID,
+			&pkg.Title,
+			&pkg.Description,
+			&pkg.Price,
+			&pkg.PhotoURL,
+			&pkg.CategoryID,
+			&pkg.CreatedAt,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		packages = append(packages, &pkg)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+	err = m.loadServices(ctx, packages)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return packages, metadata, nil
+}
+
+// GetAllForCategory returns every package of the category for the
+// category view
+func (m PackageModel) GetAllForCategory(categoryID int64) ([]*Package, error) {
+	query := `
+	SELECT id, title, description, price, photo_url, category_id, created_at
+	FROM packages
+	WHERE category_id = $1
+	ORDER BY id`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, categoryID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	packages := []*Package{}
+	for rows.Next() {
+		var pkg Package
+		err = rows.Scan(
+			&pkg.ID,
+			&pkg.Title,
+			&pkg.Description,
+			&pkg.Price,
+			&pkg.PhotoURL,
+			&pkg.CategoryID,
+			&pkg.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		packages = append(packages, &pkg)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	err = m.loadServices(ctx, packages)
+	if err != nil {
+		return nil, err
+	}
+	return packages, nil
+}
+
+// loadServices fills in the services of the packages with one query and
+// calculates their regular prices
+func (m PackageModel) loadServices(ctx context.Context, packages []*Package) error {
+	if len(packages) == 0 {
+		return nil
+	}
+	byID := make(map[int64]*Package, len(packages))
+	ids := make([]int64, 0, len(packages))
+	for _, pkg := range packages {
+		pkg.Services = []*PackageItem{}
+		byID[pkg.ID] = pkg
+		ids = append(ids, pkg.ID)
+	}
+	query := `
+	SELECT ps.package_id, s.id, s.description, s.price, ps.quantity
+	FROM package_services ps
+	JOIN services s ON ps.service_id = s.id
+	WHERE ps.package_id = ANY($1)
+	ORDER BY ps.package_id, s.id`
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var packageID int64
+		var item PackageItem
+		err = rows.Scan(&packageID, &item.ServiceID, &item.Description, &item.Price, &item.Quantity)
+		if err != nil {
+			return err
+		}
+		pkg := byID[packageID]
+		pkg.Services = append(pkg.Services, &item)
+		pkg.RegularPrice += item.Price * item.Quantity
+	}
+	return rows.Err()
+}
+
+// Update saves the package and replaces its services
+func (m PackageModel) Update(pkg *Package) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+	UPDATE packages
+	SET title=$1, description=$2, price=$3, photo_url=$4, category_id=$5
+	WHERE id=$6`
+	args := []any{pkg.Title, pkg.Description, pkg.Price, pkg.PhotoURL, pkg.CategoryID, pkg.ID}
+	result, err := tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	err = setPackageServices(ctx, tx, pkg)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (m PackageModel) Delete(id int64) (string, error) {
+	if id < 1 {
+		return "", ErrRecordNotFound
+	}
+	query := `
+	DELETE FROM packages
+	WHERE id=$1
+	RETURNING photo_url`
+	var photoURL string
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(&photoURL)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return "", ErrRecordNotFound
+		default:
+			return "", err
+		}
+	}
+	return photoURL, nil
+}
@@ -0,0 +1,38 @@
+package data
+
+import (
+	"strings"
+	"testing"
+
+	"cosmetcab.dp.ua/internal/assert"
+	"cosmetcab.dp.ua/internal/validator"
+)
+
+func TestValidatePackage(t *testing.T) {
+	pkg := &Package{
+		Title:      "Five sessions of mesotherapy",
+		Price:      4500,
+		CategoryID: 2,
+		Services:   []*PackageItem{{ServiceID: 7, Quantity: 5}, {ServiceID: 8, Quantity: 1}},
+	}
+	v := validator.New()
+	ValidatePackage(pkg, v)
+	assert.Equal(t, v.Valid(), true)
+
+	v = validator.New()
+	ValidatePackage(&Package{Title: strings.Repeat("ї", 201), Price: 0}, v)
+	assert.Equal(t, v.Errors["title"], "must not be more than 200 chars")
+	assert.Equal(t, v.Errors["price"], "must be greater than zero")
+	assert.Equal(t, v.Errors["category_id"], "must be provided")
+	assert.Equal(t, v.Errors["services"], "must contain at least one service")
+
+	pkg.Services = append(pkg.Services, &PackageItem{ServiceID: 7, Quantity: 1})
+	v = validator.New()
+	ValidatePackage(pkg, v)
+	assert.Equal(t, v.Errors["services"], "must not contain duplicate services")
+
+	pkg.Services = []*PackageItem{{ServiceID: 7, Quantity: 101}}
+	v = validator.New()
+	ValidatePackage(pkg, v)
+	assert.Equal(t, v.Errors["services"], "quantities must be between 1 and 100")
+}
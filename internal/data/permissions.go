@@ -0,0 +1,58 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"slices"
+	"time"
+)
+
+const (
+	RoleOwner  = "owner"
+	RoleAdmin  = "admin"
+	RoleStaff  = "staff"
+	RoleViewer = "viewer"
+)
+
+// Permissions holds permission codes such as "services:write"
+type Permissions []string
+
+func (p Permissions) Include(code string) bool {
+	return slices.Contains(p, code)
+}
+
+type PermissionModel struct {
+	DB *sql.DB
+}
+
+// GetAllForUser returns the permissions granted to the role of the user.
+// Deactivated users have no permissions.
+func (m PermissionModel) GetAllForUser(userID int64) (Permissions, error) {
+	query := `
+	SELECT permissions.code
+	FROM permissions
+	INNER JOIN role_permissions ON role_permissions.permission_id = permissions.id
+	INNER JOIN users ON users.role = role_permissions.role
+	WHERE users.id = $1 AND users.activated
+	ORDER BY permissions.code`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	permissions := Permissions{}
+	for rows.Next() {
+		var permission string
+		err = rows.Scan(&permission)
+		if err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, permission)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return permissions, nil
+}
@@ -0,0 +1,96 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Owners of photos besides the media owners
+const (
+	PhotoPackage = "package"
+	PhotoMedia   = "media"
+)
+
+// PhotoReference is a photo URL stored in the database together with the
+// record it belongs to. Owner is MediaCategory, MediaStaff, PhotoPackage
+// or PhotoMedia.
+type PhotoReference struct {
+	Owner   string `json:"owner"`
+	OwnerID int64  `json:"owner_id"`
+	URL     string `json:"url"`
+}
+
+// PhotoModel queries the photo URLs of every table storing them
+type PhotoModel struct {
+	DB *sql.DB
+}
+
+// GetAllReferences returns every photo URL in the database. A photo and
+// its variants are separate references.
+func (m PhotoModel) GetAllReferences() ([]*PhotoReference, error) {
+	query := `
+	SELECT 'category', id, photo_url FROM categories WHERE photo_url <> ''
+	UNION
+	SELECT 'category', id, value FROM categories, jsonb_each_text(photos)
+	UNION
+	SELECT 'staff', id, photo_url FROM staff WHERE photo_url <> ''
+	UNION
+	SELECT 'package', id, photo_url FROM packages WHERE photo_url <> ''
+	UNION
+	SELECT 'media', id, url FROM media
+	UNION
+	SELECT 'media', id, value FROM media, jsonb_each_text(variants)
+	ORDER BY 1, 2, 3`
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	references := []*PhotoReference{}
+	for rows.Next() {
+		var reference PhotoReference
+		err = rows.Scan(&reference.Owner, &reference.OwnerID, &reference.URL)
+		if err != nil {
+			return nil, err
+		}
+		references = append(references, &reference)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return references, nil
+}
+
+// GetInFlightBlobNames returns the blobs that are being changed: blobs of
+// queued or running upload and delete jobs and pre-signed uploads that
+// weren't confirmed yet. Their state in the storage may not match the
+// database for a while.
+func (m PhotoModel) GetInFlightBlobNames() ([]string, error) {
+	query := `
+	SELECT payload->>'blob_name' FROM jobs
+	WHERE status IN ($1, $2) AND payload ? 'blob_name'
+	UNION
+	SELECT blob_name FROM uploads`
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, JobPending, JobRunning)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	blobNames := []string{}
+	for rows.Next() {
+		var blobName string
+		if err = rows.Scan(&blobName); err != nil {
+			return nil, err
+		}
+		blobNames = append(blobNames, blobName)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return blobNames, nil
+}
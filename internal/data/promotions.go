@@ -0,0 +1,413 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"cosmetcab.dp.ua/internal/validator"
+	"github.com/lib/pq"
+)
+
+var (
+	ErrDuplicatePromoCode = errors.New("duplicate promo code")
+)
+
+const (
+	PromotionPercent = "percent"
+	PromotionFixed   = "fixed"
+
+	PromotionScopeService     = "service"
+	PromotionScopeSubCategory = "subcategory"
+	PromotionScopeCategory    = "category"
+)
+
+var PromoCodeRX = regexp.MustCompile(`^[A-Za-z0-9-]{3,32}$`)
+
+// Promotion is a discount on a service, or on every service of a
+// subcategory or category, while it runs. Promotions with a code only
+// apply to bookings made with that code.
+type Promotion struct {
+	ID       int64     `json:"id"`
+	Title    string    `json:"title"`
+	Kind     string    `json:"kind"`
+	Value    int       `json:"value"`
+	Scope    string    `json:"scope"`
+	ScopeID  int64     `json:"scope_id"`
+	StartsAt time.Time `json:"starts_at"`
+	EndsAt   time.Time `json:"ends_at"`
+	Code     string    `json:"code,omitempty"`
+	// MaxUses of zero means the code can be used any number of times
+	MaxUses   int       `json:"max_uses,omitempty"`
+	Uses      int       `json:"uses"`
+	CreatedAt time.Time `json:"created_at"`
+	Version   int       `json:"version"`
+}
+
+// Promotions are the promotions that apply to a price at the same time
+type Promotions []*Promotion
+
+type PromotionModel struct {
+	DB *sql.DB
+}
+
+func ValidatePromotion(v *validator.Validator, promotion *Promotion) {
+	v.Check(promotion.Title != "", "title", "must be provided")
+	v.Check(len(promotion.Title) <= 200, "title", "must not be more than 200 bytes long")
+	v.Check(validator.PermittedValue(promotion.Kind, PromotionPercent, PromotionFixed), "kind", "must be percent or fixed")
+	v.Check(promotion.Value > 0, "value", "must be greater than zero")
+	v.Check(promotion.Kind != PromotionPercent || promotion.Value <= 100, "value", "must not be more than 100 percent")
+	v.Check(validator.PermittedValue(promotion.Scope, PromotionScopeService, PromotionScopeSubCategory, PromotionScopeCategory), "scope", "must be service, subcategory or category")
+	v.Check(promotion.ScopeID > 0, "scope_id", "must be provided")
+	v.Check(!promotion.StartsAt.IsZero(), "starts_at", "must be provided")
+	v.Check(promotion.EndsAt.After(promotion.StartsAt), "ends_at", "must be after starts_at")
+	v.Check(promotion.Code == "" || v.Matches(promotion.Code, PromoCodeRX), "code", "must be 3 to 32 letters, digits or dashes")
+	v.Check(promotion.MaxUses >= 0, "max_uses", "must not be negative")
+	v.Check(promotion.MaxUses == 0 || promotion.Code != "", "max_uses", "can only be set for promotions with a code")
+}
+
+// Matches reports whether the promotion covers the service
+func (p *Promotion) Matches(serviceID, subCategoryID, categoryID int64) bool {
+	switch p.Scope {
+	case PromotionScopeService:
+		return p.ScopeID == serviceID
+	case PromotionScopeSubCategory:
+		return p.ScopeID == subCategoryID
+	case PromotionScopeCategory:
+		return p.ScopeID == categoryID
+	}
+	return false
+}
+
+// Apply returns the price after the discount, which is never negative
+func (p *Promotion) Apply(price int) int {
+	switch p.Kind {
+	case PromotionPercent:
+		price -= price * p.Value / 100
+	case PromotionFixed:
+		price -= p.Value
+	}
+	if price < 0 {
+		return 0
+	}
+	return price
+}
+
+// BestPrice returns the lowest price any of the promotions gives the
+// service and the promotion giving it, or the price itself and nil when
+// none of them applies. Discounts are not combined.
+func (ps Promotions) BestPrice(price int, serviceID, subCategoryID, categoryID int64) (int, *Promotion) {
+	best, bestPromotion := price, (*Promotion)(nil)
+	for _, p := range ps {
+		if !p.Matches(serviceID, subCategoryID, categoryID) {
+			continue
+		}
+		if discounted := p.Apply(price); discounted < best {
+			best, bestPromotion = discounted, p
+		}
+	}
+	return best, bestPromotion
+}
+
+// ApplyToService sets the discounted price of the service
+func (ps Promotions) ApplyToService(service *Service) {
+	price, promotion := ps.BestPrice(service.Price, service.ID, service.SubCategoryID, service.CategoryID)
+	service.DiscountedPrice = price
+	service.PromotionID = 0
+	if promotion != nil {
+		service.PromotionID = promotion.ID
+	}
+}
+
+// ApplyToServiceWithSubcategory sets the discounted price of a service of
+// the given category
+func (ps Promotions) ApplyToServiceWithSubcategory(service *ServiceWithSubcategory, categoryID int64) {
+	price, promotion := ps.BestPrice(service.Price, service.ID, service.Subcategory.ID, categoryID)
+	service.DiscountedPrice = price
+	service.PromotionID = 0
+	if promotion != nil {
+		service.PromotionID = promotion.ID
+	}
+}
+
+// scopeColumns returns the values of the service_id, subcategory_id and
+// category_id columns, of which only the one of the scope is set
+func (p *Promotion) scopeColumns() (serviceID, subCategoryID, categoryID sql.NullInt64) {
+	id := sql.NullInt64{Int64: p.ScopeID, Valid: true}
+	switch p.Scope {
+	case PromotionScopeService:
+		serviceID = id
+	case PromotionScopeSubCategory:
+		subCategoryID = id
+	case PromotionScopeCategory:
+		categoryID = id
+	}
+	return
+}
+
+const promotionColumns = `id, title, kind, value,
+	CASE WHEN service_id IS NOT NULL THEN 'service' WHEN subcategory_id IS NOT NULL THEN 'subcategory' ELSE 'category' END,
+	COALESCE(service_id, subcategory_id, category_id),
+	starts_at, ends_at, COALESCE(code, ''), COALESCE(max_uses, 0), uses, created_at, version`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanPromotion(row rowScanner, promotion *Promotion, extra ...any) error {
+	dest := append(extra,
+		&promotion.ID,
+		&promotion.Title,
+		&promotion.Kind,
+		&promotion.Value,
+		&promotion.Scope,
+		&promotion.ScopeID,
+		&promotion.StartsAt,
+		&promotion.EndsAt,
+		&promotion.Code,
+		&promotion.MaxUses,
+		&promotion.Uses,
+		&promotion.CreatedAt,
+		&promotion.Version,
+	)
+	return row.Scan(dest...)
+}
+
+func promotionError(err error) error {
+	if pgErr, ok := err.(*pq.Error); ok && pgErr.Code == "23505" && pgErr.Constraint == "promotions_code_key" {
+		return ErrDuplicatePromoCode
+	}
+	return err
+}
+
+func (m PromotionModel) Insert(promotion *Promotion) error {
+	query := `
+	INSERT INTO promotions (title, kind, value, service_id, subcategory_id, category_id, starts_at, ends_at, code, max_uses)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NULLIF($9, ''), NULLIF($10, 0))
+	RETURNING id, uses, created_at, version`
+	serviceID, subCategoryID, categoryID := promotion.scopeColumns()
+	args := []any{
+		promotion.Title,
+		promotion.Kind,
+		promotion.Value,
+		serviceID,
+		subCategoryID,
+		categoryID,
+		promotion.StartsAt,
+		promotion.EndsAt,
+		promotion.Code,
+		promotion.MaxUses,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&promotion.ID, &promotion.Uses, &promotion.CreatedAt, &promotion.Version)
+	if err != nil {
+		return promotionError(err)
+	}
+	return nil
+}
+
+func (m PromotionModel) Get(id int64) (*Promotion, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := `
+	SELECT ` + promotionColumns + `
+	FROM promotions
+	WHERE id = $1`
+	var promotion Promotion
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := scanPromotion(m.DB.QueryRowContext(ctx, query, id), &promotion)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &promotion, nil
+}
+
+// GetActiveByCode returns the running promotion with the code.
+// ErrRecordNotFound is returned for unknown, expired and used up codes.
+func (m PromotionModel) GetActiveByCode(code string) (*Promotion, error) {
+	query := `
+	SELECT ` + promotionColumns + `
+	FROM promotions
+	WHERE code = $1
+	AND starts_at <= NOW() AND ends_at > NOW()
+	AND (max_uses IS NULL OR uses < max_uses)`
+	var promotion Promotion
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := scanPromotion(m.DB.QueryRowContext(ctx, query, code), &promotion)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &promotion, nil
+}
+
+// GetRunning returns the promotions without a code that apply right now
+func (m PromotionModel) GetRunning() (Promotions, error) {
+	query := `
+	SELECT ` + promotionColumns + `
+	FROM promotions
+	WHERE code IS NULL
+	AND starts_at <= NOW() AND ends_at > NOW()`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	promotions := Promotions{}
+	for rows.Next() {
+		var promotion Promotion
+		err = scanPromotion(rows, &promotion)
+		if err != nil {
+			return nil, err
+		}
+		promotions = append(promotions, &promotion)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return promotions, nil
+}
+
+// GetAll returns a page of promotions. With active set only the running
+// ones are returned.
+func (m PromotionModel) GetAll(active bool, filters Filters) ([]*Promotion, Metadata, error) {
+	query := fmt.Sprintf(`
+	SELECT count(*) OVER(), `+promotionColumns+`
+	FROM promotions
+	WHERE NOT $1 OR (starts_at <= NOW() AND ends_at > NOW())
+	ORDER BY %s %s, id ASC
+	LIMIT $2 OFFSET $3`, filters.sortColumn(), filters.sortDirection())
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, active, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+	totalRecords := 0
+	promotions := []*Promotion{}
+	for rows.Next() {
+		var promotion Promotion
+		err = scanPromotion(rows, &promotion, &totalRecords)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		promotions = append(promotions, &promotion)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return promotions, metadata, nil
+}
+
+func (m PromotionModel) Update(promotion *Promotion) error {
+	query := `
+	UPDATE promotions
+	SET title = $1, kind = $2, value = $3, service_id = $4, subcategory_id = $5, category_id = $6,
+		starts_at = $7, ends_at = $8, code = NULLIF($9, ''), max_uses = NULLIF($10, 0), version = version + 1
+	WHERE id = $11 AND version = $12
+	RETURNING version`
+	serviceID, subCategoryID, categoryID := promotion.scopeColumns()
+	args := []any{
+		promotion.Title,
+		promotion.Kind,
+		promotion.Value,
+		serviceID,
+		subCategoryID,
+		categoryID,
+		promotion.StartsAt,
+		promotion.EndsAt,
+		promotion.Code,
+		promotion.MaxUses,
+		promotion.ID,
+		promotion.Version,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&promotion.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return promotionError(err)
+		}
+	}
+	return nil
+}
+
+func (m PromotionModel) Delete(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+	query := `
+	DELETE FROM promotions
+	WHERE id = $1`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// Redeem counts a use of a promo code. It reports false when the
+// promotion ended or its uses ran out in the meantime.
+func (m PromotionModel) Redeem(id int64) (bool, error) {
+	query := `
+	UPDATE promotions
+	SET uses = uses + 1
+	WHERE id = $1
+	AND starts_at <= NOW() AND ends_at > NOW()
+	AND (max_uses IS NULL OR uses < max_uses)`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected > 0, nil
+}
+
+// Release gives back a use counted by Redeem when the booking failed
+func (m PromotionModel) Release(id int64) error {
+	query := `
+	UPDATE promotions
+	SET uses = uses - 1
+	WHERE id = $1 AND uses > 0`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err := m.DB.ExecContext(ctx, query, id)
+	return err
+}
@@ -0,0 +1,32 @@
+package data
+
+import (
+	"testing"
+
+	"cosmetcab.dp.ua/internal/assert"
+)
+
+func TestPromotionsBestPrice(t *testing.T) {
+	promotions := Promotions{
+		{ID: 1, Kind: PromotionPercent, Value: 10, Scope: PromotionScopeCategory, ScopeID: 3},
+		{ID: 2, Kind: PromotionFixed, Value: 150, Scope: PromotionScopeService, ScopeID: 7},
+		{ID: 3, Kind: PromotionFixed, Value: 5000, Scope: PromotionScopeSubCategory, ScopeID: 9},
+	}
+
+	// the bigger discount wins, discounts are not combined
+	price, promotion := promotions.BestPrice(1000, 7, 2, 3)
+	assert.Equal(t, price, 850)
+	assert.Equal(t, promotion.ID, int64(2))
+
+	price, promotion = promotions.BestPrice(1000, 8, 2, 3)
+	assert.Equal(t, price, 900)
+	assert.Equal(t, promotion.ID, int64(1))
+
+	// prices never go below zero
+	price, _ = promotions.BestPrice(1000, 8, 9, 4)
+	assert.Equal(t, price, 0)
+
+	price, promotion = promotions.BestPrice(1000, 8, 2, 4)
+	assert.Equal(t, price, 1000)
+	assert.Equal(t, promotion == nil, true)
+}
@@ -0,0 +1,103 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// recoveryCodeCount is how many recovery codes a user gets
+const recoveryCodeCount = 10
+
+type RecoveryCodeModel struct {
+	DB *sql.DB
+}
+
+// normalizeRecoveryCode lets users type codes in any case and with or
+// without the separator
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	return strings.ReplaceAll(code, "-", "")
+}
+
+// Generate replaces the recovery codes of the user with new ones and
+// returns their plaintext, which is shown to the user only once
+func (m RecoveryCodeModel) Generate(userID int64) ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		// 7 bytes give 12 base32 characters, 10 of them carry 50 bits
+		text, err := RandomString(7)
+		if err != nil {
+			return nil, err
+		}
+		codes[i] = text[:5] + "-" + text[5:10]
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	_, err = tx.ExecContext(ctx, `DELETE FROM recovery_codes WHERE user_id = $1`, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, code := range codes {
+		_, err = tx.ExecContext(ctx, `
+		INSERT INTO recovery_codes (user_id, hash)
+		VALUES ($1, $2)`, userID, HashToken(normalizeRecoveryCode(code)))
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// Use marks an unused recovery code of the user as used and reports
+// whether there was one
+func (m RecoveryCodeModel) Use(userID int64, code string) (bool, error) {
+	query := `
+	UPDATE recovery_codes
+	SET used_at = NOW()
+	WHERE user_id = $1 AND hash = $2 AND used_at IS NULL`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	result, err := m.DB.ExecContext(ctx, query, userID, HashToken(normalizeRecoveryCode(code)))
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected > 0, nil
+}
+
+// CountUnused returns how many recovery codes the user has left
+func (m RecoveryCodeModel) CountUnused(userID int64) (int, error) {
+	query := `
+	SELECT count(*)
+	FROM recovery_codes
+	WHERE user_id = $1 AND used_at IS NULL`
+	var count int
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, userID).Scan(&count)
+	return count, err
+}
+
+func (m RecoveryCodeModel) DeleteAllForUser(userID int64) error {
+	query := `
+	DELETE FROM recovery_codes
+	WHERE user_id = $1`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err := m.DB.ExecContext(ctx, query, userID)
+	return err
+}
@@ -0,0 +1,404 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"cosmetcab.dp.ua/internal/validator"
+)
+
+const DateLayout = "2006-01-02"
+
+// TimeOfDay is a wall clock time stored as minutes after midnight.
+// It is encoded as "15:04" in JSON and as a time column in PostgreSQL.
+type TimeOfDay int
+
+func ParseTimeOfDay(value string) (TimeOfDay, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		// PostgreSQL returns time columns with seconds
+		t, err = time.Parse("15:04:05", value)
+		if err != nil {
+			return 0, fmt.Errorf("invalid time of day %q", value)
+		}
+	}
+	return TimeOfDay(t.Hour()*60 + t.Minute()), nil
+}
+
+func (t TimeOfDay) String() string {
+	return fmt.Sprintf("%02d:%02d", int(t)/60, int(t)%60)
+}
+
+// On returns the moment of the given date at this time of day
+func (t TimeOfDay) On(date time.Time) time.Time {
+	year, month, day := date.Date()
+	return time.Date(year, month, day, int(t)/60, int(t)%60, 0, 0, date.Location())
+}
+
+func (t TimeOfDay) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.String())
+}
+
+func (t *TimeOfDay) UnmarshalJSON(js []byte) error {
+	var value string
+	err := json.Unmarshal(js, &value)
+	if err != nil {
+		return err
+	}
+	*t, err = ParseTimeOfDay(value)
+	return err
+}
+
+func (t *TimeOfDay) Scan(src any) error {
+	switch value := src.(type) {
+	case []byte:
+		parsed, err := ParseTimeOfDay(string(value))
+		*t = parsed
+		return err
+	case string:
+		parsed, err := ParseTimeOfDay(value)
+		*t = parsed
+		return err
+	case time.Time:
+		*t = TimeOfDay(value.Hour()*60 + value.Minute())
+		return nil
+	default:
+		return fmt.Errorf("cannot scan %T into TimeOfDay", src)
+	}
+}
+
+func (t TimeOfDay) Value() (driver.Value, error) {
+	return t.String(), nil
+}
+
+type WorkingHours struct {
+	Weekday  time.Weekday `json:"weekday"`
+	StartsAt TimeOfDay    `json:"starts_at"`
+	EndsAt   TimeOfDay    `json:"ends_at"`
+}
+
+type Break struct {
+	ID       int64        `json:"id"`
+	Weekday  time.Weekday `json:"weekday"`
+	StartsAt TimeOfDay    `json:"starts_at"`
+	EndsAt   TimeOfDay    `json:"ends_at"`
+}
+
+// ScheduleException replaces the weekly working hours of a master on a
+// single date. When DayOff is set the master does not work that day at all.
+type ScheduleException struct {
+	ID       int64     `json:"id"`
+	StaffID  int64     `json:"staff_id"`
+	Date     string    `json:"date"`
+	DayOff   bool      `json:"day_off"`
+	StartsAt TimeOfDay `json:"starts_at"`
+	EndsAt   TimeOfDay `json:"ends_at"`
+	Note     string    `json:"note"`
+}
+
+type Schedule struct {
+	WorkingHours []*WorkingHours      `json:"working_hours"`
+	Breaks       []*Break             `json:"breaks"`
+	Exceptions   []*ScheduleException `json:"exceptions"`
+}
+
+type Interval struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+func validateWeekday(v *validator.Validator, weekday time.Weekday, startsAt, endsAt TimeOfDay) {
+	v.Check(weekday >= time.Sunday && weekday <= time.Saturday, "weekday", "must be between 0 (Sunday) and 6 (Saturday)")
+	v.Check(endsAt > startsAt, "ends_at", "must be later than starts_at")
+}
+
+func ValidateWorkingHours(v *validator.Validator, hours []*WorkingHours) {
+	seen := make(map[time.Weekday]bool)
+	for _, h := range hours {
+		validateWeekday(v, h.Weekday, h.StartsAt, h.EndsAt)
+		v.Check(!seen[h.Weekday], "weekday", "must not contain duplicate values")
+		seen[h.Weekday] = true
+	}
+}
+
+func ValidateBreaks(v *validator.Validator, breaks []*Break) {
+	for _, b := range breaks {
+		validateWeekday(v, b.Weekday, b.StartsAt, b.EndsAt)
+	}
+}
+
+func ValidateScheduleException(v *validator.Validator, exception *ScheduleException) {
+	_, err := time.Parse(DateLayout, exception.Date)
+	v.Check(err == nil, "date", "must be a date in YYYY-MM-DD format")
+	if !exception.DayOff {
+		v.Check(exception.EndsAt > exception.StartsAt, "ends_at", "must be later than starts_at")
+	}
+	v.Check(len([]rune(exception.Note)) <= 200, "note", "must not be more than 200 chars")
+}
+
+// WorkingIntervals returns the parts of the given date during which the
+// master works, taking exceptions and breaks into account.
+func (s *Schedule) WorkingIntervals(date time.Time) []Interval {
+	var working []Interval
+	exception := s.exceptionOn(date)
+	switch {
+	case exception != nil && exception.DayOff:
+		return nil
+	case exception != nil:
+		working = append(working, Interval{exception.StartsAt.On(date), exception.EndsAt.On(date)})
+	default:
+		for _, h := range s.WorkingHours {
+			if h.Weekday == date.Weekday() {
+				working = append(working, Interval{h.StartsAt.On(date), h.EndsAt.On(date)})
+			}
+		}
+	}
+	var breaks []Interval
+	for _, b := range s.Breaks {
+		if b.Weekday == date.Weekday() {
+			breaks = append(breaks, Interval{b.StartsAt.On(date), b.EndsAt.On(date)})
+		}
+	}
+	return subtractIntervals(working, breaks)
+}
+
+// Covers reports whether the master works during the whole interval
+func (s *Schedule) Covers(interval Interval) bool {
+	for _, working := range s.WorkingIntervals(interval.Start) {
+		if !interval.Start.Before(working.Start) && !interval.End.After(working.End) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Schedule) exceptionOn(date time.Time) *ScheduleException {
+	day := date.Format(DateLayout)
+	for _, e := range s.Exceptions {
+		if e.Date == day {
+			return e
+		}
+	}
+	return nil
+}
+
+// subtractIntervals removes the busy intervals from the free ones
+func subtractIntervals(free, busy []Interval) []Interval {
+	for _, b := range busy {
+		var result []Interval
+		for _, f := range free {
+			if !b.Start.Before(f.End) || !b.End.After(f.Start) {
+				result = append(result, f)
+				continue
+			}
+			if b.Start.After(f.Start) {
+				result = append(result, Interval{f.Start, b.Start})
+			}
+			if b.End.Before(f.End) {
+				result = append(result, Interval{b.End, f.End})
+			}
+		}
+		free = result
+	}
+	return free
+}
+
+// FreeSlots returns the start times of slots of the given duration that
+// fit into the working intervals without touching busy ones. Slots start
+// every step minutes from the beginning of each free interval and never
+// before notBefore.
+func FreeSlots(working, busy []Interval, duration, step time.Duration, notBefore time.Time) []time.Time {
+	slots := []time.Time{}
+	if duration <= 0 || step <= 0 {
+		return slots
+	}
+	for _, f := range subtractIntervals(working, busy) {
+		for start := f.Start; !start.Add(duration).After(f.End); start = start.Add(step) {
+			if start.Before(notBefore) {
+				continue
+			}
+			slots = append(slots, start)
+		}
+	}
+	return slots
+}
+
+type ScheduleModel struct {
+	DB *sql.DB
+}
+
+func (m ScheduleModel) Get(staffID int64) (*Schedule, error) {
+	schedule := &Schedule{
+		WorkingHours: []*WorkingHours{},
+		Breaks:       []*Break{},
+		Exceptions:   []*ScheduleException{},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+	SELECT weekday, starts_at, ends_at
+	FROM staff_working_hours
+	WHERE staff_id=$1
+	ORDER BY weekday`
+	rows, err := m.DB.QueryContext(ctx, query, staffID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var hours WorkingHours
+		err = rows.Scan(&hours.Weekday, &hours.StartsAt, &hours.EndsAt)
+		if err != nil {
+			return nil, err
+		}
+		schedule.WorkingHours = append(schedule.WorkingHours, &hours)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	query = `
+	SELECT id, weekday, starts_at, ends_at
+	FROM staff_breaks
+	WHERE staff_id=$1
+	ORDER BY weekday, starts_at`
+	rows, err = m.DB.QueryContext(ctx, query, staffID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var b Break
+		err = rows.Scan(&b.ID, &b.Weekday, &b.StartsAt, &b.EndsAt)
+		if err != nil {
+			return nil, err
+		}
+		schedule.Breaks = append(schedule.Breaks, &b)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	query = `
+	SELECT id, staff_id, date::text, day_off, COALESCE(starts_at, '00:00'), COALESCE(ends_at, '00:00'), note
+	FROM staff_schedule_exceptions
+	WHERE staff_id=$1
+	ORDER BY date`
+	rows, err = m.DB.QueryContext(ctx, query, staffID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var e ScheduleException
+		err = rows.Scan(&e.ID, &e.StaffID, &e.Date, &e.DayOff, &e.StartsAt, &e.EndsAt, &e.Note)
+		if err != nil {
+			return nil, err
+		}
+		schedule.Exceptions = append(schedule.Exceptions, &e)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return schedule, nil
+}
+
+// SetWorkingHours replaces the whole weekly timetable of a master
+func (m ScheduleModel) SetWorkingHours(staffID int64, hours []*WorkingHours) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM staff_working_hours WHERE staff_id=$1`, staffID)
+	if err != nil {
+		return err
+	}
+	query := `
+	INSERT INTO staff_working_hours (staff_id, weekday, starts_at, ends_at)
+	VALUES ($1, $2, $3, $4)`
+	for _, h := range hours {
+		_, err = tx.ExecContext(ctx, query, staffID, h.Weekday, h.StartsAt, h.EndsAt)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// SetBreaks replaces all weekly breaks of a master
+func (m ScheduleModel) SetBreaks(staffID int64, breaks []*Break) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM staff_breaks WHERE staff_id=$1`, staffID)
+	if err != nil {
+		return err
+	}
+	query := `
+	INSERT INTO staff_breaks (staff_id, weekday, starts_at, ends_at)
+	VALUES ($1, $2, $3, $4)
+	RETURNING id`
+	for _, b := range breaks {
+		err = tx.QueryRowContext(ctx, query, staffID, b.Weekday, b.StartsAt, b.EndsAt).Scan(&b.ID)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// SetException inserts an exception or replaces the one
+// already defined for the same date.
+func (m ScheduleModel) SetException(exception *ScheduleException) error {
+	query := `
+	INSERT INTO staff_schedule_exceptions (staff_id, date, day_off, starts_at, ends_at, note)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	ON CONFLICT (staff_id, date)
+	DO UPDATE SET day_off = EXCLUDED.day_off, starts_at = EXCLUDED.starts_at, ends_at = EXCLUDED.ends_at, note = EXCLUDED.note
+	RETURNING id`
+	var startsAt, endsAt any
+	if !exception.DayOff {
+		startsAt, endsAt = exception.StartsAt, exception.EndsAt
+	}
+	args := []any{exception.StaffID, exception.Date, exception.DayOff, startsAt, endsAt, exception.Note}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&exception.ID)
+}
+
+func (m ScheduleModel) DeleteException(staffID, id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+	query := `
+	DELETE FROM staff_schedule_exceptions
+	WHERE id=$1 AND staff_id=$2`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	result, err := m.DB.ExecContext(ctx, query, id, staffID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package data
+
+import (
+	"testing"
+	"time"
+
+	"cosmetcab.dp.ua/internal/assert"
+)
+
+func TestScheduleWorkingIntervals(t *testing.T) {
+	// 2026-11-02 is a Monday
+	monday := time.Date(2026, 11, 2, 0, 0, 0, 0, time.UTC)
+	schedule := &Schedule{
+		WorkingHours: []*WorkingHours{{Weekday: time.Monday, StartsAt: 9 * 60, EndsAt: 18 * 60}},
+		Breaks:       []*Break{{Weekday: time.Monday, StartsAt: 13 * 60, EndsAt: 14 * 60}},
+	}
+
+	working := schedule.WorkingIntervals(monday)
+	assert.Equal(t, len(working), 2)
+	assert.Equal(t, working[0].End, time.Date(2026, 11, 2, 13, 0, 0, 0, time.UTC))
+	assert.Equal(t, working[1].Start, time.Date(2026, 11, 2, 14, 0, 0, 0, time.UTC))
+
+	// Tuesday has no working hours
+	assert.Equal(t, len(schedule.WorkingIntervals(monday.AddDate(0, 0, 1))), 0)
+
+	// a day off overrides the weekly hours
+	schedule.Exceptions = []*ScheduleException{{Date: "2026-11-02", DayOff: true}}
+	assert.Equal(t, len(schedule.WorkingIntervals(monday)), 0)
+
+	// changed hours replace the weekly ones
+	schedule.Exceptions = []*ScheduleException{{Date: "2026-11-02", StartsAt: 15 * 60, EndsAt: 17 * 60}}
+	working = schedule.WorkingIntervals(monday)
+	assert.Equal(t, len(working), 1)
+	assert.Equal(t, working[0].Start, time.Date(2026, 11, 2, 15, 0, 0, 0, time.UTC))
+}
+
+func TestFreeSlots(t *testing.T) {
+	at := func(hour, minute int) time.Time {
+		return time.Date(2026, 11, 2, hour, minute, 0, 0, time.UTC)
+	}
+	working := []Interval{{at(9, 0), at(12, 0)}}
+	busy := []Interval{{at(10, 0), at(11, 0)}}
+
+	slots := FreeSlots(working, busy, time.Hour, 30*time.Minute, at(0, 0))
+	assert.Equal(t, len(slots), 2)
+	assert.Equal(t, slots[0], at(9, 0))
+	assert.Equal(t, slots[1], at(11, 0))
+
+	// slots before notBefore are skipped
+	slots = FreeSlots(working, busy, time.Hour, 30*time.Minute, at(9, 30))
+	assert.Equal(t, len(slots), 1)
+	assert.Equal(t, slots[0], at(11, 0))
+}
@@ -0,0 +1,107 @@
+package data
+
+import (
+	"context"
+	"strings"
+	"time"
+	"unicode"
+
+	"cosmetcab.dp.ua/internal/validator"
+)
+
+// ServiceSearchResult is a service found by ServiceModel.Search
+// together with the category it belongs to
+type ServiceSearchResult struct {
+	ServiceWithSubcategory
+	Category Category `json:"category"`
+}
+
+func ValidateSearchQuery(v *validator.Validator, q string) {
+	v.Check(strings.TrimSpace(q) != "", "q", "must be provided")
+	v.Check(len([]rune(q)) <= 100, "q", "must not be more than 100 chars")
+}
+
+// prefixTSQuery turns free text into a tsquery that matches every word as a
+// prefix, so "чистк облич" finds "чистка обличчя". Punctuation is dropped
+// to keep the result valid tsquery syntax.
+func prefixTSQuery(q string) string {
+	words := strings.FieldsFunc(strings.ToLower(q), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for i, word := range words {
+		words[i] = word + ":*"
+	}
+	return strings.Join(words, " & ")
+}
+
+// Search returns services whose description, category or subcategory match
+// the query, best matches first. Full-text matches rank by ts_rank and
+// misspelled or inflected words are still found by trigram similarity.
+func (m ServiceModel) Search(q string, filters Filters) ([]*ServiceSearchResult, Metadata, error) {
+	query := `
+	SELECT count(*) OVER(),
+		s.id,
+		s.time,
+		s.description,
+		s.price,
+		COALESCE(sc.id, 0),
+		COALESCE(sc.name, ''),
+		COALESCE(c.id, 0),
+		COALESCE(c.title, ''),
+		COALESCE(c.description, ''),
+		COALESCE(c.photo_url, ''),
+		COALESCE(c.photos, '{}'),
+		COALESCE(c.photo_missing, false)
+	FROM services s
+	LEFT JOIN subcategories sc ON s.subcategory_id = sc.id
+	LEFT JOIN categories c ON s.category_id = c.id,
+	to_tsquery('simple', $2) query
+	WHERE s.search @@ query
+	OR sc.search @@ query
+	OR c.search @@ query
+	OR $1 <% s.description
+	OR $1 <% sc.name
+	OR $1 <% c.title
+	ORDER BY
+		ts_rank(s.search || COALESCE(sc.search, ''::tsvector) || COALESCE(c.search, ''::tsvector), query)
+		+ GREATEST(word_similarity($1, s.description), word_similarity($1, COALESCE(sc.name, '')), word_similarity($1, COALESCE(c.title, ''))) DESC,
+		s.id ASC
+	LIMIT $3 OFFSET $4`
+	args := []any{q, prefixTSQuery(q), filters.limit(), filters.offset()}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+	totalRecords := 0
+	results := []*ServiceSearchResult{}
+	for rows.Next() {
+		var result ServiceSearchResult
+		err = rows.Scan(
+			&totalRecords,
+			&result.ID,
+			&result.Time,
+			&result.Description,
+			&result.Price,
+			&result.Subcategory.ID,
+			&result.Subcategory.Name,
+			&result.Category.ID,
+			&result.Category.Title,
+			&result.Category.Description,
+			&result.Category.PhotoURL,
+			&result.Category.Photos,
+			&result.Category.PhotoMissing,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		results = append(results, &result)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return results, metadata, nil
+}
@@ -0,0 +1,13 @@
+package data
+
+import (
+	"testing"
+
+	"cosmetcab.dp.ua/internal/assert"
+)
+
+func TestPrefixTSQuery(t *testing.T) {
+	assert.Equal(t, prefixTSQuery("Чистка  обличчя!"), "чистка:* & обличчя:*")
+	assert.Equal(t, prefixTSQuery("laser's & 'drop'"), "laser:* & s:* & drop:*")
+	assert.Equal(t, prefixTSQuery("?!"), "")
+}
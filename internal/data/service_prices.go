@@ -0,0 +1,160 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"cosmetcab.dp.ua/internal/validator"
+)
+
+// ServicePrice is a price of a service taking effect at EffectiveFrom. The
+// price in services is the one of the latest entry that took effect.
+type ServicePrice struct {
+	ID            int64     `json:"id"`
+	ServiceID     int64     `json:"service_id"`
+	Price         int       `json:"price"`
+	EffectiveFrom time.Time `json:"effective_from"`
+	CreatedAt     time.Time `json:"created_at"`
+	Current       bool      `json:"current"`
+	Scheduled     bool      `json:"scheduled"`
+}
+
+type ServicePriceModel struct {
+	DB *sql.DB
+}
+
+// ValidateServicePrice checks a price being scheduled at now. A minute in
+// the past is allowed for clocks that are slightly off.
+func ValidateServicePrice(v *validator.Validator, price *ServicePrice, now time.Time) {
+	v.Check(price.Price > 0, "price", "must be greater than zero")
+	v.Check(!price.EffectiveFrom.IsZero(), "effective_from", "must be provided")
+	v.Check(!price.EffectiveFrom.Before(now.Add(-time.Minute)), "effective_from", "must not be in the past")
+}
+
+// Schedule adds a price taking effect at EffectiveFrom, replacing a price
+// set for the same time. Prices taking effect now must be applied with
+// ApplyDue afterwards. The database keeps whole seconds and rounds, so
+// EffectiveFrom must be truncated to seconds first, or a price taking
+// effect now could be stored as scheduled for the next second.
+func (m ServicePriceModel) Schedule(price *ServicePrice) error {
+	query := `
+	INSERT INTO service_prices (service_id, price, effective_from)
+	VALUES ($1, $2, $3)
+	ON CONFLICT (service_id, effective_from)
+	DO UPDATE SET price = EXCLUDED.price
+	RETURNING id, effective_from, created_at`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, price.ServiceID, price.Price, price.EffectiveFrom).Scan(
+		&price.ID,
+		&price.EffectiveFrom,
+		&price.CreatedAt,
+	)
+	if err != nil {
+		return err
+	}
+	price.Scheduled = price.EffectiveFrom.After(time.Now())
+	return nil
+}
+
+// GetAllForService returns the price timeline of a service, oldest first,
+// with the price in effect now marked as current
+func (m ServicePriceModel) GetAllForService(serviceID int64) ([]*ServicePrice, error) {
+	query := `
+	SELECT id, service_id, price, effective_from, created_at, effective_from > NOW()
+	FROM service_prices
+	WHERE service_id = $1
+	ORDER BY effective_from`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, serviceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	prices := []*ServicePrice{}
+	for rows.Next() {
+		var price ServicePrice
+		err = rows.Scan(
+			&price.ID,
+			&price.ServiceID,
+			&price.Price,
+			&price.EffectiveFrom,
+			&price.CreatedAt,
+			&price.Scheduled,
+		)
+		if err != nil {
+			return nil, err
+		}
+		prices = append(prices, &price)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	markCurrentPrice(prices)
+	return prices, nil
+}
+
+// markCurrentPrice marks the price in effect in a timeline sorted oldest
+// first: the latest one that isn't scheduled. ApplyDue resolves the price
+// of services the same way.
+func markCurrentPrice(prices []*ServicePrice) {
+	for i := len(prices) - 1; i >= 0; i-- {
+		if !prices[i].Scheduled {
+			prices[i].Current = true
+			return
+		}
+	}
+}
+
+// DeleteScheduled removes a price that hasn't taken effect yet
+func (m ServicePriceModel) DeleteScheduled(serviceID, id int64) (*ServicePrice, error) {
+	query := `
+	DELETE FROM service_prices
+	WHERE id = $1 AND service_id = $2 AND effective_from > NOW()
+	RETURNING id, service_id, price, effective_from, created_at`
+	price := ServicePrice{Scheduled: true}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, id, serviceID).Scan(
+		&price.ID,
+		&price.ServiceID,
+		&price.Price,
+		&price.EffectiveFrom,
+		&price.CreatedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &price, nil
+}
+
+// ApplyDue sets the price of every service to its latest price that took
+// effect and returns the number of services whose price changed
+func (m ServicePriceModel) ApplyDue() (int64, error) {
+	query := `
+	UPDATE services
+	SET price = due.price
+	FROM (
+		SELECT DISTINCT ON (service_id) service_id, price
+		FROM service_prices
+		WHERE effective_from <= NOW()
+		ORDER BY service_id, effective_from DESC
+	) AS due
+	WHERE services.id = due.service_id
+	AND services.price <> due.price`
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	result, err := m.DB.ExecContext(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
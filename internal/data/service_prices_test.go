@@ -0,0 +1,48 @@
+package data
+
+import (
+	"testing"
+	"time"
+
+	"cosmetcab.dp.ua/internal/assert"
+	"cosmetcab.dp.ua/internal/validator"
+)
+
+func TestValidateServicePrice(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	v := validator.New()
+	ValidateServicePrice(v, &ServicePrice{Price: 500, EffectiveFrom: now}, now)
+	assert.Equal(t, v.Valid(), true)
+
+	v = validator.New()
+	ValidateServicePrice(v, &ServicePrice{Price: 500, EffectiveFrom: now.AddDate(0, 1, 0)}, now)
+	assert.Equal(t, v.Valid(), true)
+
+	// a clock slightly behind is tolerated
+	v = validator.New()
+	ValidateServicePrice(v, &ServicePrice{Price: 500, EffectiveFrom: now.Add(-30 * time.Second)}, now)
+	assert.Equal(t, v.Valid(), true)
+
+	v = validator.New()
+	ValidateServicePrice(v, &ServicePrice{Price: 500, EffectiveFrom: now.Add(-2 * time.Minute)}, now)
+	assert.Equal(t, v.Errors["effective_from"], "must not be in the past")
+
+	v = validator.New()
+	ValidateServicePrice(v, &ServicePrice{EffectiveFrom: now}, now)
+	assert.Equal(t, v.Errors["price"], "must be greater than zero")
+	assert.Equal(t, len(v.Errors), 1)
+}
+
+func TestMarkCurrentPrice(t *testing.T) {
+	prices := []*ServicePrice{{ID: 1}, {ID: 2}, {ID: 3, Scheduled: true}}
+	markCurrentPrice(prices)
+	assert.Equal(t, prices[0].Current, false)
+	assert.Equal(t, prices[1].Current, true)
+	assert.Equal(t, prices[2].Current, false)
+
+	// nothing is current before the first price takes effect
+	prices = []*ServicePrice{{ID: 1, Scheduled: true}}
+	markCurrentPrice(prices)
+	assert.Equal(t, prices[0].Current, false)
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
 	"time"
 
 	"cosmetcab.dp.ua/internal/validator"
@@ -16,6 +17,10 @@ type Service struct {
 	Price         int           `json:"price"`
 	CategoryID    int64         `json:"category_id"`
 	SubCategoryID int64         `json:"subcategory_id"`
+	// DiscountedPrice is the price after the best running promotion,
+	// set by Promotions.ApplyToService
+	DiscountedPrice int   `json:"discounted_price"`
+	PromotionID     int64 `json:"promotion_id,omitempty"`
 }
 
 type ServiceWithSubcategory struct {
@@ -24,23 +29,49 @@ type ServiceWithSubcategory struct {
 	Description string        `json:"description"`
 	Price       int           `json:"price"`
 	Subcategory SubCategory   `json:"subcategory"`
+	// DiscountedPrice is the price after the best running promotion, set
+	// by Promotions.ApplyToServiceWithSubcategory
+	DiscountedPrice int   `json:"discounted_price"`
+	PromotionID     int64 `json:"promotion_id,omitempty"`
+}
+
+// ServiceFilter restricts the services returned by ServiceModel.GetAll
+type ServiceFilter struct {
+	CategoryID    int64
+	SubCategoryID int64
+	MinPrice      int
+	MaxPrice      int
 }
 
 type ServiceModel struct {
 	DB *sql.DB
 }
 
+// Duration returns how long the service takes
+func (s *Service) Duration() time.Duration {
+	return time.Duration(s.Time.Int16) * time.Minute
+}
+
 func ValidateService(service *Service, v *validator.Validator) {
 	v.Check(service.Description != "", "description", "must be provided")
 	v.Check(service.Price > 0, "price", "must be greater than zero")
 	v.Check(service.Time.Int16 >= 0, "time", "must be greater or equal zero")
 
 }
+
+// Insert adds the service and starts its price history. effective_from
+// keeps whole seconds and would round NOW() up into the future, where
+// ApplyDue ignores it, so the time is truncated.
 func (m ServiceModel) Insert(service *Service) error {
 	query := `
-	INSERT INTO services (time, description, price, category_id, subcategory_id)
-	VALUES ($1, $2, $3, $4, $5)
-	RETURNING id
+	WITH inserted AS (
+		INSERT INTO services (time, description, price, category_id, subcategory_id)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, price
+	)
+	INSERT INTO service_prices (service_id, price, effective_from)
+	SELECT id, price, date_trunc('second', NOW()) FROM inserted
+	RETURNING service_id
 	`
 	args := []any{service.Time, service.Description, service.Price, service.CategoryID, service.SubCategoryID}
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
@@ -81,22 +112,39 @@ func (m ServiceModel) Get(id int64) (*Service, error) {
 
 }
 
-func (m ServiceModel) GetAll() ([]*Service, error) {
-	query := `
-	SELECT id, time, description, price, category_id, subcategory_id
+// GetAll returns a page of services matching the filter.
+// Zero values in the filter do not restrict the result.
+func (m ServiceModel) GetAll(filter ServiceFilter, filters Filters) ([]*Service, Metadata, error) {
+	query := fmt.Sprintf(`
+	SELECT count(*) OVER(), id, time, description, price, category_id, subcategory_id
 	FROM services
-	ORDER BY id`
+	WHERE (category_id = $1 OR $1 = 0)
+	AND (subcategory_id = $2 OR $2 = 0)
+	AND (price >= $3 OR $3 = 0)
+	AND (price <= $4 OR $4 = 0)
+	ORDER BY %s %s, id ASC
+	LIMIT $5 OFFSET $6`, filters.sortColumn(), filters.sortDirection())
+	args := []any{
+		filter.CategoryID,
+		filter.SubCategoryID,
+		filter.MinPrice,
+		filter.MaxPrice,
+		filters.limit(),
+		filters.offset(),
+	}
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
-	rows, err := m.DB.QueryContext(ctx, query)
+	rows, err := m.DB.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, err
+		return nil, Metadata{}, err
 	}
 	defer rows.Close()
+	totalRecords := 0
 	services := []*Service{}
 	for rows.Next() {
 		var service Service
 		err = rows.Scan(
+			&totalRecords,
 			&service.ID,
 			&service.Time,
 			&service.Description,
@@ -105,14 +153,15 @@ func (m ServiceModel) GetAll() ([]*Service, error) {
 			&service.SubCategoryID,
 		)
 		if err != nil {
-			return nil, err
+			return nil, Metadata{}, err
 		}
 		services = append(services, &service)
 	}
 	if err = rows.Err(); err != nil {
-		return nil, err
+		return nil, Metadata{}, err
 	}
-	return services, nil
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return services, metadata, nil
 }
 
 func (m ServiceModel) GetAllServicesWithSubcategoriesByID(category_id int64) ([]*ServiceWithSubcategory, error) {
@@ -163,11 +212,24 @@ func (m ServiceModel) GetAllServicesWithSubcategoriesByID(category_id int64) ([]
 	return servicesWithSubcategories, nil
 }
 
+// Update saves the service. A changed price is added to the price history
+// as taking effect now, truncated to seconds like in Insert.
 func (m ServiceModel) Update(service *Service) error {
 	query := `
-	UPDATE services
-	SET time=$1, description=$2, price=$3, category_id=$4, subcategory_id=$5
-	WHERE id=$6`
+	WITH old AS (
+		SELECT price FROM services WHERE id=$6
+	), updated AS (
+		UPDATE services
+		SET time=$1, description=$2, price=$3, category_id=$4, subcategory_id=$5
+		WHERE id=$6
+		RETURNING id, price
+	)
+	INSERT INTO service_prices (service_id, price, effective_from)
+	SELECT updated.id, updated.price, date_trunc('second', NOW())
+	FROM updated, old
+	WHERE updated.price <> old.price
+	ON CONFLICT (service_id, effective_from)
+	DO UPDATE SET price = EXCLUDED.price`
 	args := []any{
 		service.Time,
 		service.Description,
@@ -195,7 +257,7 @@ func (m ServiceModel) Delete(id int64) error {
 
 	result, err := m.DB.ExecContext(ctx, query, id)
 	if err != nil {
-		return err
+		return packageServiceError(err)
 	}
 
 	rowsAffected, err := result.RowsAffected()
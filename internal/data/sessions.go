@@ -0,0 +1,202 @@
+package data
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Session is a login session stored server side. Only the SHA-256 hash of
+// the token sent in the cookie is stored, so a leaked database cannot be
+// used to hijack sessions.
+type Session struct {
+	ID         int64     `json:"id"`
+	TokenHash  []byte    `json:"-"`
+	UserID     int64     `json:"-"`
+	Data       []byte    `json:"-"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Current    bool      `json:"current"`
+}
+
+type SessionModel struct {
+	DB *sql.DB
+}
+
+// HashToken returns the hash under which a token is stored
+func HashToken(token string) []byte {
+	hash := sha256.Sum256([]byte(token))
+	return hash[:]
+}
+
+func (m SessionModel) Insert(session *Session) error {
+	query := `
+	INSERT INTO sessions (token_hash, user_id, data, user_agent, ip, expires_at)
+	VALUES ($1, NULLIF($2, 0), $3, $4, $5, $6)
+	RETURNING id, created_at, last_seen_at`
+	args := []any{session.TokenHash, session.UserID, session.Data, session.UserAgent, session.IP, session.ExpiresAt}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&session.ID, &session.CreatedAt, &session.LastSeenAt)
+}
+
+// GetByToken returns the session with the given token hash and marks it as
+// seen. Sessions past their absolute expiry or idle for longer than
+// idleTimeout are reported as ErrRecordNotFound.
+func (m SessionModel) GetByToken(tokenHash []byte, idleTimeout time.Duration) (*Session, error) {
+	query := `
+	UPDATE sessions
+	SET last_seen_at = NOW()
+	WHERE token_hash = $1
+	AND expires_at > NOW()
+	AND last_seen_at > NOW() - make_interval(secs => $2)
+	RETURNING id, token_hash, COALESCE(user_id, 0), data, user_agent, ip, created_at, last_seen_at, expires_at`
+	var session Session
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, tokenHash, idleTimeout.Seconds()).Scan(
+		&session.ID,
+		&session.TokenHash,
+		&session.UserID,
+		&session.Data,
+		&session.UserAgent,
+		&session.IP,
+		&session.CreatedAt,
+		&session.LastSeenAt,
+		&session.ExpiresAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &session, nil
+}
+
+// Update stores the session data. ErrRecordNotFound is returned when the
+// session has been revoked in the meantime.
+func (m SessionModel) Update(session *Session) error {
+	query := `
+	UPDATE sessions
+	SET user_id = NULLIF($1, 0), data = $2
+	WHERE token_hash = $3`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	result, err := m.DB.ExecContext(ctx, query, session.UserID, session.Data, session.TokenHash)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+func (m SessionModel) DeleteByToken(tokenHash []byte) error {
+	query := `
+	DELETE FROM sessions
+	WHERE token_hash = $1`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err := m.DB.ExecContext(ctx, query, tokenHash)
+	return err
+}
+
+// Delete revokes a session of the given user
+func (m SessionModel) Delete(id, userID int64) error {
+	query := `
+	DELETE FROM sessions
+	WHERE id = $1 AND user_id = $2`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	result, err := m.DB.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// DeleteAllForUser revokes every session of the user
+func (m SessionModel) DeleteAllForUser(userID int64) error {
+	query := `
+	DELETE FROM sessions
+	WHERE user_id = $1`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err := m.DB.ExecContext(ctx, query, userID)
+	return err
+}
+
+// GetAllForUser returns the active sessions of the user, most recently used first
+func (m SessionModel) GetAllForUser(userID int64, idleTimeout time.Duration) ([]*Session, error) {
+	query := `
+	SELECT id, token_hash, user_id, user_agent, ip, created_at, last_seen_at, expires_at
+	FROM sessions
+	WHERE user_id = $1
+	AND expires_at > NOW()
+	AND last_seen_at > NOW() - make_interval(secs => $2)
+	ORDER BY last_seen_at DESC, id DESC`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, userID, idleTimeout.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	sessions := []*Session{}
+	for rows.Next() {
+		var session Session
+		err = rows.Scan(
+			&session.ID,
+			&session.TokenHash,
+			&session.UserID,
+			&session.UserAgent,
+			&session.IP,
+			&session.CreatedAt,
+			&session.LastSeenAt,
+			&session.ExpiresAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, &session)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// DeleteExpired removes sessions that can no longer be used
+func (m SessionModel) DeleteExpired(idleTimeout time.Duration) (int64, error) {
+	query := `
+	DELETE FROM sessions
+	WHERE expires_at <= NOW()
+	OR last_seen_at <= NOW() - make_interval(secs => $1)`
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	result, err := m.DB.ExecContext(ctx, query, idleTimeout.Seconds())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
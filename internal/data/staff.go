@@ -0,0 +1,312 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"cosmetcab.dp.ua/internal/validator"
+)
+
+type Staff struct {
+	ID       int64  `json:"id"`
+	Name     string `json:"name"`
+	Bio      string `json:"bio"`
+	PhotoURL string `json:"photo_url"`
+}
+
+// StaffService links a master to a service they offer. Price and Time
+// override the service's own values when they are set.
+type StaffService struct {
+	StaffID   int64         `json:"staff_id"`
+	ServiceID int64         `json:"service_id"`
+	Price     sql.NullInt32 `json:"price"`
+	Time      sql.NullInt16 `json:"time"`
+}
+
+// ServiceMaster is a master offering a particular service
+// with the price and duration they charge for it.
+type ServiceMaster struct {
+	Staff
+	Price int           `json:"price"`
+	Time  sql.NullInt16 `json:"time"`
+}
+
+// Duration returns how long the service takes when done by this master
+func (m *ServiceMaster) Duration() time.Duration {
+	return time.Duration(m.Time.Int16) * time.Minute
+}
+
+type StaffModel struct {
+	DB *sql.DB
+}
+
+func ValidateStaff(staff *Staff, v *validator.Validator) {
+	v.Check(staff.Name != "", "name", "must be provided")
+	v.Check(len([]rune(staff.Name)) <= 100, "name", "must not be more than 100 chars")
+	v.Check(len([]rune(staff.Bio)) <= 1000, "bio", "must not be more than 1000 chars")
+}
+
+func ValidateStaffService(staffService *StaffService, v *validator.Validator) {
+	v.Check(!staffService.Price.Valid || staffService.Price.Int32 > 0, "price", "must be greater than zero")
+	v.Check(!staffService.Time.Valid || staffService.Time.Int16 > 0, "time", "must be greater than zero")
+}
+
+func (m StaffModel) Insert(staff *Staff) error {
+	query := `
+	INSERT INTO staff (name, bio, photo_url)
+	VALUES ($1, $2, $3)
+	RETURNING id`
+	args := []any{staff.Name, staff.Bio, staff.PhotoURL}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&staff.ID)
+}
+
+func (m StaffModel) Get(id int64) (*Staff, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := `
+	SELECT id, name, bio, photo_url
+	FROM staff
+	WHERE id=$1`
+	var staff Staff
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&staff.ID,
+		&staff.Name,
+		&staff.Bio,
+		&staff.PhotoURL,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &staff, nil
+}
+
+// GetAll returns a page of masters whose name contains the given text
+func (m StaffModel) GetAll(name string, filters Filters) ([]*Staff, Metadata, error) {
+	query := fmt.Sprintf(`
+	SELECT count(*) OVER(), id, name, bio, photo_url
+	FROM staff
+	WHERE (name ILIKE '%%' || $1 || '%%' OR $1 = '')
+	ORDER BY %s %s, id ASC
+	LIMIT $2 OFFSET $3`, filters.sortColumn(), filters.sortDirection())
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, name, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+	totalRecords := 0
+	staffList := []*Staff{}
+	for rows.Next() {
+		var staff Staff
+		err = rows.Scan(
+			&totalRecords,
+			&staff.ID,
+			&staff.Name,
+			&staff.Bio,
+			&staff.PhotoURL,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		staffList = append(staffList, &staff)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return staffList, metadata, nil
+}
+
+func (m StaffModel) Update(staff *Staff) error {
+	query := `
+	UPDATE staff
+	SET name=$1, bio=$2, photo_url=$3
+	WHERE id=$4`
+	args := []any{staff.Name, staff.Bio, staff.PhotoURL, staff.ID}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err := m.DB.ExecContext(ctx, query, args...)
+	return err
+}
+
+// Delete removes the master and keeps their appointments unassigned.
+// ErrAppointmentOverlap means some of them would overlap with other
+// unassigned appointments.
+func (m StaffModel) Delete(id int64) (string, error) {
+	if id < 1 {
+		return "", ErrRecordNotFound
+	}
+	query := `
+	DELETE FROM staff
+	WHERE id=$1
+	RETURNING photo_url`
+	var photoURL string
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(&photoURL)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return "", ErrRecordNotFound
+		default:
+			return "", appointmentError(err)
+		}
+	}
+	return photoURL, nil
+}
+
+// AssignService links a service to a master or replaces the
+// overrides of an existing assignment.
+func (m StaffModel) AssignService(staffService *StaffService) error {
+	query := `
+	INSERT INTO staff_services (staff_id, service_id, price, time)
+	VALUES ($1, $2, $3, $4)
+	ON CONFLICT (staff_id, service_id)
+	DO UPDATE SET price = EXCLUDED.price, time = EXCLUDED.time`
+	args := []any{staffService.StaffID, staffService.ServiceID, staffService.Price, staffService.Time}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err := m.DB.ExecContext(ctx, query, args...)
+	return err
+}
+
+func (m StaffModel) UnassignService(staffID, serviceID int64) error {
+	query := `
+	DELETE FROM staff_services
+	WHERE staff_id=$1 AND service_id=$2`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	result, err := m.DB.ExecContext(ctx, query, staffID, serviceID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// GetServices returns the services offered by a master with the
+// master's price and duration overrides applied.
+func (m StaffModel) GetServices(staffID int64) ([]*Service, error) {
+	query := `
+	SELECT s.id, COALESCE(ss.time, s.time), s.description, COALESCE(ss.price, s.price), s.category_id, s.subcategory_id
+	FROM staff_services ss
+	JOIN services s ON ss.service_id = s.id
+	WHERE ss.staff_id = $1
+	ORDER BY s.id`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, staffID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	services := []*Service{}
+	for rows.Next() {
+		var service Service
+		err = rows.Scan(
+			&service.ID,
+			&service.Time,
+			&service.Description,
+			&service.Price,
+			&service.CategoryID,
+			&service.SubCategoryID,
+		)
+		if err != nil {
+			return nil, err
+		}
+		services = append(services, &service)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return services, nil
+}
+
+// GetServiceMaster returns a master offering the given service
+func (m StaffModel) GetServiceMaster(staffID, serviceID int64) (*ServiceMaster, error) {
+	query := `
+	SELECT st.id, st.name, st.bio, st.photo_url, COALESCE(ss.price, s.price), COALESCE(ss.time, s.time)
+	FROM staff_services ss
+	JOIN staff st ON ss.staff_id = st.id
+	JOIN services s ON ss.service_id = s.id
+	WHERE ss.staff_id = $1 AND ss.service_id = $2`
+	var master ServiceMaster
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, staffID, serviceID).Scan(
+		&master.ID,
+		&master.Name,
+		&master.Bio,
+		&master.PhotoURL,
+		&master.Price,
+		&master.Time,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &master, nil
+}
+
+// GetMastersForService returns the masters offering a service
+// together with the price and duration each of them charges.
+func (m StaffModel) GetMastersForService(serviceID int64) ([]*ServiceMaster, error) {
+	query := `
+	SELECT st.id, st.name, st.bio, st.photo_url, COALESCE(ss.price, s.price), COALESCE(ss.time, s.time)
+	FROM staff_services ss
+	JOIN staff st ON ss.staff_id = st.id
+	JOIN services s ON ss.service_id = s.id
+	WHERE ss.service_id = $1
+	ORDER BY st.id`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, serviceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	masters := []*ServiceMaster{}
+	for rows.Next() {
+		var master ServiceMaster
+		err = rows.Scan(
+			&master.ID,
+			&master.Name,
+			&master.Bio,
+			&master.PhotoURL,
+			&master.Price,
+			&master.Time,
+		)
+		if err != nil {
+			return nil, err
+		}
+		masters = append(masters, &master)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return masters, nil
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
 	"time"
 
 	"cosmetcab.dp.ua/internal/validator"
@@ -58,34 +59,41 @@ func (m SubCategoryModel) Get(id int64) (*SubCategory, error) {
 	return &subCategory, nil
 }
 
-func (m SubCategoryModel) GetAll() ([]*SubCategory, error) {
-	query := `
-	SELECT id, name
-	FROM subcategories`
+// GetAll returns a page of subcategories whose name contains the given text
+func (m SubCategoryModel) GetAll(name string, filters Filters) ([]*SubCategory, Metadata, error) {
+	query := fmt.Sprintf(`
+	SELECT count(*) OVER(), id, name
+	FROM subcategories
+	WHERE (name ILIKE '%%' || $1 || '%%' OR $1 = '')
+	ORDER BY %s %s, id ASC
+	LIMIT $2 OFFSET $3`, filters.sortColumn(), filters.sortDirection())
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
-	rows, err := m.DB.QueryContext(ctx, query)
+	rows, err := m.DB.QueryContext(ctx, query, name, filters.limit(), filters.offset())
 	if err != nil {
-		return nil, err
+		return nil, Metadata{}, err
 	}
 	defer rows.Close()
+	totalRecords := 0
 	subCategories := []*SubCategory{}
 	for rows.Next() {
 		var subCategory SubCategory
 		err := rows.Scan(
+			&totalRecords,
 			&subCategory.ID,
 			&subCategory.Name,
 		)
 		if err != nil {
-			return nil, err
+			return nil, Metadata{}, err
 		}
 		subCategories = append(subCategories, &subCategory)
 	}
 	if err = rows.Err(); err != nil {
-		return nil, err
+		return nil, Metadata{}, err
 	}
-	return subCategories, nil
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return subCategories, metadata, nil
 
 }
 
@@ -112,7 +120,8 @@ func (m SubCategoryModel) Delete(id int64) error {
 	defer cancel()
 	result, err := m.DB.ExecContext(ctx, query, id)
 	if err != nil {
-		return err
+		// the services of the subcategory are deleted with it
+		return packageServiceError(err)
 	}
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
@@ -0,0 +1,193 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"time"
+
+	"cosmetcab.dp.ua/internal/validator"
+)
+
+const (
+	ScopeActivation     = "activation"
+	ScopeAuthentication = "authentication"
+	ScopePasswordReset  = "password-reset"
+	// ScopeTwoFactor tokens identify a login that passed the password
+	// check and waits for the second factor
+	ScopeTwoFactor = "two-factor"
+)
+
+// Token is a bearer token. The plaintext is only known when the token is
+// created, the database keeps its SHA-256 hash.
+type Token struct {
+	ID        int64     `json:"id"`
+	Plaintext string    `json:"token,omitempty"`
+	Hash      []byte    `json:"-"`
+	UserID    int64     `json:"-"`
+	Scope     string    `json:"scope"`
+	Expiry    time.Time `json:"expiry"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type TokenModel struct {
+	DB *sql.DB
+}
+
+// RandomString returns n random bytes encoded in base32 without padding.
+// It is used for tokens, session ids, request ids and recovery codes.
+func RandomString(n int) (string, error) {
+	randomBytes := make([]byte, n)
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return "", err
+	}
+	return base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes), nil
+}
+
+// generateToken creates a token from 128 random bits. Encoded in base32
+// without padding the plaintext is 26 characters long, which is what
+// ValidateTokenPlaintext expects.
+func generateToken(userID int64, ttl time.Duration, scope string) (*Token, error) {
+	plaintext, err := RandomString(16)
+	if err != nil {
+		return nil, err
+	}
+	return &Token{
+		Plaintext: plaintext,
+		Hash:      HashToken(plaintext),
+		UserID:    userID,
+		Scope:     scope,
+		Expiry:    time.Now().Add(ttl),
+	}, nil
+}
+
+func ValidateTokenPlaintext(v *validator.Validator, tokenPlaintext string) {
+	v.Check(tokenPlaintext != "", "token", "must be provided")
+	v.Check(len(tokenPlaintext) == 26, "token", "must be 26 bytes long")
+}
+
+// New creates and stores a token of the given scope for the user
+func (m TokenModel) New(userID int64, ttl time.Duration, scope string) (*Token, error) {
+	token, err := generateToken(userID, ttl, scope)
+	if err != nil {
+		return nil, err
+	}
+	err = m.Insert(token)
+	return token, err
+}
+
+func (m TokenModel) Insert(token *Token) error {
+	query := `
+	INSERT INTO tokens (hash, user_id, scope, expiry)
+	VALUES ($1, $2, $3, $4)
+	RETURNING id, created_at`
+	args := []any{token.Hash, token.UserID, token.Scope, token.Expiry}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&token.ID, &token.CreatedAt)
+}
+
+// GetUserIDForToken returns the owner of an unexpired token of the given scope
+func (m TokenModel) GetUserIDForToken(scope, tokenPlaintext string) (int64, error) {
+	query := `
+	SELECT user_id
+	FROM tokens
+	WHERE hash = $1 AND scope = $2 AND expiry > NOW()`
+	var userID int64
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, HashToken(tokenPlaintext), scope).Scan(&userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return 0, ErrRecordNotFound
+		default:
+			return 0, err
+		}
+	}
+	return userID, nil
+}
+
+// GetAllForUser returns the unexpired tokens of the given scope, newest first
+func (m TokenModel) GetAllForUser(scope string, userID int64) ([]*Token, error) {
+	query := `
+	SELECT id, user_id, scope, expiry, created_at
+	FROM tokens
+	WHERE scope = $1 AND user_id = $2 AND expiry > NOW()
+	ORDER BY created_at DESC, id DESC`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, scope, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	tokens := []*Token{}
+	for rows.Next() {
+		var token Token
+		err = rows.Scan(
+			&token.ID,
+			&token.UserID,
+			&token.Scope,
+			&token.Expiry,
+			&token.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, &token)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// Delete revokes a token of the given user
+func (m TokenModel) Delete(id, userID int64) error {
+	query := `
+	DELETE FROM tokens
+	WHERE id = $1 AND user_id = $2`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	result, err := m.DB.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// DeleteAllForUser revokes every token of the given scope that belongs to the user
+func (m TokenModel) DeleteAllForUser(scope string, userID int64) error {
+	query := `
+	DELETE FROM tokens
+	WHERE scope = $1 AND user_id = $2`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err := m.DB.ExecContext(ctx, query, scope, userID)
+	return err
+}
+
+// DeleteExpired removes tokens that can no longer be used
+func (m TokenModel) DeleteExpired() (int64, error) {
+	query := `
+	DELETE FROM tokens
+	WHERE expiry <= NOW()`
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	result, err := m.DB.ExecContext(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
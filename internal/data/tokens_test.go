@@ -0,0 +1,31 @@
+package data
+
+import (
+	"testing"
+	"time"
+
+	"cosmetcab.dp.ua/internal/assert"
+	"cosmetcab.dp.ua/internal/validator"
+)
+
+// TestGenerateToken tests that generated tokens pass ValidateTokenPlaintext
+func TestGenerateToken(t *testing.T) {
+	token, err := generateToken(1, time.Hour, ScopeAuthentication)
+	assert.Equal(t, err, nil)
+
+	v := validator.New()
+	ValidateTokenPlaintext(v, token.Plaintext)
+	assert.Equal(t, v.Valid(), true)
+	assert.Equal(t, string(token.Hash), string(HashToken(token.Plaintext)))
+}
+
+// TestRandomString tests the length of the encoded strings
+func TestRandomString(t *testing.T) {
+	s, err := RandomString(16)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, len(s), 26)
+
+	s, err = RandomString(7)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, len(s), 12)
+}
@@ -0,0 +1,235 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"cosmetcab.dp.ua/internal/validator"
+	"github.com/lib/pq"
+)
+
+const (
+	LanguageUkrainian = "uk"
+	LanguageEnglish   = "en"
+	LanguageRussian   = "ru"
+)
+
+// Languages are the languages the catalogue can be translated to
+var Languages = []string{LanguageUkrainian, LanguageEnglish, LanguageRussian}
+
+// Entities with translatable text
+const (
+	TranslationCategory    = "category"
+	TranslationSubCategory = "subcategory"
+	TranslationService     = "service"
+)
+
+// Translation is the text of a catalogue entity in one language. Only the
+// fields the entity has are used: title and description for categories,
+// name for subcategories and description for services.
+type Translation struct {
+	Lang        string `json:"lang"`
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	Name        string `json:"name,omitempty"`
+}
+
+// translationTable describes where the translations of an entity are kept
+type translationTable struct {
+	table    string
+	idColumn string
+	columns  []string
+}
+
+var translationTables = map[string]translationTable{
+	TranslationCategory:    {"category_translations", "category_id", []string{"title", "description"}},
+	TranslationSubCategory: {"subcategory_translations", "subcategory_id", []string{"name"}},
+	TranslationService:     {"service_translations", "service_id", []string{"description"}},
+}
+
+// fields returns pointers to the fields stored in the given columns
+func (t *Translation) fields(columns []string) []any {
+	fields := make([]any, len(columns))
+	for i, column := range columns {
+		switch column {
+		case "title":
+			fields[i] = &t.Title
+		case "description":
+			fields[i] = &t.Description
+		case "name":
+			fields[i] = &t.Name
+		}
+	}
+	return fields
+}
+
+type TranslationModel struct {
+	DB *sql.DB
+}
+
+func ValidateTranslation(v *validator.Validator, entity string, t *Translation) {
+	v.Check(validator.PermittedValue(t.Lang, Languages...), "lang", "must be uk, en or ru")
+	switch entity {
+	case TranslationCategory:
+		v.Check(t.Title != "", "title", "must be provided")
+		v.Check(len([]rune(t.Title)) <= 55, "title", "must not be more than 55 chars")
+		v.Check(t.Name == "", "name", "categories have no name")
+	case TranslationSubCategory:
+		v.Check(t.Name != "", "name", "must be provided")
+		v.Check(t.Title == "", "title", "subcategories have no title")
+		v.Check(t.Description == "", "description", "subcategories have no description")
+	case TranslationService:
+		v.Check(t.Description != "", "description", "must be provided")
+		v.Check(t.Title == "", "title", "services have no title")
+		v.Check(t.Name == "", "name", "services have no name")
+	}
+}
+
+// GetAll returns every translation of an entity
+func (m TranslationModel) GetAll(entity string, id int64) ([]*Translation, error) {
+	table := translationTables[entity]
+	query := fmt.Sprintf(`
+	SELECT lang, %s
+	FROM %s
+	WHERE %s = $1
+	ORDER BY lang`, strings.Join(table.columns, ", "), table.table, table.idColumn)
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	translations := []*Translation{}
+	for rows.Next() {
+		var t Translation
+		err = rows.Scan(append([]any{&t.Lang}, t.fields(table.columns)...)...)
+		if err != nil {
+			return nil, err
+		}
+		translations = append(translations, &t)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return translations, nil
+}
+
+// GetForLanguage returns the translations of the entities to a language
+// by entity id. Entities without a translation are left out.
+func (m TranslationModel) GetForLanguage(entity, lang string, ids []int64) (map[int64]*Translation, error) {
+	translations := make(map[int64]*Translation)
+	if len(ids) == 0 {
+		return translations, nil
+	}
+	table := translationTables[entity]
+	query := fmt.Sprintf(`
+	SELECT %s, lang, %s
+	FROM %s
+	WHERE lang = $1 AND %s = ANY($2)`, table.idColumn, strings.Join(table.columns, ", "), table.table, table.idColumn)
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, lang, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		var t Translation
+		err = rows.Scan(append([]any{&id, &t.Lang}, t.fields(table.columns)...)...)
+		if err != nil {
+			return nil, err
+		}
+		translations[id] = &t
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return translations, nil
+}
+
+// Set adds a translation of an entity or replaces the existing one
+func (m TranslationModel) Set(entity string, id int64, t *Translation) error {
+	table := translationTables[entity]
+	placeholders := make([]string, len(table.columns))
+	updates := make([]string, len(table.columns))
+	for i, column := range table.columns {
+		placeholders[i] = fmt.Sprintf("$%d", i+3)
+		updates[i] = fmt.Sprintf("%s = EXCLUDED.%s", column, column)
+	}
+	query := fmt.Sprintf(`
+	INSERT INTO %s (%s, lang, %s)
+	VALUES ($1, $2, %s)
+	ON CONFLICT (%s, lang)
+	DO UPDATE SET %s`,
+		table.table, table.idColumn, strings.Join(table.columns, ", "),
+		strings.Join(placeholders, ", "),
+		table.idColumn, strings.Join(updates, ", "))
+	args := append([]any{id, t.Lang}, t.fields(table.columns)...)
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err := m.DB.ExecContext(ctx, query, args...)
+	return err
+}
+
+func (m TranslationModel) Delete(entity string, id int64, lang string) error {
+	table := translationTables[entity]
+	query := fmt.Sprintf(`
+	DELETE FROM %s
+	WHERE %s = $1 AND lang = $2`, table.table, table.idColumn)
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	result, err := m.DB.ExecContext(ctx, query, id, lang)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// Localize replaces the text of the category with the translation. Empty
+// fields keep the text in the default language.
+func (c *Category) Localize(t *Translation) {
+	if t == nil {
+		return
+	}
+	if t.Title != "" {
+		c.Title = t.Title
+	}
+	if t.Description != "" {
+		c.Description = t.Description
+	}
+}
+
+// Localize replaces the name of the subcategory with the translation
+func (s *SubCategory) Localize(t *Translation) {
+	if t != nil && t.Name != "" {
+		s.Name = t.Name
+	}
+}
+
+// Localize replaces the description of the service with the translation
+func (s *Service) Localize(t *Translation) {
+	if t != nil && t.Description != "" {
+		s.Description = t.Description
+	}
+}
+
+// Localize replaces the description of the service and the name of its
+// subcategory with their translations
+func (s *ServiceWithSubcategory) Localize(service, subCategory *Translation) {
+	if service != nil && service.Description != "" {
+		s.Description = service.Description
+	}
+	s.Subcategory.Localize(subCategory)
+}
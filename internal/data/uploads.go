@@ -0,0 +1,145 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Upload is a blob a user was allowed to upload with a pre-signed URL.
+// It is removed once the blob is attached or the upload expires.
+type Upload struct {
+	ID        int64     `json:"id"`
+	BlobName  string    `json:"blob_name"`
+	UserID    int64     `json:"-"`
+	ExpiresAt time.Time `json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Expired reports whether the pre-signed URL of the upload is no longer valid
+func (u *Upload) Expired() bool {
+	return !time.Now().Before(u.ExpiresAt)
+}
+
+type UploadModel struct {
+	DB *sql.DB
+}
+
+func (m UploadModel) Insert(upload *Upload) error {
+	query := `
+	INSERT INTO uploads (blob_name, user_id, expires_at)
+	VALUES ($1, $2, $3)
+	RETURNING id, created_at`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	return m.DB.QueryRowContext(ctx, query, upload.BlobName, upload.UserID, upload.ExpiresAt).Scan(&upload.ID, &upload.CreatedAt)
+}
+
+func (m UploadModel) Get(id int64) (*Upload, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := `
+	SELECT id, blob_name, user_id, expires_at, created_at
+	FROM uploads
+	WHERE id = $1`
+	var upload Upload
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&upload.ID,
+		&upload.BlobName,
+		&upload.UserID,
+		&upload.ExpiresAt,
+		&upload.CreatedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &upload, nil
+}
+
+// GetByBlobName returns the upload a pre-signed URL was issued for
+func (m UploadModel) GetByBlobName(blobName string) (*Upload, error) {
+	query := `
+	SELECT id, blob_name, user_id, expires_at, created_at
+	FROM uploads
+	WHERE blob_name = $1`
+	var upload Upload
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, blobName).Scan(
+		&upload.ID,
+		&upload.BlobName,
+		&upload.UserID,
+		&upload.ExpiresAt,
+		&upload.CreatedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &upload, nil
+}
+
+// Delete removes the upload. It returns ErrRecordNotFound when the upload
+// was already confirmed, so the same blob is never attached twice.
+func (m UploadModel) Delete(id int64) error {
+	query := `
+	DELETE FROM uploads
+	WHERE id = $1`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// DeleteExpired removes uploads that were never confirmed, keeping them
+// for the grace period after expiry so that a confirmation started just
+// before the expiry can finish. The blob names are returned so the blobs
+// can be deleted too.
+func (m UploadModel) DeleteExpired(grace time.Duration) ([]string, error) {
+	query := `
+	DELETE FROM uploads
+	WHERE expires_at <= $1
+	RETURNING blob_name`
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, time.Now().Add(-grace))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	blobNames := []string{}
+	for rows.Next() {
+		var blobName string
+		if err = rows.Scan(&blobName); err != nil {
+			return nil, err
+		}
+		blobNames = append(blobNames, blobName)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return blobNames, nil
+}
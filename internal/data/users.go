@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
 	"time"
 
 	"cosmetcab.dp.ua/internal/validator"
@@ -20,7 +21,23 @@ type User struct {
 	Email     string   `json:"email"`
 	Password  password `json:"-"`
 	Activated bool     `json:"activated"`
-	Version   int      `json:"version"`
+	Role      string   `json:"role"`
+	// TOTPSecret is set when enrolment starts, TOTPEnabled once
+	// the first code has been confirmed
+	TOTPSecret   string `json:"-"`
+	TOTPEnabled  bool   `json:"totp_enabled"`
+	TOTPLastStep int64  `json:"-"`
+	// PasswordChangeRequired blocks logins until the password was reset
+	PasswordChangeRequired bool `json:"password_change_required"`
+	Version                int  `json:"version"`
+}
+
+// UserFilter narrows the users returned by GetAll. Query matches the name
+// or email, a nil Activated matches both states.
+type UserFilter struct {
+	Query     string
+	Role      string
+	Activated *bool
 }
 
 type password struct {
@@ -67,11 +84,16 @@ func ValidatePasswordPlaintext(v *validator.Validator, password string) {
 	v.Check(len(password) <= 72, "password", "must be less than 72 bytes")
 }
 
+func ValidateRole(v *validator.Validator, role string) {
+	v.Check(validator.PermittedValue(role, RoleOwner, RoleAdmin, RoleStaff, RoleViewer), "role", "must be owner, admin, staff or viewer")
+}
+
 func ValidateUser(v *validator.Validator, user *User) {
 	v.Check(user.Name != "", "name", "must be provided")
 	v.Check(len(user.Name) <= 500, "name", "must not be more than 500 bytes long")
 
 	ValidateEmail(v, user.Email)
+	ValidateRole(v, user.Role)
 	if user.Password.plaintext != nil {
 		ValidatePasswordPlaintext(v, *user.Password.plaintext)
 	}
@@ -84,10 +106,10 @@ func ValidateUser(v *validator.Validator, user *User) {
 
 func (m UserModel) Insert(user *User) error {
 	query := `
-	INSERT INTO users (name, email, password_hash, activated)
-	VALUES ($1, $2, $3, $4)
+	INSERT INTO users (name, email, password_hash, activated, role)
+	VALUES ($1, $2, $3, $4, $5)
 	RETURNING id, version`
-	args := []any{user.Name, user.Email, user.Password.hash, user.Activated}
+	args := []any{user.Name, user.Email, user.Password.hash, user.Activated, user.Role}
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
@@ -106,7 +128,7 @@ func (m UserModel) Insert(user *User) error {
 
 func (m UserModel) GetByEmail(email string) (*User, error) {
 	query :=
-		`SELECT id, name, email, password_hash, activated, version
+		`SELECT id, name, email, password_hash, activated, role, totp_secret, totp_enabled, totp_last_step, password_change_required, version
 		FROM users
 		WHERE email = $1`
 	var user User
@@ -118,6 +140,86 @@ func (m UserModel) GetByEmail(email string) (*User, error) {
 		&user.Email,
 		&user.Password.hash,
 		&user.Activated,
+		&user.Role,
+		&user.TOTPSecret,
+		&user.TOTPEnabled,
+		&user.TOTPLastStep,
+		&user.PasswordChangeRequired,
+		&user.Version,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+
+	}
+	return &user, nil
+}
+
+func (m UserModel) Get(id int64) (*User, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query :=
+		`SELECT id, name, email, password_hash, activated, role, totp_secret, totp_enabled, totp_last_step, password_change_required, version
+		FROM users
+		WHERE id = $1`
+	var user User
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&user.ID,
+		&user.Name,
+		&user.Email,
+		&user.Password.hash,
+		&user.Activated,
+		&user.Role,
+		&user.TOTPSecret,
+		&user.TOTPEnabled,
+		&user.TOTPLastStep,
+		&user.PasswordChangeRequired,
+		&user.Version,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+
+	}
+	return &user, nil
+}
+
+// GetForToken returns the owner of an unexpired token of the given scope
+func (m UserModel) GetForToken(tokenScope, tokenPlaintext string) (*User, error) {
+	query :=
+		`SELECT users.id, users.name, users.email, users.password_hash, users.activated, users.role, users.totp_secret, users.totp_enabled, users.totp_last_step, users.password_change_required, users.version
+		FROM users
+		INNER JOIN tokens ON users.id = tokens.user_id
+		WHERE tokens.hash = $1
+		AND tokens.scope = $2
+		AND tokens.expiry > NOW()`
+	var user User
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, HashToken(tokenPlaintext), tokenScope).Scan(
+		&user.ID,
+		&user.Name,
+		&user.Email,
+		&user.Password.hash,
+		&user.Activated,
+		&user.Role,
+		&user.TOTPSecret,
+		&user.TOTPEnabled,
+		&user.TOTPLastStep,
+		&user.PasswordChangeRequired,
 		&user.Version,
 	)
 
@@ -136,14 +238,18 @@ func (m UserModel) GetByEmail(email string) (*User, error) {
 func (m UserModel) Update(user *User) error {
 	query := `
 	UPDATE users
-	SET name = $1, email = $2, password_hash=$3, activated = $4, version = version + 1
-	WHERE id = $5 and version = $6
+	SET name = $1, email = $2, password_hash=$3, activated = $4, role = $5, totp_secret = $6, totp_enabled = $7, password_change_required = $8, version = version + 1
+	WHERE id = $9 and version = $10
 	RETURNING version`
 	args := []any{
 		user.Name,
 		user.Email,
 		user.Password.hash,
 		user.Activated,
+		user.Role,
+		user.TOTPSecret,
+		user.TOTPEnabled,
+		user.PasswordChangeRequired,
 		user.ID,
 		user.Version,
 	}
@@ -163,3 +269,100 @@ func (m UserModel) Update(user *User) error {
 	}
 	return nil
 }
+
+// GetAll returns the users matching the filter
+func (m UserModel) GetAll(filter UserFilter, filters Filters) ([]*User, Metadata, error) {
+	query := fmt.Sprintf(`
+	SELECT count(*) OVER(), id, name, email, activated, role, totp_enabled, password_change_required, version
+	FROM users
+	WHERE (name ILIKE '%%' || $1 || '%%' OR email ILIKE '%%' || $1 || '%%' OR $1 = '')
+	AND (role = $2 OR $2 = '')
+	AND (activated = $3 OR $3 IS NULL)
+	ORDER BY %s %s, id ASC
+	LIMIT $4 OFFSET $5`, filters.sortColumn(), filters.sortDirection())
+	args := []any{filter.Query, filter.Role, filter.Activated, filters.limit(), filters.offset()}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+	totalRecords := 0
+	users := []*User{}
+	for rows.Next() {
+		var user User
+		err = rows.Scan(
+			&totalRecords,
+			&user.ID,
+			&user.Name,
+			&user.Email,
+			&user.Activated,
+			&user.Role,
+			&user.TOTPEnabled,
+			&user.PasswordChangeRequired,
+			&user.Version,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		users = append(users, &user)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return users, metadata, nil
+}
+
+// Delete removes the user together with their sessions, tokens and
+// recovery codes
+func (m UserModel) Delete(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+	query := `
+	DELETE FROM users
+	WHERE id = $1`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// TwoFactorRequired reports whether the role of the user may only use
+// the admin API with two-factor authentication enabled
+func (u *User) TwoFactorRequired() bool {
+	return u.Role == RoleOwner || u.Role == RoleAdmin
+}
+
+// UseTOTPStep records that a code of the given time step was accepted. It
+// reports false when a code of the same or a later step was used already,
+// which makes concurrent replays of one code fail.
+func (m UserModel) UseTOTPStep(id, step int64) (bool, error) {
+	query := `
+	UPDATE users
+	SET totp_last_step = $1
+	WHERE id = $2 AND totp_last_step < $1`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	result, err := m.DB.ExecContext(ctx, query, step, id)
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected > 0, nil
+}
@@ -0,0 +1,96 @@
+package mailer
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"mime/multipart"
+	"net/textproto"
+	"strings"
+	"text/template"
+)
+
+//go:embed "templates"
+var templateFS embed.FS
+
+// Mailer sends templated emails through an SMTP server. Every template
+// defines a "subject", a "plainBody" and an "htmlBody" template and the
+// email carries both bodies as alternatives.
+type Mailer struct {
+	smtp *SMTP
+}
+
+func New(smtp *SMTP) Mailer {
+	return Mailer{smtp: smtp}
+}
+
+func (m Mailer) Send(recipient, templateFile string, data any) error {
+	if m.smtp.Host == "" {
+		return fmt.Errorf("mailer: no SMTP host configured to send %s", templateFile)
+	}
+	tmpl, err := template.New("email").ParseFS(templateFS, "templates/"+templateFile)
+	if err != nil {
+		return err
+	}
+	subject := new(bytes.Buffer)
+	err = tmpl.ExecuteTemplate(subject, "subject", data)
+	if err != nil {
+		return err
+	}
+	plainBody := new(bytes.Buffer)
+	err = tmpl.ExecuteTemplate(plainBody, "plainBody", data)
+	if err != nil {
+		return err
+	}
+	htmlTmpl, err := htmltemplate.New("email").ParseFS(templateFS, "templates/"+templateFile)
+	if err != nil {
+		return err
+	}
+	htmlBody := new(bytes.Buffer)
+	err = htmlTmpl.ExecuteTemplate(htmlBody, "htmlBody", data)
+	if err != nil {
+		return err
+	}
+
+	body, contentType, err := alternatives(plainBody.String(), htmlBody.String())
+	if err != nil {
+		return err
+	}
+	err = m.smtp.Send([]string{recipient}, strings.TrimSpace(subject.String()), contentType, body)
+	if err != nil {
+		return fmt.Errorf("mailer: %w", err)
+	}
+	return nil
+}
+
+// alternatives builds a multipart/alternative body with a plain text and
+// an HTML part and returns it with its content type
+func alternatives(plainBody, htmlBody string) ([]byte, string, error) {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	for _, part := range []struct {
+		contentType string
+		content     string
+	}{
+		{"text/plain; charset=UTF-8", plainBody},
+		{"text/html; charset=UTF-8", htmlBody},
+	} {
+		w, err := writer.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"8bit"},
+		})
+		if err != nil {
+			return nil, "", err
+		}
+		_, err = w.Write([]byte(strings.ReplaceAll(part.content, "\n", "\r\n")))
+		if err != nil {
+			return nil, "", err
+		}
+	}
+	err := writer.Close()
+	if err != nil {
+		return nil, "", err
+	}
+	return body.Bytes(), "multipart/alternative; boundary=" + writer.Boundary(), nil
+}
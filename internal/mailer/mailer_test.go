@@ -0,0 +1,136 @@
+package mailer
+
+import (
+	"bufio"
+	"net"
+	"net/mail"
+	"strconv"
+	"strings"
+	"testing"
+
+	"cosmetcab.dp.ua/internal/assert"
+)
+
+// fakeSMTPServer accepts SMTP sessions and sends the received message
+// data to the returned channel. Like real servers it rejects a MAIL FROM
+// that isn't a bare address in angle brackets. The message data of each
+// session is answered with the next of the given replies, "250 OK" once
+// they run out.
+func fakeSMTPServer(t *testing.T, replies ...string) (*SMTP, <-chan string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	messages := make(chan string, 10)
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			dataReply := "250 OK"
+			if len(replies) > 0 {
+				dataReply, replies = replies[0], replies[1:]
+			}
+			serveSMTP(conn, dataReply, messages)
+		}
+	}()
+
+	host, port, _ := net.SplitHostPort(ln.Addr().String())
+	portNumber, _ := strconv.Atoi(port)
+	sender, _ := mail.ParseAddress("LabBeauty <no-reply@cosmetcab.dp.ua>")
+	return &SMTP{Host: host, Port: portNumber, Sender: sender, Attempts: 3}, messages
+}
+
+func serveSMTP(conn net.Conn, dataReply string, messages chan<- string) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+	reply("220 localhost ESMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		command := strings.ToUpper(strings.TrimSpace(line))
+		switch {
+		case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+			reply("250 localhost")
+		case strings.HasPrefix(command, "MAIL FROM:"):
+			path := strings.TrimSpace(line)[len("MAIL FROM:"):]
+			if !strings.HasPrefix(path, "<") || !strings.HasSuffix(path, ">") ||
+				strings.ContainsAny(path[1:len(path)-1], "<> ") {
+				reply("501 malformed sender address")
+				continue
+			}
+			reply("250 OK")
+		case command == "DATA":
+			reply("354 end data with <CR><LF>.<CR><LF>")
+			var data strings.Builder
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == ".\r\n" {
+					break
+				}
+				data.WriteString(line)
+			}
+			messages <- data.String()
+			reply(dataReply)
+		case command == "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+func TestSend(t *testing.T) {
+	smtp, messages := fakeSMTPServer(t)
+	m := New(smtp)
+
+	err := m.Send("owner@example.com", "user_welcome.tmpl", map[string]any{
+		"name":            "Olena",
+		"userID":          7,
+		"activationToken": "ABCDEFGHIJKLMNOPQRSTUVWXYZ",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := <-messages
+	assert.Equal(t, strings.Contains(msg, "From: \"LabBeauty\" <no-reply@cosmetcab.dp.ua>\r\n"), true)
+	assert.Equal(t, strings.Contains(msg, "To: owner@example.com\r\n"), true)
+	assert.Equal(t, strings.Contains(msg, "Subject: Welcome to LabBeauty!\r\n"), true)
+	assert.Equal(t, strings.Contains(msg, "Content-Type: multipart/alternative"), true)
+	assert.Equal(t, strings.Contains(msg, "Content-Type: text/plain; charset=UTF-8"), true)
+	assert.Equal(t, strings.Contains(msg, "Content-Type: text/html; charset=UTF-8"), true)
+	// the token is in both bodies
+	assert.Equal(t, strings.Count(msg, "ABCDEFGHIJKLMNOPQRSTUVWXYZ"), 2)
+}
+
+func TestSendWithoutHost(t *testing.T) {
+	m := New(&SMTP{Port: 587})
+	err := m.Send("owner@example.com", "user_welcome.tmpl", nil)
+	assert.Equal(t, err != nil, true)
+}
+
+// TestSMTPSendRetries tests that temporary replies are retried
+// and permanent ones are not
+func TestSMTPSendRetries(t *testing.T) {
+	smtp, messages := fakeSMTPServer(t, "451 try again later")
+	err := smtp.Send([]string{"owner@example.com"}, "Lead", "text/plain; charset=UTF-8", []byte("Hello"))
+	assert.Equal(t, err, nil)
+	assert.Equal(t, len(messages), 2)
+
+	smtp, messages = fakeSMTPServer(t, "554 rejected")
+	err = smtp.Send([]string{"owner@example.com"}, "Lead", "text/plain; charset=UTF-8", []byte("Hello"))
+	assert.Equal(t, err != nil, true)
+	assert.Equal(t, len(messages), 1)
+}
@@ -0,0 +1,78 @@
+package mailer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SMTP delivers emails through an SMTP server. It is shared by the
+// templated account emails and the email notification channel.
+type SMTP struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	// Sender is shown with its name in the From header, the SMTP envelope
+	// only carries the address
+	Sender   *mail.Address
+	Attempts int
+}
+
+// Send delivers the body with the given content type to the recipients.
+// Connection errors and temporary (4xx) replies are retried, permanent
+// (5xx) replies are not.
+func (s *SMTP) Send(recipients []string, subject, contentType string, body []byte) error {
+	if s.Host == "" {
+		return errors.New("no SMTP host configured")
+	}
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", s.Sender.String())
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(recipients, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&msg, "Content-Type: %s\r\n\r\n", contentType)
+	msg.Write(body)
+
+	var auth smtp.Auth
+	if s.Username != "" {
+		auth = smtp.PlainAuth("", s.Username, s.Password, s.Host)
+	}
+	addr := net.JoinHostPort(s.Host, strconv.Itoa(s.Port))
+	attempts := s.Attempts
+	if attempts < 1 {
+		attempts = 1
+	}
+	var err error
+	for i := 1; i <= attempts; i++ {
+		err = smtp.SendMail(addr, auth, s.Sender.Address, recipients, msg.Bytes())
+		if err == nil || !temporary(err) {
+			return err
+		}
+		if i < attempts {
+			time.Sleep(time.Duration(i) * 500 * time.Millisecond)
+		}
+	}
+	return fmt.Errorf("failed after %d attempts: %w", attempts, err)
+}
+
+// temporary reports whether sending may succeed when tried again, that is
+// when the server could not be reached or replied with a 4xx code
+func temporary(err error) bool {
+	var protoErr *textproto.Error
+	if errors.As(err, &protoErr) {
+		return protoErr.Code >= 400 && protoErr.Code < 500
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
@@ -0,0 +1,28 @@
+package notifier
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"cosmetcab.dp.ua/internal/mailer"
+)
+
+// Email sends messages as plain text emails through an SMTP server
+type Email struct {
+	SMTP       *mailer.SMTP
+	Recipients []string
+}
+
+func (e *Email) Notify(ctx context.Context, msg Message) error {
+	subject := msg.Subject
+	if subject == "" {
+		subject = string(msg.Event)
+	}
+	body := strings.ReplaceAll(msg.Text, "\n", "\r\n")
+	err := e.SMTP.Send(e.Recipients, subject, "text/plain; charset=UTF-8", []byte(body))
+	if err != nil {
+		return fmt.Errorf("email: %w", err)
+	}
+	return nil
+}
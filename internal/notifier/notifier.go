@@ -0,0 +1,133 @@
+package notifier
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Event identifies what happened so that routing rules
+// can decide which channels hear about it.
+type Event string
+
+const (
+	EventError   Event = "error"
+	EventLead    Event = "lead"
+	EventBooking Event = "booking"
+	// EventSecurity reports things like locked accounts
+	EventSecurity Event = "security"
+)
+
+func (e Event) Valid() bool {
+	switch e {
+	case EventError, EventLead, EventBooking, EventSecurity:
+		return true
+	}
+	return false
+}
+
+type Message struct {
+	Event   Event  `json:"event"`
+	Subject string `json:"subject"`
+	Text    string `json:"text"`
+}
+
+// Notifier is implemented by every channel that messages can be sent to
+type Notifier interface {
+	Notify(ctx context.Context, msg Message) error
+}
+
+// Router sends each message to the channels routed for its event
+type Router struct {
+	routes map[Event][]Notifier
+}
+
+func NewRouter() *Router {
+	return &Router{routes: make(map[Event][]Notifier)}
+}
+
+func (r *Router) Route(event Event, n Notifier) {
+	r.routes[event] = append(r.routes[event], n)
+}
+
+// Notify sends the message to every routed channel even when some of
+// them fail, and returns all errors that occurred.
+func (r *Router) Notify(ctx context.Context, msg Message) error {
+	var errs []error
+	for _, n := range r.routes[msg.Event] {
+		err := n.Notify(ctx, msg)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ParseRoutes parses routing rules in the form "event:channel,event:channel"
+// and routes each event to the named channels.
+func (r *Router) ParseRoutes(rules string, channels map[string]Notifier) error {
+	for _, rule := range strings.Split(rules, ",") {
+		rule = strings.TrimSpace(rule)
+		if rule == "" {
+			continue
+		}
+		event, channel, found := strings.Cut(rule, ":")
+		if !found {
+			return fmt.Errorf("invalid notification route %q", rule)
+		}
+		if !Event(event).Valid() {
+			return fmt.Errorf("unknown notification event %q", event)
+		}
+		n, ok := channels[channel]
+		if !ok {
+			return fmt.Errorf("notification channel %q is not configured", channel)
+		}
+		r.Route(Event(event), n)
+	}
+	return nil
+}
+
+// doWithRetry sends the request built by newRequest until it succeeds,
+// waiting a bit longer after each failed attempt. Server errors and
+// rate limiting are retried, other unsuccessful statuses are not.
+func doWithRetry(ctx context.Context, client *http.Client, attempts int, newRequest func() (*http.Request, error)) error {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	if attempts < 1 {
+		attempts = 1
+	}
+	var err error
+	for i := 1; i <= attempts; i++ {
+		var req *http.Request
+		req, err = newRequest()
+		if err != nil {
+			return err
+		}
+		var resp *http.Response
+		resp, err = client.Do(req.WithContext(ctx))
+		if err == nil {
+			body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+			resp.Body.Close()
+			if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+				return nil
+			}
+			err = fmt.Errorf("unexpected status %s: %s", resp.Status, strings.TrimSpace(string(body)))
+			if resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests {
+				return err
+			}
+		}
+		if i < attempts {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(time.Duration(i) * time.Second):
+			}
+		}
+	}
+	return fmt.Errorf("failed after %d attempts: %w", attempts, err)
+}
@@ -0,0 +1,94 @@
+package notifier
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"cosmetcab.dp.ua/internal/assert"
+)
+
+func TestTelegramNotify(t *testing.T) {
+	var calls int
+	var text string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		assert.Equal(t, r.Method, http.MethodPost)
+		assert.Equal(t, r.URL.Path, "/bottoken/sendMessage")
+		// the first attempt fails so that the message is retried
+		if calls == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		text = r.FormValue("text")
+	}))
+	defer ts.Close()
+
+	telegram := &Telegram{BaseURL: ts.URL, Token: "token", ChatID: "1", Attempts: 2}
+	err := telegram.Notify(context.Background(), Message{Event: EventLead, Subject: "Lead", Text: "Hello"})
+	assert.Equal(t, err, nil)
+	assert.Equal(t, calls, 2)
+	assert.Equal(t, text, "Lead\nHello")
+}
+
+func TestTelegramNotifyClientError(t *testing.T) {
+	var calls int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer ts.Close()
+
+	telegram := &Telegram{BaseURL: ts.URL, Attempts: 3}
+	err := telegram.Notify(context.Background(), Message{Event: EventError, Text: "Hello"})
+	assert.Equal(t, err != nil, true)
+	// client errors are not retried
+	assert.Equal(t, calls, 1)
+}
+
+func TestWebhookSignature(t *testing.T) {
+	var signature, expected string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		signature = r.Header.Get("X-Signature")
+		expected = Sign("secret", body)
+	}))
+	defer ts.Close()
+
+	webhook := &Webhook{URL: ts.URL, Secret: "secret"}
+	err := webhook.Notify(context.Background(), Message{Event: EventBooking, Text: "Hello"})
+	assert.Equal(t, err, nil)
+	assert.Equal(t, signature, expected)
+}
+
+type recorder struct {
+	messages []Message
+}
+
+func (r *recorder) Notify(ctx context.Context, msg Message) error {
+	r.messages = append(r.messages, msg)
+	return nil
+}
+
+func TestRouter(t *testing.T) {
+	telegram, email := &recorder{}, &recorder{}
+	router := NewRouter()
+	err := router.ParseRoutes("error:telegram, lead:telegram,lead:email", map[string]Notifier{
+		"telegram": telegram,
+		"email":    email,
+	})
+	assert.Equal(t, err, nil)
+
+	router.Notify(context.Background(), Message{Event: EventError})
+	router.Notify(context.Background(), Message{Event: EventLead})
+	router.Notify(context.Background(), Message{Event: EventBooking})
+	assert.Equal(t, len(telegram.messages), 2)
+	assert.Equal(t, len(email.messages), 1)
+
+	err = router.ParseRoutes("lead:webhook", map[string]Notifier{})
+	assert.Equal(t, err != nil, true)
+	err = router.ParseRoutes("unknown:telegram", map[string]Notifier{"telegram": telegram})
+	assert.Equal(t, err != nil, true)
+}
@@ -0,0 +1,44 @@
+package notifier
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Telegram sends messages to a chat through the Telegram Bot API.
+// BaseURL can point to a local fake server in development and tests.
+type Telegram struct {
+	BaseURL  string
+	Token    string
+	ChatID   string
+	Attempts int
+	Client   *http.Client
+}
+
+func (t *Telegram) Notify(ctx context.Context, msg Message) error {
+	text := msg.Text
+	if msg.Subject != "" {
+		text = msg.Subject + "\n" + msg.Text
+	}
+	form := url.Values{
+		"chat_id": {t.ChatID},
+		"text":    {text},
+	}
+	endpoint := fmt.Sprintf("%s/bot%s/sendMessage", strings.TrimSuffix(t.BaseURL, "/"), t.Token)
+
+	err := doWithRetry(ctx, t.Client, t.Attempts, func() (*http.Request, error) {
+		req, err := http.NewRequest(http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return req, nil
+	})
+	if err != nil {
+		return fmt.Errorf("telegram: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Webhook posts messages as JSON to an URL. Every request carries an
+// X-Signature header with the hex HMAC-SHA256 of the body so that the
+// receiver can check it was sent by us.
+type Webhook struct {
+	URL      string
+	Secret   string
+	Attempts int
+	Client   *http.Client
+}
+
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func (wh *Webhook) Notify(ctx context.Context, msg Message) error {
+	body, err := json.Marshal(struct {
+		Message
+		SentAt time.Time `json:"sent_at"`
+	}{msg, time.Now().UTC()})
+	if err != nil {
+		return err
+	}
+	signature := Sign(wh.Secret, body)
+
+	err = doWithRetry(ctx, wh.Client, wh.Attempts, func() (*http.Request, error) {
+		req, err := http.NewRequest(http.MethodPost, wh.URL, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Signature", signature)
+		return req, nil
+	})
+	if err != nil {
+		return fmt.Errorf("webhook: %w", err)
+	}
+	return nil
+}
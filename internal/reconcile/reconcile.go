@@ -0,0 +1,143 @@
+// Package reconcile compares the blob storage with the photo URLs stored in
+// the database. Photos are uploaded and deleted by background jobs apart
+// from the records referring to them, so the two can drift apart.
+package reconcile
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"cosmetcab.dp.ua/internal/blobstore"
+	"cosmetcab.dp.ua/internal/data"
+)
+
+// DefaultMinAge is how old a blob must be to count as orphaned by default
+const DefaultMinAge = 24 * time.Hour
+
+type Options struct {
+	// DeleteOrphans deletes the blobs no record refers to
+	DeleteOrphans bool
+	// FlagCategories flags the categories whose photo is missing and
+	// clears the flag of the others
+	FlagCategories bool
+	// DryRun reports what would be deleted and flagged without changing
+	// anything
+	DryRun bool
+	// MinAge protects new blobs, which may belong to a record that is
+	// not saved yet
+	MinAge time.Duration
+}
+
+// Report is the outcome of a reconciliation
+type Report struct {
+	Blobs      int  `json:"blobs"`
+	References int  `json:"references"`
+	DryRun     bool `json:"dry_run"`
+	// Orphaned are the blobs no record refers to
+	Orphaned []string `json:"orphaned"`
+	// Missing are the photo URLs whose blob doesn't exist
+	Missing []*data.PhotoReference `json:"missing"`
+	// BrokenCategories are the categories whose photo is missing
+	BrokenCategories []int64 `json:"broken_categories"`
+	// Deleted are the orphans that were deleted
+	Deleted []string `json:"deleted"`
+	// CategoriesFlagged is how many category flags were changed
+	CategoriesFlagged int64 `json:"categories_flagged"`
+}
+
+// Storage is the part of blobstore.BlobStore reconciliation needs
+type Storage interface {
+	ListBlobs() ([]*blobstore.Blob, error)
+	DeleteBlob(blobName string) error
+}
+
+// Compare returns the blobs no reference points to and the references
+// whose blob is not stored. Blobs in flight are left out of both, as are
+// orphans modified after the cutoff.
+func Compare(blobs []*blobstore.Blob, references []*data.PhotoReference, inFlight []string, cutoff time.Time) ([]string, []*data.PhotoReference) {
+	skipped := make(map[string]bool, len(inFlight))
+	for _, blobName := range inFlight {
+		skipped[blobName] = true
+	}
+	stored := make(map[string]bool, len(blobs))
+	for _, blob := range blobs {
+		stored[blob.Name] = true
+	}
+	referenced := make(map[string]bool, len(references))
+	missing := []*data.PhotoReference{}
+	for _, reference := range references {
+		blobName := blobstore.BlobNameFromURL(reference.URL)
+		referenced[blobName] = true
+		if !stored[blobName] && !skipped[blobName] {
+			missing = append(missing, reference)
+		}
+	}
+	orphaned := []string{}
+	for _, blob := range blobs {
+		if !referenced[blob.Name] && !skipped[blob.Name] && blob.LastModified.Before(cutoff) {
+			orphaned = append(orphaned, blob.Name)
+		}
+	}
+	sort.Strings(orphaned)
+	return orphaned, missing
+}
+
+// Run reconciles the storage with the database and applies the options.
+// The report is returned even when some orphans couldn't be deleted.
+func Run(storage Storage, models data.Models, opts Options) (*Report, error) {
+	// references are read before the listing, so a record saved in between
+	// shows up as an orphan, which MinAge protects, rather than a missing
+	// photo
+	references, err := models.Photos.GetAllReferences()
+	if err != nil {
+		return nil, err
+	}
+	blobs, err := storage.ListBlobs()
+	if err != nil {
+		return nil, err
+	}
+	inFlight, err := models.Photos.GetInFlightBlobNames()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{
+		Blobs:            len(blobs),
+		References:       len(references),
+		DryRun:           opts.DryRun,
+		BrokenCategories: []int64{},
+		Deleted:          []string{},
+	}
+	report.Orphaned, report.Missing = Compare(blobs, references, inFlight, time.Now().Add(-opts.MinAge))
+	broken := make(map[int64]bool)
+	for _, reference := range report.Missing {
+		if reference.Owner == data.MediaCategory && !broken[reference.OwnerID] {
+			broken[reference.OwnerID] = true
+			report.BrokenCategories = append(report.BrokenCategories, reference.OwnerID)
+		}
+	}
+	if opts.DryRun {
+		return report, nil
+	}
+
+	var errs []error
+	if opts.DeleteOrphans {
+		for _, blobName := range report.Orphaned {
+			err = storage.DeleteBlob(blobName)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("deleting %s: %w", blobName, err))
+				continue
+			}
+			report.Deleted = append(report.Deleted, blobName)
+		}
+	}
+	if opts.FlagCategories {
+		report.CategoriesFlagged, err = models.Categories.SetPhotoMissing(report.BrokenCategories)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return report, errors.Join(errs...)
+}
@@ -0,0 +1,35 @@
+package reconcile
+
+import (
+	"testing"
+	"time"
+
+	"cosmetcab.dp.ua/internal/assert"
+	"cosmetcab.dp.ua/internal/blobstore"
+	"cosmetcab.dp.ua/internal/data"
+)
+
+func TestCompare(t *testing.T) {
+	now := time.Now()
+	old := now.Add(-48 * time.Hour)
+	blobs := []*blobstore.Blob{
+		{Name: "a-hero.jpg", LastModified: old},
+		{Name: "orphan.jpg", LastModified: old},
+		// too new to be called an orphan
+		{Name: "new.jpg", LastModified: now},
+		// its deletion is queued
+		{Name: "deleting.jpg", LastModified: old},
+	}
+	references := []*data.PhotoReference{
+		{Owner: data.MediaCategory, OwnerID: 1, URL: "https://example.com/photos/a-hero.jpg"},
+		{Owner: data.MediaCategory, OwnerID: 2, URL: "/static/uploads/gone.jpg"},
+		// its upload is queued
+		{Owner: data.MediaStaff, OwnerID: 3, URL: "/static/uploads/uploading.jpg"},
+	}
+
+	orphaned, missing := Compare(blobs, references, []string{"deleting.jpg", "uploading.jpg"}, now.Add(-DefaultMinAge))
+	assert.Equal(t, len(orphaned), 1)
+	assert.Equal(t, orphaned[0], "orphan.jpg")
+	assert.Equal(t, len(missing), 1)
+	assert.Equal(t, missing[0].OwnerID, int64(2))
+}
@@ -0,0 +1,58 @@
+package totp
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+
+	"cosmetcab.dp.ua/internal/assert"
+)
+
+// TestCode checks the SHA1 test vectors from RFC 6238, truncated to 6 digits
+func TestCode(t *testing.T) {
+	secret := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+	for _, tt := range tests {
+		code, err := Code(secret, Step(time.Unix(tt.unix, 0)))
+		assert.Equal(t, err, nil)
+		assert.Equal(t, code, tt.code)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret := GenerateSecret()
+	now := time.Now()
+	code, _ := Code(secret, Step(now))
+
+	step, ok := Validate(secret, code, now, 0)
+	assert.Equal(t, ok, true)
+	assert.Equal(t, step, Step(now))
+
+	// a code from the previous period is still accepted
+	_, ok = Validate(secret, code, now.Add(period*time.Second), 0)
+	assert.Equal(t, ok, true)
+
+	// but not once it has been used
+	_, ok = Validate(secret, code, now, step)
+	assert.Equal(t, ok, false)
+
+	_, ok = Validate(secret, "12345", now, 0)
+	assert.Equal(t, ok, false)
+}
+
+func TestProvisioningURI(t *testing.T) {
+	uri := ProvisioningURI("LabBeauty", "owner@example.com", "JBSWY3DPEHPK3PXP")
+	assert.Equal(t, strings.HasPrefix(uri, "otpauth://totp/LabBeauty:owner@example.com?"), true)
+	assert.Equal(t, strings.Contains(uri, "secret=JBSWY3DPEHPK3PXP"), true)
+	assert.Equal(t, strings.Contains(uri, "issuer=LabBeauty"), true)
+}
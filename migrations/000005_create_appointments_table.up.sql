@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS appointments (
+    id bigserial PRIMARY KEY,
+    service_id bigint NOT NULL REFERENCES services (id) ON DELETE CASCADE,
+    client_name TEXT NOT NULL,
+    client_phone TEXT NOT NULL,
+    starts_at timestamp(0) with time zone NOT NULL,
+    ends_at timestamp(0) with time zone NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending',
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    version integer NOT NULL DEFAULT 1,
+    CONSTRAINT appointments_time_check CHECK (ends_at > starts_at),
+    CONSTRAINT appointments_no_overlap EXCLUDE USING gist (tstzrange(starts_at, ends_at) WITH &&) WHERE (status <> 'cancelled')
+);
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS staff (
+    id bigserial PRIMARY KEY,
+    name TEXT NOT NULL,
+    bio TEXT NOT NULL DEFAULT '',
+    photo_url TEXT NOT NULL UNIQUE
+);
+
+CREATE TABLE IF NOT EXISTS staff_services (
+    staff_id bigint NOT NULL REFERENCES staff (id) ON DELETE CASCADE,
+    service_id bigint NOT NULL REFERENCES services (id) ON DELETE CASCADE,
+    price integer,
+    time smallint,
+    PRIMARY KEY (staff_id, service_id)
+);
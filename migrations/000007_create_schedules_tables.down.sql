@@ -0,0 +1,7 @@
+ALTER TABLE appointments DROP CONSTRAINT IF EXISTS appointments_no_overlap;
+ALTER TABLE appointments DROP COLUMN IF EXISTS staff_id;
+ALTER TABLE appointments ADD CONSTRAINT appointments_no_overlap
+    EXCLUDE USING gist (tstzrange(starts_at, ends_at) WITH &&) WHERE (status <> 'cancelled');
+DROP TABLE IF EXISTS staff_schedule_exceptions;
+DROP TABLE IF EXISTS staff_breaks;
+DROP TABLE IF EXISTS staff_working_hours;
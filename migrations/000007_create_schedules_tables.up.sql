@@ -0,0 +1,33 @@
+CREATE EXTENSION IF NOT EXISTS btree_gist;
+
+CREATE TABLE IF NOT EXISTS staff_working_hours (
+    staff_id bigint NOT NULL REFERENCES staff (id) ON DELETE CASCADE,
+    weekday smallint NOT NULL CHECK (weekday BETWEEN 0 AND 6),
+    starts_at time NOT NULL,
+    ends_at time NOT NULL CHECK (ends_at > starts_at),
+    PRIMARY KEY (staff_id, weekday)
+);
+
+CREATE TABLE IF NOT EXISTS staff_breaks (
+    id bigserial PRIMARY KEY,
+    staff_id bigint NOT NULL REFERENCES staff (id) ON DELETE CASCADE,
+    weekday smallint NOT NULL CHECK (weekday BETWEEN 0 AND 6),
+    starts_at time NOT NULL,
+    ends_at time NOT NULL CHECK (ends_at > starts_at)
+);
+
+CREATE TABLE IF NOT EXISTS staff_schedule_exceptions (
+    id bigserial PRIMARY KEY,
+    staff_id bigint NOT NULL REFERENCES staff (id) ON DELETE CASCADE,
+    date date NOT NULL,
+    day_off bool NOT NULL DEFAULT false,
+    starts_at time,
+    ends_at time,
+    note TEXT NOT NULL DEFAULT '',
+    UNIQUE (staff_id, date)
+);
+
+ALTER TABLE appointments ADD COLUMN staff_id bigint REFERENCES staff (id) ON DELETE SET NULL;
+ALTER TABLE appointments DROP CONSTRAINT appointments_no_overlap;
+ALTER TABLE appointments ADD CONSTRAINT appointments_no_overlap
+    EXCLUDE USING gist (COALESCE(staff_id, 0) WITH =, tstzrange(starts_at, ends_at) WITH &&) WHERE (status <> 'cancelled');
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS leads;
\ No newline at end of file
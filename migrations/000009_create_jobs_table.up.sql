@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS jobs (
+    id bigserial PRIMARY KEY,
+    kind TEXT NOT NULL,
+    payload jsonb NOT NULL DEFAULT '{}',
+    data bytea,
+    status TEXT NOT NULL DEFAULT 'pending',
+    attempts integer NOT NULL DEFAULT 0,
+    max_attempts integer NOT NULL DEFAULT 5,
+    run_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    locked_at timestamp(0) with time zone,
+    last_error TEXT NOT NULL DEFAULT '',
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    updated_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS jobs_status_run_at_idx ON jobs (status, run_at);
@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS categories_title_trgm_idx;
+DROP INDEX IF EXISTS subcategories_name_trgm_idx;
+DROP INDEX IF EXISTS services_description_trgm_idx;
+DROP INDEX IF EXISTS categories_search_idx;
+DROP INDEX IF EXISTS subcategories_search_idx;
+DROP INDEX IF EXISTS services_search_idx;
+ALTER TABLE categories DROP COLUMN IF EXISTS search;
+ALTER TABLE subcategories DROP COLUMN IF EXISTS search;
+ALTER TABLE services DROP COLUMN IF EXISTS search;
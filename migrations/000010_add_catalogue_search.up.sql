@@ -0,0 +1,20 @@
+-- PostgreSQL ships no Ukrainian stemmer and the russian one mangles
+-- Ukrainian words, so the search vectors use the language neutral
+-- 'simple' configuration. Prefix queries and trigram similarity make up
+-- for the missing stemming of word endings.
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+ALTER TABLE services ADD COLUMN search tsvector
+    GENERATED ALWAYS AS (setweight(to_tsvector('simple', description), 'A')) STORED;
+ALTER TABLE subcategories ADD COLUMN search tsvector
+    GENERATED ALWAYS AS (setweight(to_tsvector('simple', name), 'B')) STORED;
+ALTER TABLE categories ADD COLUMN search tsvector
+    GENERATED ALWAYS AS (setweight(to_tsvector('simple', title), 'B') || setweight(to_tsvector('simple', description), 'D')) STORED;
+
+CREATE INDEX IF NOT EXISTS services_search_idx ON services USING GIN (search);
+CREATE INDEX IF NOT EXISTS subcategories_search_idx ON subcategories USING GIN (search);
+CREATE INDEX IF NOT EXISTS categories_search_idx ON categories USING GIN (search);
+
+CREATE INDEX IF NOT EXISTS services_description_trgm_idx ON services USING GIN (description gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS subcategories_name_trgm_idx ON subcategories USING GIN (name gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS categories_title_trgm_idx ON categories USING GIN (title gin_trgm_ops);
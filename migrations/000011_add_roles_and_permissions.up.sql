@@ -0,0 +1,45 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS role text NOT NULL DEFAULT 'viewer'
+    CHECK (role IN ('owner', 'admin', 'staff', 'viewer'));
+-- accounts created before roles existed had full access
+UPDATE users SET role = 'owner';
+
+CREATE TABLE IF NOT EXISTS permissions (
+    id bigserial PRIMARY KEY,
+    code text NOT NULL UNIQUE
+);
+
+CREATE TABLE IF NOT EXISTS role_permissions (
+    role text NOT NULL CHECK (role IN ('owner', 'admin', 'staff', 'viewer')),
+    permission_id bigint NOT NULL REFERENCES permissions ON DELETE CASCADE,
+    PRIMARY KEY (role, permission_id)
+);
+
+INSERT INTO permissions (code)
+VALUES
+    ('categories:write'),
+    ('subcategories:write'),
+    ('services:write'),
+    ('staff:write'),
+    ('schedules:read'),
+    ('schedules:write'),
+    ('appointments:read'),
+    ('appointments:write'),
+    ('leads:read'),
+    ('leads:write'),
+    ('jobs:read'),
+    ('jobs:write'),
+    ('users:read'),
+    ('users:write');
+
+INSERT INTO role_permissions (role, permission_id)
+SELECT 'owner', id FROM permissions;
+
+INSERT INTO role_permissions (role, permission_id)
+SELECT 'admin', id FROM permissions WHERE code <> 'users:write';
+
+INSERT INTO role_permissions (role, permission_id)
+SELECT 'staff', id FROM permissions
+WHERE code IN ('schedules:read', 'appointments:read', 'appointments:write', 'leads:read');
+
+INSERT INTO role_permissions (role, permission_id)
+SELECT 'viewer', id FROM permissions WHERE code LIKE '%:read' AND code <> 'users:read';
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS tokens (
+    id bigserial PRIMARY KEY,
+    hash bytea NOT NULL UNIQUE,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    scope text NOT NULL,
+    expiry timestamp(0) with time zone NOT NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS tokens_user_id_scope_idx ON tokens (user_id, scope);
@@ -0,0 +1,2 @@
+DELETE FROM permissions WHERE code IN ('lockouts:read', 'lockouts:write');
+DROP TABLE IF EXISTS login_failures;
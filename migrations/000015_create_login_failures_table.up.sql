@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS login_failures (
+    id bigserial PRIMARY KEY,
+    -- kind is 'account' with the email as key or 'ip' with the client address
+    kind text NOT NULL CHECK (kind IN ('account', 'ip')),
+    key text NOT NULL,
+    failures integer NOT NULL DEFAULT 0,
+    last_failure_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    locked_until timestamp(0) with time zone,
+    UNIQUE (kind, key)
+);
+
+INSERT INTO permissions (code)
+VALUES ('lockouts:read'), ('lockouts:write');
+
+INSERT INTO role_permissions (role, permission_id)
+SELECT role, permissions.id
+FROM permissions, (VALUES ('owner'), ('admin')) AS roles (role)
+WHERE permissions.code IN ('lockouts:read', 'lockouts:write');
@@ -0,0 +1,2 @@
+-- set by admins to make a user choose a new password before the next login
+ALTER TABLE users ADD COLUMN IF NOT EXISTS password_change_required bool NOT NULL DEFAULT false;
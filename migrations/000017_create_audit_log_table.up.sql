@@ -0,0 +1,24 @@
+CREATE TABLE IF NOT EXISTS audit_log (
+    id bigserial PRIMARY KEY,
+    -- NULL for changes made by anonymous visitors, like bookings
+    actor_id bigint REFERENCES users ON DELETE SET NULL,
+    action text NOT NULL CHECK (action IN ('create', 'update', 'delete')),
+    entity_type text NOT NULL,
+    entity_id bigint NOT NULL,
+    before jsonb,
+    after jsonb,
+    request_id text NOT NULL DEFAULT '',
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS audit_log_entity_idx ON audit_log (entity_type, entity_id);
+CREATE INDEX IF NOT EXISTS audit_log_actor_id_idx ON audit_log (actor_id);
+CREATE INDEX IF NOT EXISTS audit_log_created_at_idx ON audit_log (created_at);
+
+INSERT INTO permissions (code)
+VALUES ('audit:read');
+
+INSERT INTO role_permissions (role, permission_id)
+SELECT role, permissions.id
+FROM permissions, (VALUES ('owner'), ('admin')) AS roles (role)
+WHERE permissions.code = 'audit:read';
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS service_prices (
+    id bigserial PRIMARY KEY,
+    service_id bigint NOT NULL REFERENCES services ON DELETE CASCADE,
+    price integer NOT NULL CHECK (price > 0),
+    effective_from timestamp(0) with time zone NOT NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    UNIQUE (service_id, effective_from)
+);
+
+-- the prices services have now start their history
+INSERT INTO service_prices (service_id, price, effective_from)
+SELECT id, price, date_trunc('second', NOW())
+FROM services
+WHERE price > 0;
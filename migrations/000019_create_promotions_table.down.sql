@@ -0,0 +1,3 @@
+DELETE FROM permissions WHERE code IN ('promotions:read', 'promotions:write');
+ALTER TABLE appointments DROP COLUMN IF EXISTS promotion_id;
+DROP TABLE IF EXISTS promotions;
@@ -0,0 +1,37 @@
+CREATE TABLE IF NOT EXISTS promotions (
+    id bigserial PRIMARY KEY,
+    title text NOT NULL,
+    kind text NOT NULL CHECK (kind IN ('percent', 'fixed')),
+    value integer NOT NULL CHECK (value > 0),
+    -- exactly one of the scopes is set
+    service_id bigint REFERENCES services ON DELETE CASCADE,
+    subcategory_id bigint REFERENCES subcategories ON DELETE CASCADE,
+    category_id bigint REFERENCES categories ON DELETE CASCADE,
+    starts_at timestamp(0) with time zone NOT NULL,
+    ends_at timestamp(0) with time zone NOT NULL,
+    -- promotions without a code apply to everyone automatically
+    code citext UNIQUE,
+    max_uses integer CHECK (max_uses > 0),
+    uses integer NOT NULL DEFAULT 0,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    version integer NOT NULL DEFAULT 1,
+    CONSTRAINT promotions_scope_check CHECK (num_nonnulls(service_id, subcategory_id, category_id) = 1),
+    CONSTRAINT promotions_time_check CHECK (ends_at > starts_at)
+);
+
+CREATE INDEX IF NOT EXISTS promotions_ends_at_idx ON promotions (ends_at);
+
+ALTER TABLE appointments ADD COLUMN IF NOT EXISTS promotion_id bigint REFERENCES promotions ON DELETE SET NULL;
+
+INSERT INTO permissions (code)
+VALUES ('promotions:read'), ('promotions:write');
+
+INSERT INTO role_permissions (role, permission_id)
+SELECT role, permissions.id
+FROM permissions, (VALUES ('owner'), ('admin'), ('viewer')) AS roles (role)
+WHERE permissions.code = 'promotions:read';
+
+INSERT INTO role_permissions (role, permission_id)
+SELECT role, permissions.id
+FROM permissions, (VALUES ('owner'), ('admin')) AS roles (role)
+WHERE permissions.code = 'promotions:write';
@@ -0,0 +1,3 @@
+DELETE FROM permissions WHERE code = 'packages:write';
+DROP TABLE IF EXISTS package_services;
+DROP TABLE IF EXISTS packages;
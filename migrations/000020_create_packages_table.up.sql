@@ -0,0 +1,28 @@
+CREATE TABLE IF NOT EXISTS packages (
+    id bigserial PRIMARY KEY,
+    title text NOT NULL,
+    description text NOT NULL DEFAULT '',
+    price integer NOT NULL CHECK (price > 0),
+    photo_url text NOT NULL UNIQUE,
+    category_id bigint NOT NULL REFERENCES categories ON DELETE CASCADE,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS packages_category_id_idx ON packages (category_id);
+
+-- a service can't be deleted while a package includes it, the package
+-- would keep its price for fewer services
+CREATE TABLE IF NOT EXISTS package_services (
+    package_id bigint NOT NULL REFERENCES packages ON DELETE CASCADE,
+    service_id bigint NOT NULL REFERENCES services ON DELETE RESTRICT,
+    quantity smallint NOT NULL CHECK (quantity > 0),
+    PRIMARY KEY (package_id, service_id)
+);
+
+INSERT INTO permissions (code)
+VALUES ('packages:write');
+
+INSERT INTO role_permissions (role, permission_id)
+SELECT role, permissions.id
+FROM permissions, (VALUES ('owner'), ('admin')) AS roles (role)
+WHERE permissions.code = 'packages:write';
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS service_translations;
+DROP TABLE IF EXISTS subcategory_translations;
+DROP TABLE IF EXISTS category_translations;
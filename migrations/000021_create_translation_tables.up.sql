@@ -0,0 +1,23 @@
+-- the entity tables keep the text in the default language, these hold the
+-- text in the other languages
+CREATE TABLE IF NOT EXISTS category_translations (
+    category_id bigint NOT NULL REFERENCES categories ON DELETE CASCADE,
+    lang text NOT NULL CHECK (lang IN ('uk', 'en', 'ru')),
+    title text NOT NULL,
+    description text NOT NULL DEFAULT '',
+    PRIMARY KEY (category_id, lang)
+);
+
+CREATE TABLE IF NOT EXISTS subcategory_translations (
+    subcategory_id bigint NOT NULL REFERENCES subcategories ON DELETE CASCADE,
+    lang text NOT NULL CHECK (lang IN ('uk', 'en', 'ru')),
+    name text NOT NULL,
+    PRIMARY KEY (subcategory_id, lang)
+);
+
+CREATE TABLE IF NOT EXISTS service_translations (
+    service_id bigint NOT NULL REFERENCES services ON DELETE CASCADE,
+    lang text NOT NULL CHECK (lang IN ('uk', 'en', 'ru')),
+    description text NOT NULL,
+    PRIMARY KEY (service_id, lang)
+);
@@ -0,0 +1,3 @@
+-- URLs of the resized variants of the photo by variant name, empty for
+-- photos uploaded before they were resized
+ALTER TABLE categories ADD COLUMN IF NOT EXISTS photos jsonb NOT NULL DEFAULT '{}';
@@ -0,0 +1,5 @@
+DROP TRIGGER IF EXISTS staff_delete_media ON staff;
+DROP TRIGGER IF EXISTS services_delete_media ON services;
+DROP TRIGGER IF EXISTS categories_delete_media ON categories;
+DROP FUNCTION IF EXISTS delete_owned_media();
+DROP TABLE IF EXISTS media;
@@ -0,0 +1,32 @@
+-- photos of categories, services and masters shown as galleries
+CREATE TABLE IF NOT EXISTS media (
+    id bigserial PRIMARY KEY,
+    owner_type text NOT NULL CHECK (owner_type IN ('category', 'service', 'staff')),
+    owner_id bigint NOT NULL,
+    url text NOT NULL UNIQUE,
+    variants jsonb NOT NULL DEFAULT '{}',
+    alt_text text NOT NULL DEFAULT '',
+    caption text NOT NULL DEFAULT '',
+    position integer NOT NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS media_owner_idx ON media (owner_type, owner_id, position);
+
+-- media can't reference its owner with a foreign key, so it is removed by
+-- triggers when the owner is deleted, including by cascades
+CREATE OR REPLACE FUNCTION delete_owned_media() RETURNS trigger AS $$
+BEGIN
+    DELETE FROM media WHERE owner_type = TG_ARGV[0] AND owner_id = OLD.id;
+    RETURN OLD;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER categories_delete_media AFTER DELETE ON categories
+FOR EACH ROW EXECUTE FUNCTION delete_owned_media('category');
+
+CREATE TRIGGER services_delete_media AFTER DELETE ON services
+FOR EACH ROW EXECUTE FUNCTION delete_owned_media('service');
+
+CREATE TRIGGER staff_delete_media AFTER DELETE ON staff
+FOR EACH ROW EXECUTE FUNCTION delete_owned_media('staff');
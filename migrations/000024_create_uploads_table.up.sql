@@ -0,0 +1,11 @@
+-- photos uploaded straight to the blob storage with a pre-signed URL,
+-- waiting to be confirmed and attached
+CREATE TABLE IF NOT EXISTS uploads (
+    id bigserial PRIMARY KEY,
+    blob_name text NOT NULL UNIQUE,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    expires_at timestamp(0) with time zone NOT NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS uploads_expires_at_idx ON uploads (expires_at);
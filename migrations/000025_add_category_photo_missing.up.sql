@@ -0,0 +1,3 @@
+-- set by the reconciliation of the blob storage when the photo of the
+-- category is no longer stored
+ALTER TABLE categories ADD COLUMN IF NOT EXISTS photo_missing boolean NOT NULL DEFAULT false;